@@ -0,0 +1,152 @@
+// Package cors lets browser front ends on other origins call the demo
+// services. It answers CORS preflight requests itself, since a router that
+// registers routes per method would otherwise reject OPTIONS with a 405.
+package cors
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Options struct {
+	AllowedOrigins   List // "*" allows any origin
+	AllowedMethods   List
+	AllowedHeaders   List
+	ExposedHeaders   List
+	AllowCredentials bool
+	MaxAge           int // seconds a preflight result may be cached
+
+	// Reports whether some route would serve the request. Preflights for
+	// requests that no route serves are refused. Nil allows every request.
+	Routable func(*http.Request) bool
+}
+
+// A comma-separated list given on the command line.
+type List []string
+
+func (l *List) String() string { return strings.Join(*l, ",") }
+
+func (l *List) Set(s string) error {
+	*l = splitList(s)
+	return nil
+}
+
+// Register -cors-* flags on the default FlagSet, with sensible defaults
+// for the lists left empty.
+func (o *Options) RegisterFlags() {
+	if len(o.AllowedMethods) == 0 {
+		o.AllowedMethods = List{"GET", "POST", "PUT", "DELETE"}
+	}
+	if len(o.AllowedHeaders) == 0 {
+		o.AllowedHeaders = List{"Content-Type", "Authorization"}
+	}
+	flag.Var(&o.AllowedOrigins, "cors-origins", "comma-separated allowed origins, or * (empty disables CORS)")
+	flag.Var(&o.AllowedMethods, "cors-methods", "comma-separated allowed methods")
+	flag.Var(&o.AllowedHeaders, "cors-headers", "comma-separated allowed request headers")
+	flag.Var(&o.ExposedHeaders, "cors-expose", "comma-separated response headers visible to scripts")
+	flag.BoolVar(&o.AllowCredentials, "cors-credentials", false, "allow cookies and HTTP auth")
+	flag.IntVar(&o.MaxAge, "cors-max-age", 600, "seconds browsers may cache a preflight")
+}
+
+func (o *Options) Enabled() bool { return len(o.AllowedOrigins) > 0 }
+
+// Wrap next so that cross-origin requests from allowed origins get the
+// Access-Control-* headers and preflights are answered without reaching next.
+func Handler(o Options, next http.Handler) http.Handler {
+	if !o.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		rw.Header().Add("Vary", "Origin")
+		if origin == "" || !o.originAllowed(origin) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if r.Method == http.MethodOptions && method != "" {
+			o.preflight(rw, r, origin, method)
+			return
+		}
+
+		o.allowOrigin(rw, origin)
+		if len(o.ExposedHeaders) > 0 {
+			rw.Header().Set("Access-Control-Expose-Headers", strings.Join(o.ExposedHeaders, ", "))
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func (o *Options) preflight(rw http.ResponseWriter, r *http.Request, origin string, method string) {
+	rw.Header().Add("Vary", "Access-Control-Request-Method")
+	rw.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	if !contains(o.AllowedMethods, method) || !o.routable(r, method) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+	for _, h := range splitList(r.Header.Get("Access-Control-Request-Headers")) {
+		if !contains(o.AllowedHeaders, h) {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	o.allowOrigin(rw, origin)
+	rw.Header().Set("Access-Control-Allow-Methods", strings.Join(o.AllowedMethods, ", "))
+	if len(o.AllowedHeaders) > 0 {
+		rw.Header().Set("Access-Control-Allow-Headers", strings.Join(o.AllowedHeaders, ", "))
+	}
+	if o.MaxAge > 0 {
+		rw.Header().Set("Access-Control-Max-Age", strconv.Itoa(o.MaxAge))
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// A wildcard cannot be combined with credentials, so echo the origin then.
+func (o *Options) allowOrigin(rw http.ResponseWriter, origin string) {
+	if contains(o.AllowedOrigins, "*") && !o.AllowCredentials {
+		rw.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		rw.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if o.AllowCredentials {
+		rw.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (o *Options) originAllowed(origin string) bool {
+	return contains(o.AllowedOrigins, "*") || contains(o.AllowedOrigins, origin)
+}
+
+// Would the actual request, as announced by the preflight, be routed?
+func (o *Options) routable(r *http.Request, method string) bool {
+	if o.Routable == nil {
+		return true
+	}
+	actual := r.Clone(r.Context())
+	actual.Method = method
+	return o.Routable(actual)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
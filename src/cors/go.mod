@@ -0,0 +1,3 @@
+module cors
+
+go 1.25.0
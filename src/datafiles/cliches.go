@@ -0,0 +1,48 @@
+package datafiles
+
+import (
+	"strings"
+)
+
+// cliches.db holds one cliche a line, as Author!Truism, numbered as
+// sayings.db is (see numberedLines). The author may not contain '!';
+// neither part may contain a newline.
+type Cliche struct {
+	Id     int // the line number
+	Author string
+	Truism string
+}
+
+// The cliches in text, the contents of file_name, and the id for the
+// next. Unlike sayings.db, the file may hold none. Every bad line is
+// reported.
+func ParseCliches(file_name string, text string) ([]*Cliche, int, error) {
+	errs := &Errors{File: file_name}
+	cliches := []*Cliche{}
+	all, nextId := numberedLines(text, errs)
+	for i, line := range all {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "!", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			errs.Add(i+1, "want Author!Truism")
+			continue
+		}
+		cliches = append(cliches, &Cliche{Id: i + 1, Author: strings.TrimSpace(parts[0]),
+			Truism: strings.TrimSpace(parts[1])})
+	}
+	if err := errs.OrNil(); err != nil {
+		return nil, 0, err
+	}
+	return cliches, nextId, nil
+}
+
+// The file for the cliches, which are in id order below nextId.
+func FormatCliches(cliches []*Cliche, nextId int) string {
+	ids, records := []int{}, []string{}
+	for _, c := range cliches {
+		ids, records = append(ids, c.Id), append(records, c.Author+"!"+c.Truism)
+	}
+	return formatNumbered(ids, records, nextId)
+}
@@ -0,0 +1,61 @@
+package datafiles
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseCliches(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		want string // the cliches and next id, or the error
+	}{
+		{"Ann!Soon.\n", "[1 Ann|Soon.] 2"},
+		{"Ann!Soon.\n\nBob!Wow! Later.\n\n", "[1 Ann|Soon. 3 Bob|Wow! Later.] 5"},
+		{"", "[] 1"},
+		{"\n\n", "[] 3"},
+		{"Ann!Soon.\n\n# next id: 9\n", "[1 Ann|Soon.] 9"},
+		{"# next id: 4\n", "[] 4"},
+		{"Ann!Soon.\nBob\n!Later.\nCy! \n", "f line 2: want Author!Truism\n" +
+			"f line 3: want Author!Truism\nf line 4: want Author!Truism"},
+	} {
+		cliches, nextId, err := ParseCliches("f", c.text)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			list := []string{}
+			for _, c := range cliches {
+				list = append(list, fmt.Sprintf("%d %s|%s", c.Id, c.Author, c.Truism))
+			}
+			got = fmt.Sprintf("[%s] %d", strings.Join(list, " "), nextId)
+		}
+		if got != c.want {
+			t.Errorf("%q: got %q, want %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestFormatCliches(t *testing.T) {
+	cliches := []*Cliche{{Id: 2, Author: "Ann", Truism: "Soon."}, {Id: 3, Author: "Bob", Truism: "Wow! Later."}}
+	text := FormatCliches(cliches, 5)
+	if want := "\nAnn!Soon.\nBob!Wow! Later.\n# next id: 5\n"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+	again, nextId, err := ParseCliches("f", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nextId != 5 {
+		t.Errorf("next id %d, want 5", nextId)
+	}
+	if len(again) != len(cliches) {
+		t.Fatalf("read back %d cliches, want %d", len(again), len(cliches))
+	}
+	for i := range again {
+		if *again[i] != *cliches[i] {
+			t.Errorf("read back %+v, want %+v", *again[i], *cliches[i])
+		}
+	}
+}
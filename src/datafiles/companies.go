@@ -0,0 +1,259 @@
+package datafiles
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// companies.csv is a CSV file whose header names the columns, in any
+// order. Id, name, CEO and both address lines are required; website,
+// industry and founded (a year) are optional, as columns and as values.
+// The ids are what sayings.db refers to.
+//
+// A last line "# next id: N" is the high-water mark, so that a new
+// company never takes a deleted company's id; without it the next id is
+// one more than the largest. Other lines starting with '#' are comments.
+//
+// The old companies.db, groups of four lines (CEO, name, two address
+// lines) with no ids, numbers the companies from 1 in file order.
+type Company struct {
+	Id       int
+	CEO      string
+	Name     string
+	Address1 string
+	Address2 string
+	Website  string
+	Industry string
+	Founded  int // 0 if unknown
+}
+
+var requiredColumns = []string{"id", "name", "ceo", "address1", "address2"}
+var companyColumns = []string{"id", "name", "ceo", "address1", "address2", "website", "industry", "founded"}
+
+const nextIdComment = "# next id: "
+
+// Read the companies, and the id for the next, from file_name, first
+// migrating legacy to it if there is no file_name yet; migrated says
+// whether that happened. If neither file is there, the error satisfies
+// errors.Is(err, fs.ErrNotExist).
+func LoadCompanies(file_name string, legacy string) (companies []*Company, nextId int, migrated bool, err error) {
+	if _, err := os.Stat(file_name); os.IsNotExist(err) {
+		if err := MigrateCompanies(legacy, file_name); err != nil {
+			return nil, 0, false, err
+		}
+		migrated = true
+	}
+
+	text, err := ioutil.ReadFile(file_name)
+	if err != nil {
+		return nil, 0, migrated, errors.New("Cannot read " + file_name + ".")
+	}
+	companies, nextId, err = ParseCompanies(file_name, string(text))
+	return companies, nextId, migrated, err
+}
+
+// The companies in text, the contents of file_name, which must hold at
+// least one, and the id for the next. Every bad line is reported.
+func ParseCompanies(file_name string, text string) ([]*Company, int, error) {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.FieldsPerRecord = -1 // checked below, to report every bad line
+	reader.Comment = '#'
+	errs := &Errors{File: file_name}
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, 0, errors.New(file_name + " is empty.")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !contains(companyColumns, name) {
+			errs.Add(1, "unknown column %q", name)
+		} else if _, dup := columns[name]; dup {
+			errs.Add(1, "column %q repeated", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range requiredColumns {
+		if _, ok := columns[name]; !ok {
+			errs.Add(1, "no %q column", name)
+		}
+	}
+	if err := errs.OrNil(); err != nil {
+		return nil, 0, err
+	}
+
+	companies := []*Company{}
+	nextId := 1
+	lines := make(map[int]int) // id -> line it was first seen on
+	thisYear := time.Now().Year()
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if perr, ok := err.(*csv.ParseError); ok {
+			errs.Add(perr.Line, "%v", perr.Err)
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			errs.Add(line, "%d fields, want %d", len(record), len(header))
+			continue
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		c := &Company{
+			CEO:      field("ceo"),
+			Name:     field("name"),
+			Address1: field("address1"),
+			Address2: field("address2"),
+			Website:  field("website"),
+			Industry: field("industry")}
+		for _, name := range requiredColumns[1:] {
+			if field(name) == "" {
+				errs.Add(line, "no %s", name)
+			}
+		}
+
+		c.Id, err = strconv.Atoi(field("id"))
+		if err != nil || c.Id < 1 {
+			errs.Add(line, "bad id %q", field("id"))
+		} else if first, dup := lines[c.Id]; dup {
+			errs.Add(line, "id %d already used on line %d", c.Id, first)
+		} else {
+			lines[c.Id] = line
+			if c.Id >= nextId {
+				nextId = c.Id + 1
+			}
+		}
+		if founded := field("founded"); founded != "" {
+			c.Founded, err = strconv.Atoi(founded)
+			if err != nil || c.Founded < 1000 || c.Founded > thisYear {
+				errs.Add(line, "bad founded year %q", founded)
+			}
+		}
+		if c.Website != "" && !strings.HasPrefix(c.Website, "http://") && !strings.HasPrefix(c.Website, "https://") {
+			errs.Add(line, "website %q is not an http(s) URL", c.Website)
+		}
+		companies = append(companies, c)
+	}
+
+	for i, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, nextIdComment) {
+			continue
+		}
+		mark, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, nextIdComment)))
+		if err != nil || mark < 1 {
+			errs.Add(i+1, "bad next id %q", strings.TrimPrefix(line, nextIdComment))
+		} else if mark > nextId {
+			nextId = mark
+		}
+	}
+
+	if err := errs.OrNil(); err != nil {
+		return nil, 0, err
+	}
+	if len(companies) < 1 {
+		return nil, 0, errors.New("Need > 0 companies.")
+	}
+	return companies, nextId, nil
+}
+
+// The CSV file for the companies, with every column, keeping nextId.
+func FormatCompanies(companies []*Company, nextId int) string {
+	var b strings.Builder
+	writer := csv.NewWriter(&b)
+	writer.Write(companyColumns)
+	for _, c := range companies {
+		founded := ""
+		if c.Founded != 0 {
+			founded = strconv.Itoa(c.Founded)
+		}
+		writer.Write([]string{strconv.Itoa(c.Id), c.Name, c.CEO, c.Address1, c.Address2, c.Website, c.Industry, founded})
+	}
+	writer.Flush()
+	b.WriteString(nextIdComment + strconv.Itoa(nextId) + "\n")
+	return b.String()
+}
+
+// The companies in text, the contents of the legacy file_name. Any group
+// with a blank line, or a trailing partial group, is an error rather than
+// shifting every later field.
+func ParseLegacyCompanies(file_name string, text string) ([]*Company, error) {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	errs := &Errors{File: file_name}
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			errs.Add(i+1, "blank %s", []string{"CEO", "name", "address1", "address2"}[i%4])
+		}
+	}
+	if len(lines)%4 != 0 {
+		start := len(lines) - len(lines)%4 + 1
+		errs.Add(start, "incomplete company: %d lines, want 4", len(lines)%4)
+	}
+	if err := errs.OrNil(); err != nil {
+		return nil, err
+	}
+
+	companies := []*Company{}
+	for i := 0; i+3 < len(lines); i += 4 {
+		companies = append(companies, &Company{Id: i/4 + 1, CEO: lines[i], Name: lines[i+1],
+			Address1: lines[i+2], Address2: lines[i+3]})
+	}
+	return companies, nil
+}
+
+// Convert the legacy file from to CSV in to.
+func MigrateCompanies(from string, to string) error {
+	text, err := ioutil.ReadFile(from)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("Cannot read %s or %s: %w", to, from, fs.ErrNotExist)
+	}
+	if err != nil {
+		return errors.New("Cannot read " + to + " or " + from + ".")
+	}
+	companies, err := ParseLegacyCompanies(from, string(text))
+	if err != nil {
+		return err
+	}
+	return writeFile(to, FormatCompanies(companies, len(companies)+1))
+}
+
+// Write to a temporary file and rename it into place, so that a crash
+// mid-write never leaves a truncated file.
+func writeFile(file_name string, text string) error {
+	tmp := file_name + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(text), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file_name)
+}
+
+func contains(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
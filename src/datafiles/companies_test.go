@@ -0,0 +1,90 @@
+package datafiles
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const header = "id,name,ceo,address1,address2,website,industry,founded\n"
+
+func TestParseCompanies(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		want string // the companies and next id, or the error
+	}{
+		{header + "1,Acme,Ann,1 Main St,\"Springfield, IL 62701\",https://acme.example.com,Tools,1950\n",
+			"[1 Acme|Ann|Springfield, IL 62701|Tools|1950] 2"},
+		{"address2,address1,ceo,name,id\nX,1 Main St,Ann,Acme,7\n", "[7 Acme|Ann|X||0] 8"},
+		{header + "# a comment\n2,Acme,Ann,a,b,,,\n# next id: 5\n", "[2 Acme|Ann|b||0] 5"},
+		{header + "9,Acme,Ann,a,b,,,\n# next id: 5\n", "[9 Acme|Ann|b||0] 10"},
+		{header + "1,Acme,Ann,a,b,,,\n# next id: many\n", "f line 3: bad next id \"many\""},
+		{header + "0,Acme,Ann,a,b,,,\n2,Acme,Ann,a,b,,,\n2,Bolt,Bob,a,b,ftp://x,,99\n3,Cog,,a,b,,,\n",
+			"f line 2: bad id \"0\"\nf line 4: id 2 already used on line 3\n" +
+				"f line 4: bad founded year \"99\"\nf line 4: website \"ftp://x\" is not an http(s) URL\nf line 5: no ceo"},
+		{"id,name,ceo,address1,motto\n", "f line 1: unknown column \"motto\"\nf line 1: no \"address2\" column"},
+		{header, "Need > 0 companies."},
+		{"", "f is empty."},
+	} {
+		companies, nextId, err := ParseCompanies("f", c.text)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			list := []string{}
+			for _, co := range companies {
+				list = append(list, fmt.Sprintf("%d %s|%s|%s|%s|%d", co.Id, co.Name, co.CEO, co.Address2, co.Industry, co.Founded))
+			}
+			got = fmt.Sprintf("[%s] %d", strings.Join(list, " "), nextId)
+		}
+		if got != c.want {
+			t.Errorf("%q: got %q, want %q", c.text, got, c.want)
+		}
+	}
+}
+
+// The legacy file is migrated once, numbered in file order, and what is
+// written reads back the same, next id and all.
+func TestLoadCompanies(t *testing.T) {
+	dir := t.TempDir()
+	csvFile, legacy := filepath.Join(dir, "companies.csv"), filepath.Join(dir, "companies.db")
+
+	if _, _, _, err := LoadCompanies(csvFile, legacy); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("neither file: got %v, want a not-exist error", err)
+	}
+
+	ioutil.WriteFile(legacy, []byte("Ann\nAcme, Inc.\n1 Main St\nSpringfield\nBob\nBolt\n2 Elm St\nShelbyville\n"), 0644)
+	companies, nextId, migrated, err := LoadCompanies(csvFile, legacy)
+	if err != nil || !migrated {
+		t.Fatalf("migration: %v, migrated %v", err, migrated)
+	}
+	if len(companies) != 2 || companies[1].Id != 2 || companies[0].Name != "Acme, Inc." || nextId != 3 {
+		t.Errorf("migrated %+v, next id %d", companies, nextId)
+	}
+
+	// The high-water mark outlives the company that set it.
+	ioutil.WriteFile(csvFile, []byte(FormatCompanies(companies[:1], 3)), 0644)
+	os.Remove(legacy)
+	again, nextId, migrated, err := LoadCompanies(csvFile, legacy)
+	if err != nil || migrated {
+		t.Fatalf("reload: %v, migrated %v", err, migrated)
+	}
+	if len(again) != 1 || nextId != 3 {
+		t.Errorf("read back %d companies, next id %d; want 1, 3", len(again), nextId)
+	}
+	for i := range again {
+		if *again[i] != *companies[i] {
+			t.Errorf("read back %+v, want %+v", *again[i], *companies[i])
+		}
+	}
+
+	if _, err := ParseLegacyCompanies("f", "Ann\n\nx\ny\nBob\n"); err == nil ||
+		err.Error() != "f line 2: blank name\nf line 5: incomplete company: 1 lines, want 4" {
+		t.Errorf("bad legacy file: got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Package datafiles reads and writes the text files the demo services
+// share: sayings.db and companies.csv, kept by gorilla-mux and read by rest
+// (sayings.db by sayingsctl too), and gorilla-mux's cliches.db. Every
+// reader goes through here, so that a change to a format reaches all of
+// them at once.
+package datafiles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Every problem found in a file, each with its line number.
+type Errors struct {
+	File     string
+	Problems []string
+}
+
+func (e *Errors) Add(line int, format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf("%s line %d: ", e.File, line)+fmt.Sprintf(format, args...))
+}
+
+func (e *Errors) Error() string {
+	return strings.Join(e.Problems, "\n")
+}
+
+// The errors, or nil if there are none.
+func (e *Errors) OrNil() error {
+	if len(e.Problems) == 0 {
+		return nil
+	}
+	return e
+}
+
+// sayings.db and cliches.db number their records by line: a record's id
+// is its line number, so a deleted record leaves its line blank rather
+// than renumbering the ones after it. A last line "# next id: N", as in
+// companies.csv, is the high-water mark, so that a new record never takes
+// a deleted one's id. A file from before the mark keeps trailing blank
+// lines for it instead, which still count.
+
+// The record lines of a numbered file, and the next id: the mark's, or
+// the line after the last, whichever is higher.
+func numberedLines(text string, errs *Errors) ([]string, int) {
+	all := lines(text)
+	n := len(all)
+	if n == 0 || !strings.HasPrefix(all[n-1], nextIdComment) {
+		return all, n + 1
+	}
+	records, nextId := all[:n-1], n
+	mark, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(all[n-1], nextIdComment)))
+	if err != nil || mark < 1 {
+		errs.Add(n, "bad next id %q", strings.TrimPrefix(all[n-1], nextIdComment))
+	} else if mark > nextId {
+		nextId = mark
+	}
+	return records, nextId
+}
+
+// A numbered file: each record on the line of its id, the ids rising,
+// with blank lines for the ids in between, then the mark.
+func formatNumbered(ids []int, records []string, nextId int) string {
+	var b strings.Builder
+	line := 1
+	for i, id := range ids {
+		for ; line < id; line++ {
+			b.WriteString("\n")
+		}
+		b.WriteString(records[i] + "\n")
+		line++
+	}
+	b.WriteString(nextIdComment + strconv.Itoa(nextId) + "\n")
+	return b.String()
+}
+
+// The file's lines, without the newline that ends the last.
+func lines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,3 @@
+module datafiles
+
+go 1.25.0
@@ -0,0 +1,89 @@
+package datafiles
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// sayings.db holds one saying a line, as Predictor!Prediction, or as
+// Predictor!Prediction!CompanyId for a saying that belongs to a company.
+// The ids are line numbers, and the file ends with the next id (see
+// numberedLines).
+//
+// The predictor may not contain '!'. The prediction may, in which case the
+// company field is written even if it is 0, so that a prediction ending
+// in "!42" is not taken for a company id.
+type Saying struct {
+	Id         int // the line number
+	Predictor  string
+	Prediction string
+	CompanyId  int // 0 for none
+}
+
+// The sayings in text, the contents of file_name, which must hold at
+// least one, and the id for the next. Every bad line is reported.
+func ParseSayings(file_name string, text string) ([]*Saying, int, error) {
+	errs := &Errors{File: file_name}
+	sayings := []*Saying{}
+	all, nextId := numberedLines(text, errs)
+	for i, line := range all {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		s, problem := parseSaying(line)
+		if problem != "" {
+			errs.Add(i+1, "%s", problem)
+			continue
+		}
+		s.Id = i + 1
+		sayings = append(sayings, s)
+	}
+	if err := errs.OrNil(); err != nil {
+		return nil, 0, err
+	}
+	if len(sayings) == 0 {
+		return nil, 0, errors.New(file_name + ": need > 0 sayings.")
+	}
+	return sayings, nextId, nil
+}
+
+func parseSaying(line string) (*Saying, string) {
+	fields := strings.Split(line, "!")
+	if len(fields) < 2 {
+		return nil, "want Predictor!Prediction[!CompanyId]"
+	}
+	s := &Saying{Predictor: strings.TrimSpace(fields[0])}
+	rest := fields[1:]
+	if n := len(rest); n > 1 {
+		if id, err := strconv.Atoi(strings.TrimSpace(rest[n-1])); err == nil {
+			if id < 0 {
+				return nil, "bad company id " + strconv.Quote(rest[n-1])
+			}
+			s.CompanyId, rest = id, rest[:n-1]
+		}
+	}
+	s.Prediction = strings.TrimSpace(strings.Join(rest, "!"))
+	if s.Predictor == "" || s.Prediction == "" {
+		return nil, "want Predictor!Prediction[!CompanyId]"
+	}
+	return s, ""
+}
+
+// The saying's line, without the newline.
+func FormatSaying(s *Saying) string {
+	line := s.Predictor + "!" + s.Prediction
+	if s.CompanyId != 0 || strings.Contains(s.Prediction, "!") {
+		line += "!" + strconv.Itoa(s.CompanyId)
+	}
+	return line
+}
+
+// The file for the sayings, which are in id order below nextId.
+func FormatSayings(sayings []*Saying, nextId int) string {
+	ids, records := []int{}, []string{}
+	for _, s := range sayings {
+		ids, records = append(ids, s.Id), append(records, FormatSaying(s))
+	}
+	return formatNumbered(ids, records, nextId)
+}
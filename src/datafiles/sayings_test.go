@@ -0,0 +1,72 @@
+package datafiles
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseSayings(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		want string // the sayings and next id, or the error
+	}{
+		{"Ann!Soon.\n", "[1 Ann|Soon.|0] 2"},
+		{"Ann!Soon.!3\nBob!Later.", "[1 Ann|Soon.|3 2 Bob|Later.|0] 3"},
+		{"Ann!Soon.\n\n\nBob!Later.!0\n", "[1 Ann|Soon.|0 4 Bob|Later.|0] 5"},
+		{"Ann!Soon.\n\n\n", "[1 Ann|Soon.|0] 4"}, // trailing blank lines, from before the mark
+		{"Ann!Soon.\n\nBob!Later.\n# next id: 7\n", "[1 Ann|Soon.|0 3 Bob|Later.|0] 7"},
+		{"Ann!Soon.\n# next id: 1", "[1 Ann|Soon.|0] 2"},
+		{"Ann!Soon.\n# next id: x\n", "f line 2: bad next id \"x\""},
+		{"# next id: 3\nAnn!Soon.\n", "f line 1: want Predictor!Prediction[!CompanyId]"},
+		{"Ann!Soon!\n", "[1 Ann|Soon!|0] 2"},
+		{"Ann!Wow! 42!0\n", "[1 Ann|Wow! 42|0] 2"},
+		{"Ann!Soon.\nBob\n!Later.\n", "f line 2: want Predictor!Prediction[!CompanyId]\n" +
+			"f line 3: want Predictor!Prediction[!CompanyId]"},
+		{"Ann!Soon.!-1\n", "f line 1: bad company id \"-1\""},
+		{"\n\n", "f: need > 0 sayings."},
+		{"\n# next id: 3\n", "f: need > 0 sayings."},
+	} {
+		sayings, nextId, err := ParseSayings("f", c.text)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			list := []string{}
+			for _, s := range sayings {
+				list = append(list, fmt.Sprintf("%d %s|%s|%d", s.Id, s.Predictor, s.Prediction, s.CompanyId))
+			}
+			got = fmt.Sprintf("[%s] %d", strings.Join(list, " "), nextId)
+		}
+		if got != c.want {
+			t.Errorf("%q: got %q, want %q", c.text, got, c.want)
+		}
+	}
+}
+
+// Whatever is written reads back the same, ids and all, the next id too.
+func TestFormatSayings(t *testing.T) {
+	sayings := []*Saying{
+		{Id: 2, Predictor: "Ann", Prediction: "Soon.", CompanyId: 3},
+		{Id: 3, Predictor: "Bob", Prediction: "Later."},
+		{Id: 5, Predictor: "Cy", Prediction: "Never!42"}}
+	text := FormatSayings(sayings, 7)
+	if want := "\nAnn!Soon.!3\nBob!Later.\n\nCy!Never!42!0\n# next id: 7\n"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+	again, nextId, err := ParseSayings("f", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nextId != 7 {
+		t.Errorf("next id %d, want 7", nextId)
+	}
+	if len(again) != len(sayings) {
+		t.Fatalf("read back %d sayings, want %d", len(again), len(sayings))
+	}
+	for i := range again {
+		if *again[i] != *sayings[i] {
+			t.Errorf("read back %+v, want %+v", *again[i], *sayings[i])
+		}
+	}
+}
@@ -0,0 +1,31 @@
+/*
+ gencert writes a self-signed certificate and key for running the rest
+ and gorilla-mux servers over HTTPS during development:
+
+   gencert -host localhost,127.0.0.1
+   restServe -tls-cert cert.pem -tls-key key.pem
+
+ Rerunning gencert and sending the server a SIGHUP swaps in the new
+ certificate without a restart. Browsers will warn about the certificate,
+ since nobody vouches for it.
+*/
+
+package main
+
+import (
+	"flag"
+	"log"
+	"tlsconf"
+)
+
+func main() {
+	hosts := flag.String("host", "localhost,127.0.0.1", "comma-separated host names and IPs")
+	certFile := flag.String("cert", "cert.pem", "output certificate file")
+	keyFile := flag.String("key", "key.pem", "output private key file")
+	flag.Parse()
+
+	if err := tlsconf.WriteSelfSigned(*hosts, *certFile, *keyFile); err != nil {
+		log.Fatalln(err)
+	}
+	log.Println("Wrote " + *certFile + " and " + *keyFile)
+}
@@ -0,0 +1,3 @@
+module gencert
+
+go 1.25.0
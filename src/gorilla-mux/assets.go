@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/** site files **/
+
+// The templates and static assets are compiled into the binary, so the
+// server needs only its data files beside it. In dev mode (-dev) they are
+// read from the working directory instead, so that edits show up without
+// a rebuild: templates on the next request, assets on a restart.
+//
+//go:embed static templates
+var embeddedFiles embed.FS
+
+var siteFiles fs.FS = embeddedFiles
+
+const staticDir = "static"
+
+/****/
+
+/** static assets **/
+
+// Each file under staticDir is served at /static/ under a name carrying a
+// hash of its content, "site.css" becoming "site.1f2e3d4c5b.css", and may
+// therefore be cached for good: a changed file gets a new name. Templates
+// get that name from the "asset" function (see templateFuncs). The plain
+// name is served too, for anything that cannot know the hash, but must be
+// revalidated.
+const (
+	hashLength      = 10
+	immutableCache  = "public, max-age=31536000, immutable"
+	revalidateCache = "no-cache"
+)
+
+type asset struct {
+	body        []byte
+	gzipped     []byte // nil unless it is worth it
+	contentType string
+	hash        string
+	hashed      string // the fingerprinted name
+}
+
+type AssetStore struct {
+	byName   map[string]*asset // both plain and fingerprinted names
+	byHashed map[string]bool   // which names are fingerprinted
+}
+
+var assets *AssetStore
+
+func newAssetStore(fsys fs.FS) (*AssetStore, error) {
+	s := &AssetStore{byName: map[string]*asset{}, byHashed: map[string]bool{}}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])[:hashLength]
+		ext := path.Ext(name)
+
+		a := &asset{body: body, hash: hash, hashed: strings.TrimSuffix(name, ext) + "." + hash + ext}
+		if a.contentType = mime.TypeByExtension(ext); a.contentType == "" {
+			a.contentType = http.DetectContentType(body)
+		}
+		if compressible(a.contentType) {
+			a.gzipped = gzipped(body)
+		}
+		s.byName[name], s.byName[a.hashed] = a, a
+		s.byHashed[a.hashed] = true
+		return nil
+	})
+	return s, err
+}
+
+// The URL of the asset's fingerprinted name; an unknown name is an error,
+// so that a typo in a template fails the page rather than a later fetch.
+func (s *AssetStore) URL(name string) (string, error) {
+	a, ok := s.byName[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return "", errors.New("no asset " + name)
+	}
+	return "/" + staticDir + "/" + a.hashed, nil
+}
+
+func compressible(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") || strings.Contains(contentType, "javascript") ||
+		strings.Contains(contentType, "json") || strings.Contains(contentType, "xml") ||
+		strings.HasPrefix(contentType, "image/svg")
+}
+
+// The gzipped body, or nil if that saves nothing.
+func gzipped(body []byte) []byte {
+	var b bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&b, gzip.BestCompression)
+	w.Write(body)
+	w.Close()
+	if b.Len() >= len(body) {
+		return nil
+	}
+	return b.Bytes()
+}
+
+// Whether the client takes gzip: listed, and not with q=0.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(part, ";")
+		if strings.TrimSpace(fields[0]) != "gzip" {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				return err == nil && q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// GET /static/{name}
+func StaticH(rw http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/"+staticDir+"/")
+	a, ok := assets.byName[name]
+	if !ok {
+		http.NotFound(rw, r)
+		return
+	}
+
+	header := rw.Header()
+	if assets.byHashed[name] {
+		header.Set("Cache-Control", immutableCache)
+	} else {
+		header.Set("Cache-Control", revalidateCache)
+	}
+	header.Set("Vary", "Accept-Encoding")
+
+	// Each encoding is a different representation, with its own ETag.
+	body, etag := a.body, `"`+a.hash+`"`
+	if a.gzipped != nil && acceptsGzip(r) {
+		body, etag = a.gzipped, `"`+a.hash+`-gzip"`
+		header.Set("Content-Encoding", "gzip")
+	}
+	header.Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == "*" || strings.Contains(match, etag)) {
+		header.Del("Content-Encoding")
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Type", a.contentType)
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	rw.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		rw.Write(body)
+	}
+}
+
+/****/
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// An asset's URL carries the hash of its content, and the pages use it.
+func TestAssetURLs(t *testing.T) {
+	ts := newTestSite(t)
+	for _, name := range []string{"site.css", "home.css", "home.js"} {
+		body, err := fs.ReadFile(embeddedFiles, staticDir+"/"+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(body)
+		dot := strings.LastIndex(name, ".")
+		want := "/static/" + name[:dot] + "." + hex.EncodeToString(sum[:])[:hashLength] + name[dot:]
+
+		for _, asked := range []string{name, "/" + name} {
+			url, err := assets.URL(asked)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect(t, asked, url, want)
+		}
+		_, home := ts.get("/home")
+		if !strings.Contains(home, "'"+want+"'") {
+			t.Errorf("home page: no %s", want)
+		}
+	}
+	if _, err := assets.URL("nonesuch.css"); err == nil {
+		t.Error("nonesuch.css: no error")
+	}
+}
+
+func TestStaticH(t *testing.T) {
+	ts := newTestSite(t)
+	css, _ := fs.ReadFile(embeddedFiles, staticDir+"/site.css")
+	hashed, _ := assets.URL("site.css")
+	hash := assets.byName["site.css"].hash
+	plainTag, gzipTag := `"`+hash+`"`, `"`+hash+`-gzip"`
+
+	for _, c := range []struct {
+		name     string
+		method   string
+		path     string
+		encoding string // Accept-Encoding
+		match    string // If-None-Match
+		want     int
+		cache    string
+		etag     string
+		gzipped  bool
+	}{
+		{"fingerprinted", "GET", hashed, "identity", "", http.StatusOK, immutableCache, plainTag, false},
+		{"gzip", "GET", hashed, "gzip", "", http.StatusOK, immutableCache, gzipTag, true},
+		{"gzip among others", "GET", hashed, "deflate, gzip;q=0.5", "", http.StatusOK, immutableCache, gzipTag, true},
+		{"gzip refused", "GET", hashed, "gzip;q=0", "", http.StatusOK, immutableCache, plainTag, false},
+		{"plain name", "GET", "/static/site.css", "identity", "", http.StatusOK, revalidateCache, plainTag, false},
+		{"plain name, gzip", "GET", "/static/site.css", "gzip", "", http.StatusOK, revalidateCache, gzipTag, true},
+		{"not modified", "GET", "/static/site.css", "identity", plainTag, http.StatusNotModified, revalidateCache, plainTag, false},
+		{"not modified, gzip", "GET", hashed, "gzip", `"other", ` + gzipTag, http.StatusNotModified, immutableCache, gzipTag, false},
+		{"other encoding's tag", "GET", hashed, "identity", gzipTag, http.StatusOK, immutableCache, plainTag, false},
+		{"any tag", "GET", hashed, "identity", "*", http.StatusNotModified, immutableCache, plainTag, false},
+		{"stale tag", "GET", hashed, "identity", `"0000000000"`, http.StatusOK, immutableCache, plainTag, false},
+		{"head", "HEAD", hashed, "identity", "", http.StatusOK, immutableCache, plainTag, false},
+		{"unknown", "GET", "/static/nonesuch.css", "identity", "", http.StatusNotFound, "", "", false},
+		{"wrong hash", "GET", "/static/site.0000000000.css", "identity", "", http.StatusNotFound, "", "", false},
+		{"post", "POST", hashed, "identity", "", http.StatusMethodNotAllowed, "", "", false},
+	} {
+		header := http.Header{"Accept-Encoding": {c.encoding}}
+		if c.match != "" {
+			header.Set("If-None-Match", c.match)
+		}
+		response, body := ts.do(c.method, c.path, nil, header)
+		expectStatus(t, c.name, response, c.want)
+		expect(t, c.name+" Cache-Control", response.Header.Get("Cache-Control"), c.cache)
+		expect(t, c.name+" ETag", response.Header.Get("ETag"), c.etag)
+		if c.want != http.StatusOK {
+			if c.want == http.StatusNotModified && (body != "" || response.Header.Get("Content-Encoding") != "") {
+				t.Errorf("%s: 304 with a body or encoding", c.name)
+			}
+			continue
+		}
+		expect(t, c.name+" Content-Type", response.Header.Get("Content-Type"), "text/css; charset=utf-8")
+		expect(t, c.name+" Vary", response.Header.Get("Vary"), "Accept-Encoding")
+
+		if c.gzipped {
+			expect(t, c.name+" Content-Encoding", response.Header.Get("Content-Encoding"), "gzip")
+			r, err := gzip.NewReader(strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			plain, _ := ioutil.ReadAll(r)
+			if string(plain) != string(css) {
+				t.Errorf("%s: gunzipped body differs", c.name)
+			}
+			continue
+		}
+		expect(t, c.name+" Content-Encoding", response.Header.Get("Content-Encoding"), "")
+		expect(t, c.name+" Content-Length", response.Header.Get("Content-Length"), strconv.Itoa(len(css)))
+		if c.method == "HEAD" {
+			expect(t, c.name+" body", body, "")
+		} else if body != string(css) {
+			t.Errorf("%s: body differs", c.name)
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for _, c := range []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", false},
+		{"deflate, br", false},
+		{"br, gzip", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.0", false},
+		{"gzip;q=0.1", true},
+		{"gzip;q=x", false},
+		{"x-gzip", false},
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", c.header)
+		expect(t, strconv.Quote(c.header), acceptsGzip(r), c.want)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"datafiles"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/** cliche store **/
+
+// The cliches behind /ajax, read from clichesFile at startup and written
+// back after every change. The file's format, ids and all, is in
+// datafiles.ParseCliches; Words is computed rather than stored. As with
+// the sayings (see data.go), a change builds a new map, writes the file
+// from it, and only then swaps it in, so a failed write changes nothing.
+const clichesFile = "cliches.db"
+
+type ClicheStore struct {
+	cliches map[int]*Cliche
+	nextId  int
+	lock    sync.RWMutex
+}
+
+var clicheStore = &ClicheStore{cliches: make(map[int]*Cliche), nextId: 1}
+
+// For clients, whose requests fail with a status and this as the body.
+type jsonError struct {
+	Error string
+}
+
+/****/
+
+/** request handlers **/
+
+// GET /ajax
+// A random cliche, for ajax_call in static/home.js.
+func AjaxH(rw http.ResponseWriter, r *http.Request) {
+	cliche := clicheStore.random()
+	if cliche == nil {
+		sendJSONError(rw, http.StatusNotFound, "No cliches")
+		return
+	}
+	sendJSON(rw, http.StatusOK, cliche)
+
+	log("ajax")
+}
+
+// GET /ajax/{id:[0-9]+}
+func AjaxIdH(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	cliche := clicheStore.read(id)
+	if cliche == nil {
+		sendJSONError(rw, http.StatusNotFound, "No cliche "+strconv.Itoa(id))
+		return
+	}
+	sendJSON(rw, http.StatusOK, cliche)
+
+	log("ajax/" + strconv.Itoa(id))
+}
+
+// GET /cliches
+// Also hands out the CSRF token that POST, PUT and DELETE must send back
+// in the X-CSRF-Token header (see csrfProtectJSON).
+func ClichesH(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set(csrfHeader, csrfToken(rw, r))
+	sendJSON(rw, http.StatusOK, clicheStore.list())
+
+	log("cliches")
+}
+
+// POST /cliches
+// Form values: author and truism.
+func ClicheCreateH(rw http.ResponseWriter, r *http.Request) {
+	author := strings.TrimSpace(r.FormValue("author"))
+	truism := strings.TrimSpace(r.FormValue("truism"))
+	if err := validCliche(author, truism); err != nil {
+		sendJSONError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cliche, err := clicheStore.create(author, truism)
+	if err != nil {
+		sendJSONError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rw.Header().Set("Location", "/ajax/"+strconv.Itoa(cliche.Id))
+	sendJSON(rw, http.StatusCreated, cliche)
+
+	log("clicheCreate")
+}
+
+// PUT /cliches/{id:[0-9]+}
+// Form values: author, truism, or both.
+func ClicheEditH(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	r.ParseForm()
+	_, hasAuthor := r.Form["author"]
+	_, hasTruism := r.Form["truism"]
+	if !hasAuthor && !hasTruism {
+		sendJSONError(rw, http.StatusBadRequest, "Need an author or a truism")
+		return
+	}
+
+	cliche, err := clicheStore.edit(id, strings.TrimSpace(r.FormValue("author")), hasAuthor,
+		strings.TrimSpace(r.FormValue("truism")), hasTruism)
+	_, invalid := err.(invalidCliche)
+	switch {
+	case err == errNoCliche:
+		sendJSONError(rw, http.StatusNotFound, "No cliche "+strconv.Itoa(id))
+	case invalid:
+		sendJSONError(rw, http.StatusBadRequest, err.Error())
+	case err != nil:
+		sendJSONError(rw, http.StatusInternalServerError, err.Error())
+	default:
+		sendJSON(rw, http.StatusOK, cliche)
+	}
+
+	log("clicheEdit/" + strconv.Itoa(id))
+}
+
+// DELETE /cliches/{id:[0-9]+}
+func ClicheDeleteH(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := clicheStore.remove(id); err == errNoCliche {
+		sendJSONError(rw, http.StatusNotFound, "No cliche "+strconv.Itoa(id))
+		return
+	} else if err != nil {
+		sendJSONError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+
+	log("clicheDelete/" + strconv.Itoa(id))
+}
+/****/
+
+/** store methods **/
+
+var errNoCliche = errors.New("no such cliche")
+
+func (cs *ClicheStore) load(file_name string) error {
+	text, err := ioutil.ReadFile(file_name)
+	if err != nil {
+		return errors.New("Cannot read " + file_name + ".")
+	}
+	records, nextId, err := datafiles.ParseCliches(file_name, string(text))
+	if err != nil {
+		return err
+	}
+
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cs.cliches = make(map[int]*Cliche)
+	for _, r := range records {
+		cs.cliches[r.Id] = newCliche(r.Id, r.Author, r.Truism)
+	}
+	cs.nextId = nextId
+	return nil
+}
+
+// Write the file from cliches, then make them the store's. Caller holds
+// the lock.
+func (cs *ClicheStore) commit(cliches map[int]*Cliche, nextId int) error {
+	records := []*datafiles.Cliche{}
+	for id := 1; id < nextId; id++ {
+		if c, ok := cliches[id]; ok {
+			records = append(records, &datafiles.Cliche{Id: id, Author: c.Author, Truism: c.Truism})
+		}
+	}
+	if err := replaceFile(clichesFile, []byte(datafiles.FormatCliches(records, nextId))); err != nil {
+		return err
+	}
+	cs.cliches, cs.nextId = cliches, nextId
+	return nil
+}
+
+// Copies, so that callers never share the stored cliches.
+func (cs *ClicheStore) list() []Cliche {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	list := []Cliche{}
+	for _, cliche := range cs.sorted() {
+		list = append(list, *cliche)
+	}
+	return list
+}
+
+func (cs *ClicheStore) read(id int) *Cliche {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	if cliche, ok := cs.cliches[id]; ok {
+		c := *cliche
+		return &c
+	}
+	return nil
+}
+
+func (cs *ClicheStore) random() *Cliche {
+	list := cs.list()
+	if len(list) == 0 {
+		return nil
+	}
+	return &list[rand.Intn(len(list))]
+}
+
+func (cs *ClicheStore) create(author string, truism string) (*Cliche, error) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cliche := newCliche(cs.nextId, author, truism)
+	if err := cs.commit(cs.replaced(cliche.Id, cliche), cs.nextId+1); err != nil {
+		return nil, err
+	}
+	c := *cliche
+	return &c, nil
+}
+
+// Change whichever of author and truism is given.
+func (cs *ClicheStore) edit(id int, author string, hasAuthor bool, truism string, hasTruism bool) (*Cliche, error) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cliche, ok := cs.cliches[id]
+	if !ok {
+		return nil, errNoCliche
+	}
+	if !hasAuthor {
+		author = cliche.Author
+	}
+	if !hasTruism {
+		truism = cliche.Truism
+	}
+	if err := validCliche(author, truism); err != nil {
+		return nil, err
+	}
+	cliche = newCliche(id, author, truism)
+	if err := cs.commit(cs.replaced(id, cliche), cs.nextId); err != nil {
+		return nil, err
+	}
+	c := *cliche
+	return &c, nil
+}
+
+func (cs *ClicheStore) remove(id int) error {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if _, ok := cs.cliches[id]; !ok {
+		return errNoCliche
+	}
+	return cs.commit(cs.replaced(id, nil), cs.nextId)
+}
+
+// A copy of the map with the cliche of that id replaced, or dropped if c
+// is nil. Caller holds the lock.
+func (cs *ClicheStore) replaced(id int, c *Cliche) map[int]*Cliche {
+	cliches := make(map[int]*Cliche)
+	for oldId, old := range cs.cliches {
+		cliches[oldId] = old
+	}
+	if c != nil {
+		cliches[id] = c
+	} else {
+		delete(cliches, id)
+	}
+	return cliches
+}
+
+// By id. Caller holds the lock.
+func (cs *ClicheStore) sorted() []*Cliche {
+	list := []*Cliche{}
+	for _, cliche := range cs.cliches {
+		list = append(list, cliche)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	return list
+}
+/****/
+
+/** utilities **/
+
+func newCliche(id int, author string, truism string) *Cliche {
+	return &Cliche{Id: id, Truism: truism, Author: author, Words: len(strings.Fields(truism))}
+}
+
+// A cliche the file format cannot hold, which is the client's fault
+// rather than the server's.
+type invalidCliche string
+
+func (e invalidCliche) Error() string { return string(e) }
+
+// Both parts are needed, and neither may break the file format.
+func validCliche(author string, truism string) error {
+	if author == "" || truism == "" {
+		return invalidCliche("Need an author and a truism")
+	}
+	if strings.ContainsAny(author, "!\n") || strings.Contains(truism, "\n") {
+		return invalidCliche("The author may not contain '!', nor either part a newline")
+	}
+	return nil
+}
+
+func sendJSON(rw http.ResponseWriter, status int, v interface{}) {
+	obj, err := json.Marshal(v)
+	if err != nil {
+		notifyAndMaybeDie("error: "+err.Error(), false)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	rw.Write(obj)
+}
+
+func sendJSONError(rw http.ResponseWriter, status int, msg string) {
+	sendJSON(rw, status, jsonError{msg})
+}
+/****/
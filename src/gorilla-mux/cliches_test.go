@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// Ids survive deletions, of the last cliche too, across a restart.
+func TestClicheIds(t *testing.T) {
+	ts := newTestSite(t)
+	header := http.Header{csrfHeader: {ts.token()}}
+
+	for _, id := range []int{3, 8} {
+		response, _ := ts.do("DELETE", "/cliches/"+strconv.Itoa(id), nil, header)
+		expectStatus(t, "delete "+strconv.Itoa(id), response, http.StatusNoContent)
+	}
+	response, _ := ts.do("POST", "/cliches", url.Values{"author": {"Test"}, "truism": {"Ids are forever."}}, header)
+	expectStatus(t, "create", response, http.StatusCreated)
+	expect(t, "new id", response.Header.Get("Location"), "/ajax/9")
+
+	restarted := &ClicheStore{cliches: make(map[int]*Cliche), nextId: 1}
+	if err := restarted.load(clichesFile); err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, c := range restarted.list() {
+		ids = append(ids, c.Id)
+	}
+	expect(t, "ids after restart", ids, []int{1, 2, 4, 5, 6, 7, 9})
+	expect(t, "truism 4", restarted.read(4).Truism, clicheStore.read(4).Truism)
+	expect(t, "next id", restarted.nextId, 10)
+}
+
+// A change the file cannot take is not made at all.
+func TestClicheWriteFailure(t *testing.T) {
+	ts := newTestSite(t)
+	header := http.Header{csrfHeader: {ts.token()}}
+	before := clicheStore.list()
+	if err := os.Mkdir(clichesFile+".tmp", 0755); err != nil { // so the write fails
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		method string
+		path   string
+	}{
+		{"POST", "/cliches"},
+		{"PUT", "/cliches/1"},
+		{"DELETE", "/cliches/2"},
+	} {
+		response, _ := ts.do(c.method, c.path, url.Values{"author": {"Test"}, "truism": {"Writes can fail."}}, header)
+		expectStatus(t, c.method+" "+c.path, response, http.StatusInternalServerError)
+	}
+	expect(t, "cliches", clicheStore.list(), before)
+	expect(t, "next id", clicheStore.nextId, 9)
+}
+
+// Changes need the token from the cookie in the header; reads do not.
+func TestClicheCSRF(t *testing.T) {
+	ts := newTestSite(t)
+	response, _ := ts.get("/cliches")
+	expectStatus(t, "list", response, http.StatusOK)
+	token := response.Header.Get(csrfHeader)
+	expect(t, "token handed out", token, ts.token())
+
+	form := url.Values{"author": {"Test"}, "truism": {"Tokens are required."}}
+	for _, c := range []struct {
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"POST", "/cliches", "", http.StatusForbidden},
+		{"POST", "/cliches", "forged", http.StatusForbidden},
+		{"PUT", "/cliches/1", "", http.StatusForbidden},
+		{"DELETE", "/cliches/1", "forged", http.StatusForbidden},
+		{"GET", "/ajax/1", "", http.StatusOK},
+		{"PUT", "/cliches/1", token, http.StatusOK},
+		{"POST", "/cliches", token, http.StatusCreated},
+		{"DELETE", "/cliches/2", token, http.StatusNoContent},
+	} {
+		header := http.Header{}
+		if c.token != "" {
+			header.Set(csrfHeader, c.token)
+		}
+		response, body := ts.do(c.method, c.path, form, header)
+		expectStatus(t, c.method+" "+c.path+" ("+body+")", response, c.want)
+	}
+	expect(t, "cliches", len(clicheStore.list()), 8)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"datafiles"
+)
+
+/** companies file **/
+
+// Companies live in companiesFile, in the CSV format of
+// datafiles.ParseCompanies, which rest reads too. The ids are what
+// sayings.db refers to.
+//
+// The old companies.db, groups of four lines with no ids, is migrated to
+// companiesFile on startup if there is no companiesFile yet; it numbers
+// the companies from 1 in file order, as before.
+const (
+	companiesFile   = "companies.csv"
+	legacyCompanies = "companies.db"
+)
+
+// Read the companies, and the next id, first migrating the legacy file if
+// need be.
+func loadCompanies() ([]*Company, int, error) {
+	records, nextId, migrated, err := datafiles.LoadCompanies(companiesFile, legacyCompanies)
+	if migrated {
+		log("Migrated " + legacyCompanies + " to " + companiesFile + ".")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	companies := []*Company{}
+	for _, r := range records {
+		companies = append(companies, &Company{Id: r.Id, CEO: r.CEO, Name: r.Name, Address1: r.Address1,
+			Address2: r.Address2, Website: r.Website, Industry: r.Industry, Founded: r.Founded})
+	}
+	return companies, nextId, nil
+}
+
+/****/
+
+func contains(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
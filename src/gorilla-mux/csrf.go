@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+/** CSRF protection **/
+
+// Double-submit tokens: each browser gets a random token in a cookie, and
+// every form carries the same token in a hidden field. Another site can
+// make a browser POST here, cookie and all, but cannot read the cookie to
+// put the token in the form. Clients of the JSON API send the token in a
+// header instead.
+const (
+	csrfCookie = "csrf_token"
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// The browser's token, issuing one if it has none.
+func csrfToken(rw http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && len(cookie.Value) >= 32 {
+		return cookie.Value
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // no randomness: nothing sensible to do
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(rw, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode})
+	return token
+}
+
+// Whether the header's or else the form's token matches the cookie's.
+func csrfValid(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	token := r.Header.Get(csrfHeader)
+	if token == "" {
+		token = r.PostFormValue(csrfField)
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) == 1
+}
+
+// Whether the method changes anything, and so needs a token.
+func csrfUnsafe(r *http.Request) bool {
+	return r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+}
+
+// Wrap a form handler: a POST with a missing or wrong token is refused.
+// The form is parsed first, since the handlers read r.PostForm, which a
+// token sent in the header would otherwise leave empty.
+func csrfProtect(handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			renderError(rw, http.StatusBadRequest, "Bad form: "+err.Error())
+			return
+		}
+		if csrfUnsafe(r) && !csrfValid(r) {
+			renderError(rw, http.StatusForbidden, "The form has expired or did not come from this site. Please go back, reload it and try again.")
+			return
+		}
+		handler(rw, r)
+	}
+}
+
+// Wrap a JSON API handler likewise, refusing with a JSON error.
+func csrfProtectJSON(handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if csrfUnsafe(r) && !csrfValid(r) {
+			sendJSONError(rw, http.StatusForbidden, "Missing or wrong "+csrfHeader)
+			return
+		}
+		handler(rw, r)
+	}
+}
+/****/
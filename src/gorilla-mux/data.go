@@ -0,0 +1,248 @@
+package main
+
+import (
+	"datafiles"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/** changes to the data **/
+
+// Every change builds new lists from copies, writes the data file from
+// them, and only then swaps them in, so a failed write changes nothing and
+// readers never see a record half-edited. Callers hold dataLock.
+//
+// A saying's id is its line number in sayings.db, so a deleted saying
+// leaves its line blank rather than renumbering the ones after it. New
+// records take the next ids, nextSayingId and nextCompanyId, which are
+// saved with the data (see datafiles), so that no id is ever reused.
+
+const sayingsFile = "sayings.db"
+
+// Problems with a form's fields, by field name, for the form to show.
+type fieldErrors map[string]string
+
+func (fe fieldErrors) orNil() error {
+	if len(fe) == 0 {
+		return nil
+	}
+	return fe
+}
+
+func (fe fieldErrors) Error() string {
+	names := []string{}
+	for name := range fe {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := []string{}
+	for _, name := range names {
+		msgs = append(msgs, name+": "+fe[name])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Check a saying's fields, trimmed, against the file format and the
+// companies. Returns the saying to store.
+func validSaying(id int, form url.Values) (*Saying, error) {
+	errs := fieldErrors{}
+	s := &Saying{Id: id,
+		Predictor:  strings.TrimSpace(form.Get("predictor")),
+		Prediction: strings.TrimSpace(form.Get("prediction"))}
+	for name, value := range map[string]string{"predictor": s.Predictor, "prediction": s.Prediction} {
+		if value == "" {
+			errs[name] = "Required."
+		} else if strings.ContainsAny(value, "!\r\n") {
+			errs[name] = "May not contain '!' or line breaks."
+		}
+	}
+	if n := strings.TrimSpace(form.Get("company")); n != "" && n != "0" {
+		var err error
+		s.Company_id, err = strconv.Atoi(n)
+		if _, ok := companiesById[s.Company_id]; err != nil || !ok {
+			errs["company"] = "No such company."
+		}
+	}
+	return s, errs.orNil()
+}
+
+// Check a company's fields as the loader would. Returns the company to store.
+func validCompany(id int, form url.Values) (*Company, error) {
+	errs := fieldErrors{}
+	field := func(name string) string {
+		value := strings.TrimSpace(form.Get(name))
+		if strings.ContainsAny(value, "\r\n") {
+			errs[name] = "May not contain line breaks."
+		}
+		return value
+	}
+	c := &Company{Id: id, Name: field("name"), CEO: field("ceo"), Address1: field("address1"),
+		Address2: field("address2"), Website: field("website"), Industry: field("industry")}
+	for name, value := range map[string]string{"name": c.Name, "ceo": c.CEO, "address1": c.Address1, "address2": c.Address2} {
+		if value == "" {
+			errs[name] = "Required."
+		}
+	}
+	if founded := field("founded"); founded != "" {
+		var err error
+		c.Founded, err = strconv.Atoi(founded)
+		if err != nil || c.Founded < 1000 || c.Founded > time.Now().Year() {
+			errs["founded"] = fmt.Sprintf("Want a year from 1000 to %d.", time.Now().Year())
+		}
+	}
+	if c.Website != "" && !strings.HasPrefix(c.Website, "http://") && !strings.HasPrefix(c.Website, "https://") {
+		errs["website"] = "Want an http:// or https:// URL."
+	}
+	return c, errs.orNil()
+}
+
+func createSaying(form url.Values) (*Saying, error) {
+	s, err := validSaying(nextSayingId, form)
+	if err != nil {
+		return nil, err
+	}
+	return s, commitSayings(append(append([]*Saying{}, sayingsList...), s), nextSayingId+1)
+}
+
+func editSaying(id int, form url.Values) (*Saying, error) {
+	s, err := validSaying(id, form)
+	if err != nil {
+		return nil, err
+	}
+	return s, commitSayings(replaceSaying(id, s), nextSayingId)
+}
+
+func deleteSaying(id int) error {
+	return commitSayings(replaceSaying(id, nil), nextSayingId)
+}
+
+func createCompany(form url.Values) (*Company, error) {
+	c, err := validCompany(nextCompanyId, form)
+	if err != nil {
+		return nil, err
+	}
+	return c, commitCompanies(append(append([]*Company{}, companiesList...), c), nextCompanyId+1)
+}
+
+func editCompany(id int, form url.Values) (*Company, error) {
+	c, err := validCompany(id, form)
+	if err != nil {
+		return nil, err
+	}
+	return c, commitCompanies(replaceCompany(id, c), nextCompanyId)
+}
+
+func deleteCompany(id int) error {
+	if err := canDeleteCompany(id); err != nil {
+		return err
+	}
+	return commitCompanies(replaceCompany(id, nil), nextCompanyId)
+}
+
+// A company with predictions cannot go: they would point at nothing. Nor
+// can the last one, as the server needs at least one to start.
+func canDeleteCompany(id int) error {
+	if n := len(sayingsByCompany[id]); n > 0 {
+		return fmt.Errorf("%s still has %d prediction%s.", companiesById[id].Name, n, plural(n))
+	}
+	if len(companiesList) == 1 {
+		return errors.New("The last company cannot be deleted.")
+	}
+	return nil
+}
+
+/****/
+
+/** persistence **/
+
+func commitSayings(sayings []*Saying, nextId int) error {
+	if err := writeSayings(sayingsFile, sayings, nextId); err != nil {
+		return err
+	}
+	sayingsList, nextSayingId = sayings, nextId
+	indexData()
+	return nil
+}
+
+func commitCompanies(companies []*Company, nextId int) error {
+	if err := writeCompanies(companiesFile, companies, nextId); err != nil {
+		return err
+	}
+	companiesList, nextCompanyId = companies, nextId
+	indexData()
+	return nil
+}
+
+func writeSayings(file_name string, sayings []*Saying, nextId int) error {
+	records := []*datafiles.Saying{}
+	for _, s := range sayings {
+		records = append(records, &datafiles.Saying{Id: s.Id, Predictor: s.Predictor,
+			Prediction: s.Prediction, CompanyId: s.Company_id})
+	}
+	return replaceFile(file_name, []byte(datafiles.FormatSayings(records, nextId)))
+}
+
+func writeCompanies(file_name string, companies []*Company, nextId int) error {
+	records := []*datafiles.Company{}
+	for _, c := range companies {
+		records = append(records, &datafiles.Company{Id: c.Id, CEO: c.CEO, Name: c.Name, Address1: c.Address1,
+			Address2: c.Address2, Website: c.Website, Industry: c.Industry, Founded: c.Founded})
+	}
+	return replaceFile(file_name, []byte(datafiles.FormatCompanies(records, nextId)))
+}
+
+// Write to a temporary file and rename it into place, so that a crash
+// mid-write never leaves a truncated file.
+func replaceFile(file_name string, doc []byte) error {
+	tmp := file_name + ".tmp"
+	if err := ioutil.WriteFile(tmp, doc, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file_name)
+}
+
+/****/
+
+/** helpers **/
+
+// A copy of the list with the saying of that id replaced, or dropped if s
+// is nil.
+func replaceSaying(id int, s *Saying) []*Saying {
+	sayings := []*Saying{}
+	for _, old := range sayingsList {
+		if old.Id != id {
+			sayings = append(sayings, old)
+		} else if s != nil {
+			sayings = append(sayings, s)
+		}
+	}
+	return sayings
+}
+
+func replaceCompany(id int, c *Company) []*Company {
+	companies := []*Company{}
+	for _, old := range companiesList {
+		if old.Id != id {
+			companies = append(companies, old)
+		} else if c != nil {
+			companies = append(companies, c)
+		}
+	}
+	return companies
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+/****/
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+/** form pages **/
+
+// The data for saying_form.html and company_form.html. Values holds what
+// the form shows: the record's fields, or what was submitted when it comes
+// back with Errors.
+type FormPage struct {
+	Title        string
+	Action       string
+	DeleteAction string // "" on a form for a new record
+	Values       url.Values
+	Errors       fieldErrors
+	Message      string // a problem with the form as a whole
+	Companies    []*Company
+	CSRF         string
+}
+
+func sayingValues(s *Saying) url.Values {
+	return url.Values{"predictor": {s.Predictor}, "prediction": {s.Prediction},
+		"company": {strconv.Itoa(s.Company_id)}}
+}
+
+func companyValues(c *Company) url.Values {
+	founded := ""
+	if c.Founded != 0 {
+		founded = strconv.Itoa(c.Founded)
+	}
+	return url.Values{"name": {c.Name}, "ceo": {c.CEO}, "address1": {c.Address1}, "address2": {c.Address2},
+		"website": {c.Website}, "industry": {c.Industry}, "founded": {founded}}
+}
+
+// One text input of a form, for the "field" partial.
+type formField struct {
+	Name  string
+	Label string
+	Page  *FormPage
+}
+
+func newFormField(name string, label string, page *FormPage) *formField {
+	return &formField{Name: name, Label: label, Page: page}
+}
+
+// Show the form again, with what went wrong, keeping what was typed.
+func renderForm(rw http.ResponseWriter, r *http.Request, name string, page *FormPage, err error) {
+	status := http.StatusOK
+	if fe, ok := err.(fieldErrors); ok {
+		page.Errors, status = fe, http.StatusUnprocessableEntity
+	} else if err != nil {
+		page.Message, status = err.Error(), http.StatusConflict
+	}
+	page.CSRF = csrfToken(rw, r)
+	page.Companies = companiesList
+	templates.render(rw, status, name, page)
+}
+
+// A failure to save is the server's fault, not the form's.
+func saveFailed(err error) bool {
+	_, invalid := err.(fieldErrors)
+	return err != nil && !invalid
+}
+/****/
+
+/** saying handlers **/
+
+// GET|POST /predictions/new
+func SayingNewH(rw http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	page := &FormPage{Title: "New prediction", Action: "/predictions/new", Values: url.Values{}}
+	if r.Method == http.MethodGet {
+		renderForm(rw, r, "saying_form.html", page, nil)
+		return
+	}
+
+	s, err := createSaying(r.PostForm)
+	if saveFailed(err) {
+		renderError(rw, http.StatusInternalServerError, "Cannot save: "+err.Error())
+		return
+	}
+	if err != nil {
+		page.Values = r.PostForm
+		renderForm(rw, r, "saying_form.html", page, err)
+		return
+	}
+	http.Redirect(rw, r, "/predictions/"+strconv.Itoa(s.Id), http.StatusSeeOther)
+
+	log("predictions/new " + strconv.Itoa(s.Id))
+}
+
+// GET|POST /predictions/{id:[0-9]+}/edit
+func SayingEditH(rw http.ResponseWriter, r *http.Request) {
+	n := mux.Vars(r)["id"]
+	id, _ := strconv.Atoi(n)
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	saying, ok := sayingsById[id]
+	if !ok {
+		renderError(rw, http.StatusNotFound, "No prediction "+n+".")
+		return
+	}
+	page := &FormPage{Title: "Edit prediction " + n, Action: "/predictions/" + n + "/edit",
+		DeleteAction: "/predictions/" + n + "/delete", Values: sayingValues(saying)}
+	if r.Method == http.MethodGet {
+		renderForm(rw, r, "saying_form.html", page, nil)
+		return
+	}
+
+	_, err := editSaying(id, r.PostForm)
+	if saveFailed(err) {
+		renderError(rw, http.StatusInternalServerError, "Cannot save: "+err.Error())
+		return
+	}
+	if err != nil {
+		page.Values = r.PostForm
+		renderForm(rw, r, "saying_form.html", page, err)
+		return
+	}
+	http.Redirect(rw, r, "/predictions/"+n, http.StatusSeeOther)
+
+	log("predictions/" + n + "/edit")
+}
+
+// POST /predictions/{id:[0-9]+}/delete
+func SayingDeleteH(rw http.ResponseWriter, r *http.Request) {
+	n := mux.Vars(r)["id"]
+	id, _ := strconv.Atoi(n)
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	if _, ok := sayingsById[id]; !ok {
+		renderError(rw, http.StatusNotFound, "No prediction "+n+".")
+		return
+	}
+	if err := deleteSaying(id); err != nil {
+		renderError(rw, http.StatusInternalServerError, "Cannot save: "+err.Error())
+		return
+	}
+	http.Redirect(rw, r, "/home", http.StatusSeeOther)
+
+	log("predictions/" + n + "/delete")
+}
+/****/
+
+/** company handlers **/
+
+// GET|POST /companies/new
+func CompanyNewH(rw http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	page := &FormPage{Title: "New company", Action: "/companies/new", Values: url.Values{}}
+	if r.Method == http.MethodGet {
+		renderForm(rw, r, "company_form.html", page, nil)
+		return
+	}
+
+	c, err := createCompany(r.PostForm)
+	if saveFailed(err) {
+		renderError(rw, http.StatusInternalServerError, "Cannot save: "+err.Error())
+		return
+	}
+	if err != nil {
+		page.Values = r.PostForm
+		renderForm(rw, r, "company_form.html", page, err)
+		return
+	}
+	http.Redirect(rw, r, "/companies/"+strconv.Itoa(c.Id), http.StatusSeeOther)
+
+	log("companies/new " + strconv.Itoa(c.Id))
+}
+
+// GET|POST /companies/{id:[0-9]+}/edit
+func CompanyEditH(rw http.ResponseWriter, r *http.Request) {
+	n := mux.Vars(r)["id"]
+	id, _ := strconv.Atoi(n)
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	company, ok := companiesById[id]
+	if !ok {
+		renderError(rw, http.StatusNotFound, "No company "+n+".")
+		return
+	}
+	page := &FormPage{Title: "Edit " + company.Name, Action: "/companies/" + n + "/edit",
+		DeleteAction: "/companies/" + n + "/delete", Values: companyValues(company)}
+	if r.Method == http.MethodGet {
+		renderForm(rw, r, "company_form.html", page, nil)
+		return
+	}
+
+	_, err := editCompany(id, r.PostForm)
+	if saveFailed(err) {
+		renderError(rw, http.StatusInternalServerError, "Cannot save: "+err.Error())
+		return
+	}
+	if err != nil {
+		page.Values = r.PostForm
+		renderForm(rw, r, "company_form.html", page, err)
+		return
+	}
+	http.Redirect(rw, r, "/companies/"+n, http.StatusSeeOther)
+
+	log("companies/" + n + "/edit")
+}
+
+// POST /companies/{id:[0-9]+}/delete
+// Refused, back on the edit form, while the company has predictions.
+func CompanyDeleteH(rw http.ResponseWriter, r *http.Request) {
+	n := mux.Vars(r)["id"]
+	id, _ := strconv.Atoi(n)
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	company, ok := companiesById[id]
+	if !ok {
+		renderError(rw, http.StatusNotFound, "No company "+n+".")
+		return
+	}
+	if err := canDeleteCompany(id); err != nil {
+		page := &FormPage{Title: "Edit " + company.Name, Action: "/companies/" + n + "/edit",
+			DeleteAction: "/companies/" + n + "/delete", Values: companyValues(company)}
+		renderForm(rw, r, "company_form.html", page, err)
+		return
+	}
+	if err := deleteCompany(id); err != nil {
+		renderError(rw, http.StatusInternalServerError, "Cannot save: "+err.Error())
+		return
+	}
+	http.Redirect(rw, r, "/home", http.StatusSeeOther)
+
+	log("companies/" + n + "/delete")
+}
+/****/
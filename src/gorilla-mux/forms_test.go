@@ -0,0 +1,197 @@
+package main
+
+import (
+	"datafiles"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// A deleted record's id, even the highest, is never handed out again, and
+// the data files keep that across a restart.
+func TestIdsNotReused(t *testing.T) {
+	ts := newTestSite(t)
+	saying := url.Values{"predictor": {"Test"}, "prediction": {"Ids are forever."}}
+	company := url.Values{"name": {"Test Inc."}, "ceo": {"Test"}, "address1": {"1 Main St"},
+		"address2": {"Springfield, IL 62701"}}
+
+	response, _ := ts.post("/predictions/16/delete", nil)
+	expectStatus(t, "delete saying", response, http.StatusSeeOther)
+	response, _ = ts.post("/predictions/new", saying)
+	expect(t, "new saying", response.Header.Get("Location"), "/predictions/17")
+
+	response, _ = ts.post("/companies/16/delete", nil)
+	expectStatus(t, "delete company", response, http.StatusSeeOther)
+	response, _ = ts.post("/companies/new", company)
+	expect(t, "new company", response.Header.Get("Location"), "/companies/17")
+
+	response, _ = ts.post("/predictions/17/delete", nil)
+	expectStatus(t, "delete new saying", response, http.StatusSeeOther)
+	response, _ = ts.post("/companies/17/delete", nil)
+	expectStatus(t, "delete new company", response, http.StatusSeeOther)
+
+	dataLock.Lock()
+	readData()
+	indexData()
+	dataLock.Unlock()
+	expect(t, "next saying id after restart", nextSayingId, 18)
+	expect(t, "next company id after restart", nextCompanyId, 18)
+	expect(t, "sayings after restart", len(sayingsList), 15)
+	expect(t, "companies after restart", len(companiesList), 15)
+}
+
+// Each change lands in the data file; a bad form comes back with its
+// values and the problems marked.
+func TestSayingForms(t *testing.T) {
+	ts := newTestSite(t)
+	for _, c := range []struct {
+		path     string
+		form     url.Values
+		want     int
+		location string
+		has      string // in the page sent back
+	}{
+		{"/predictions/new", url.Values{"predictor": {"Test"}, "prediction": {"Forms will work."}, "company": {"2"}},
+			http.StatusSeeOther, "/predictions/17", ""},
+		{"/predictions/new", url.Values{"predictor": {"Test"}}, http.StatusUnprocessableEntity, "", "Required."},
+		{"/predictions/new", url.Values{"predictor": {"Te!st"}, "prediction": {"Kept."}},
+			http.StatusUnprocessableEntity, "", "May not contain"},
+		{"/predictions/new", url.Values{"predictor": {"Test"}, "prediction": {"Kept."}, "company": {"99"}},
+			http.StatusUnprocessableEntity, "", "No such company."},
+		{"/predictions/1/edit", url.Values{"predictor": {"Test"}, "prediction": {"Edited."}},
+			http.StatusSeeOther, "/predictions/1", ""},
+		{"/predictions/2/edit", url.Values{"predictor": {"Test"}, "prediction": {""}},
+			http.StatusUnprocessableEntity, "", "value = 'Test'"},
+		{"/predictions/99/edit", url.Values{"predictor": {"Test"}, "prediction": {"Lost."}}, http.StatusNotFound, "", "No prediction 99."},
+		{"/predictions/3/delete", nil, http.StatusSeeOther, "/home", ""},
+		{"/predictions/3/delete", nil, http.StatusNotFound, "", "No prediction 3."},
+	} {
+		response, body := ts.post(c.path, c.form)
+		expectStatus(t, c.path+" "+c.form.Encode(), response, c.want)
+		expect(t, c.path+" location", response.Header.Get("Location"), c.location)
+		if !strings.Contains(body, c.has) {
+			t.Errorf("%s: no %q in %s", c.path, c.has, body)
+		}
+	}
+
+	lines := strings.Split(readTestFile(t, sayingsFile), "\n")
+	expect(t, "line 1", lines[0], "Test!Edited.")
+	expect(t, "line 2", lines[1], sayingsById[2].Predictor+"!"+sayingsById[2].Prediction+"!2")
+	expect(t, "line 3", lines[2], "")
+	expect(t, "line 17", lines[16], "Test!Forms will work.!2")
+}
+
+func TestCompanyForms(t *testing.T) {
+	ts := newTestSite(t)
+	company := func(fields ...string) url.Values {
+		form := url.Values{"name": {"Test Inc."}, "ceo": {"Test"}, "address1": {"1 Main St"},
+			"address2": {"Springfield, IL 62701"}}
+		for i := 0; i+1 < len(fields); i += 2 {
+			form.Set(fields[i], fields[i+1])
+		}
+		return form
+	}
+	for _, c := range []struct {
+		path     string
+		form     url.Values
+		want     int
+		location string
+		has      string // in the page sent back
+	}{
+		{"/companies/new", company("founded", "1999", "website", "https://test.example.com"),
+			http.StatusSeeOther, "/companies/17", ""},
+		{"/companies/new", company("ceo", ""), http.StatusUnprocessableEntity, "", "Required."},
+		{"/companies/new", company("founded", "999"), http.StatusUnprocessableEntity, "", "Want a year from 1000"},
+		{"/companies/new", company("website", "ftp://test"), http.StatusUnprocessableEntity, "", "Want an http:// or https:// URL."},
+		{"/companies/1/edit", company("name", "Renamed Inc."), http.StatusSeeOther, "/companies/1", ""},
+		{"/companies/99/edit", company(), http.StatusNotFound, "", "No company 99."},
+		{"/companies/2/delete", nil, http.StatusConflict, "", "still has 1 prediction."},
+		{"/companies/17/delete", nil, http.StatusSeeOther, "/home", ""},
+		{"/companies/17/delete", nil, http.StatusNotFound, "", "No company 17."},
+	} {
+		response, body := ts.post(c.path, c.form)
+		expectStatus(t, c.path+" "+c.form.Encode(), response, c.want)
+		expect(t, c.path+" location", response.Header.Get("Location"), c.location)
+		if !strings.Contains(body, c.has) {
+			t.Errorf("%s: no %q in %s", c.path, c.has, body)
+		}
+	}
+
+	companies, _, err := datafiles.ParseCompanies(companiesFile, readTestFile(t, companiesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[int]string{}
+	for _, c := range companies {
+		names[c.Id] = c.Name
+	}
+	expect(t, "companies saved", len(companies), 16)
+	expect(t, "renamed", names[1], "Renamed Inc.")
+	expect(t, "deleted", names[17], "")
+}
+
+// Every form refuses a POST without the token from the browser's cookie,
+// and changes nothing.
+func TestFormCSRF(t *testing.T) {
+	ts := newTestSite(t)
+	before := readTestFile(t, sayingsFile) + readTestFile(t, companiesFile)
+
+	response, body := ts.get("/predictions/new")
+	if token := ts.token(); !strings.Contains(body, "value = '"+token+"'") {
+		t.Errorf("form without the token %s: %s", token, body)
+	}
+	expectStatus(t, "form", response, http.StatusOK)
+
+	form := url.Values{"predictor": {"Test"}, "prediction": {"Forged."}, "name": {"Forged Inc."},
+		"ceo": {"Test"}, "address1": {"1 Main St"}, "address2": {"Springfield, IL 62701"}}
+	for _, path := range []string{"/predictions/new", "/predictions/1/edit", "/predictions/1/delete",
+		"/companies/new", "/companies/1/edit", "/companies/14/delete"} {
+		for _, token := range []string{"", "forged"} {
+			form.Set(csrfField, token)
+			response, body := ts.do("POST", path, form, nil)
+			expectStatus(t, path+" token "+token, response, http.StatusForbidden)
+			if !strings.Contains(body, "The form has expired") {
+				t.Errorf("%s: %s", path, body)
+			}
+		}
+	}
+	// Nor does the token alone do, without the cookie.
+	token := ts.token()
+	ts.Client().Jar, _ = cookiejar.New(nil)
+	form.Set(csrfField, token)
+	response, _ = ts.do("POST", "/predictions/new", form, nil)
+	expectStatus(t, "no cookie", response, http.StatusForbidden)
+
+	expect(t, "data files unchanged", readTestFile(t, sayingsFile)+readTestFile(t, companiesFile), before)
+}
+
+// A token in the header does as well as one in the form, and the form's
+// values still arrive.
+func TestFormCSRFHeader(t *testing.T) {
+	ts := newTestSite(t)
+	header := http.Header{csrfHeader: {ts.token()}}
+	form := url.Values{"predictor": {"Test"}, "prediction": {"Headers will do."}}
+	response, body := ts.do("POST", "/predictions/new", form, header)
+	expectStatus(t, "create ("+body+")", response, http.StatusSeeOther)
+	expect(t, "location", response.Header.Get("Location"), "/predictions/17")
+	expect(t, "saved", strings.Split(readTestFile(t, sayingsFile), "\n")[16], "Test!Headers will do.")
+
+	response, body = ts.do("POST", "/predictions/17/edit", url.Values{"predictor": {"Test"}, "prediction": {""}}, header)
+	expectStatus(t, "invalid edit", response, http.StatusUnprocessableEntity)
+	if !strings.Contains(body, "value = 'Test'") {
+		t.Errorf("invalid edit: values not kept: %s", body)
+	}
+}
+
+// A file in the test's working directory.
+func readTestFile(t *testing.T, file_name string) string {
+	t.Helper()
+	doc, err := ioutil.ReadFile(file_name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(doc)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"datafiles"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/** locations **/
+
+// A company's city, state and ZIP, parsed from its address lines: the
+// first of Address2 and Address1 of the form "City, ST 12345" or
+// "City, ST 12345-6789" with a known state code. Nothing is parsed from
+// an address in any other form; such a company has no state.
+type Location struct {
+	City  string
+	State string // two-letter code, upper case; "" if not parsed
+	Zip   string // the five-digit ZIP
+	Zip4  string // "" if none
+}
+
+var addressPattern = regexp.MustCompile(`^\s*(.+?),\s*([A-Za-z]{2})\s+(\d{5})(?:-(\d{4}))?\s*$`)
+
+func parseLocation(lines ...string) Location {
+	for _, line := range lines {
+		m := addressPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		code := strings.ToUpper(m[2])
+		if _, ok := states[code]; ok {
+			return Location{City: m[1], State: code, Zip: m[3], Zip4: m[4]}
+		}
+	}
+	return Location{}
+}
+
+func (c *Company) Location() Location {
+	return parseLocation(c.Address2, c.Address1)
+}
+
+// The state's name, or "" if unknown.
+func (l Location) StateName() string {
+	return states[l.State].Name
+}
+
+type stateInfo struct {
+	Name     string
+	Lat, Lon float64 // approximate geographic centre
+}
+
+// The states, DC and the territories, by USPS code.
+var states = map[string]stateInfo{
+	"AL": {"Alabama", 32.8, -86.8}, "AK": {"Alaska", 64.2, -152.5},
+	"AZ": {"Arizona", 34.3, -111.7}, "AR": {"Arkansas", 34.9, -92.4},
+	"CA": {"California", 37.2, -119.5}, "CO": {"Colorado", 39.0, -105.5},
+	"CT": {"Connecticut", 41.6, -72.7}, "DE": {"Delaware", 39.0, -75.5},
+	"DC": {"District of Columbia", 38.9, -77.0}, "FL": {"Florida", 28.6, -82.4},
+	"GA": {"Georgia", 32.7, -83.4}, "HI": {"Hawaii", 20.8, -156.3},
+	"ID": {"Idaho", 44.4, -114.6}, "IL": {"Illinois", 40.0, -89.2},
+	"IN": {"Indiana", 39.9, -86.3}, "IA": {"Iowa", 42.1, -93.5},
+	"KS": {"Kansas", 38.5, -98.4}, "KY": {"Kentucky", 37.5, -85.3},
+	"LA": {"Louisiana", 31.1, -92.0}, "ME": {"Maine", 45.4, -69.2},
+	"MD": {"Maryland", 39.0, -76.8}, "MA": {"Massachusetts", 42.3, -71.8},
+	"MI": {"Michigan", 44.3, -85.4}, "MN": {"Minnesota", 46.3, -94.3},
+	"MS": {"Mississippi", 32.7, -89.7}, "MO": {"Missouri", 38.4, -92.5},
+	"MT": {"Montana", 47.0, -109.6}, "NE": {"Nebraska", 41.5, -99.8},
+	"NV": {"Nevada", 39.3, -116.6}, "NH": {"New Hampshire", 43.7, -71.6},
+	"NJ": {"New Jersey", 40.2, -74.7}, "NM": {"New Mexico", 34.4, -106.1},
+	"NY": {"New York", 42.9, -75.5}, "NC": {"North Carolina", 35.6, -79.4},
+	"ND": {"North Dakota", 47.5, -100.5}, "OH": {"Ohio", 40.3, -82.8},
+	"OK": {"Oklahoma", 35.6, -97.5}, "OR": {"Oregon", 43.9, -120.6},
+	"PA": {"Pennsylvania", 40.9, -77.8}, "RI": {"Rhode Island", 41.7, -71.5},
+	"SC": {"South Carolina", 33.9, -80.9}, "SD": {"South Dakota", 44.4, -100.2},
+	"TN": {"Tennessee", 35.9, -86.4}, "TX": {"Texas", 31.5, -99.3},
+	"UT": {"Utah", 39.3, -111.7}, "VT": {"Vermont", 44.1, -72.7},
+	"VA": {"Virginia", 37.5, -78.9}, "WA": {"Washington", 47.4, -120.5},
+	"WV": {"West Virginia", 38.6, -80.6}, "WI": {"Wisconsin", 44.6, -89.9},
+	"WY": {"Wyoming", 43.0, -107.6},
+	"AS": {"American Samoa", -14.3, -170.7}, "GU": {"Guam", 13.4, 144.8},
+	"MP": {"Northern Mariana Islands", 15.2, 145.7}, "PR": {"Puerto Rico", 18.2, -66.5},
+	"VI": {"U.S. Virgin Islands", 18.3, -64.9},
+}
+
+/****/
+
+/** ZIP centroids **/
+
+// zipFile maps five-digit ZIPs to the latitude and longitude of their
+// centres, one "zip,lat,lon" row each after a header, '#' starting a
+// comment. It is read once at startup; nothing is looked up online.
+const zipFile = "zipcentroids.csv"
+
+var zipCentroids = map[string][2]float64{}
+
+func loadZipCentroids(file_name string) (map[string][2]float64, error) {
+	f, err := os.Open(file_name)
+	if err != nil {
+		return nil, errors.New("Cannot read " + file_name + ".")
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	errs := &datafiles.Errors{File: file_name}
+	centroids := make(map[string][2]float64)
+	if _, err := reader.Read(); err != nil && err != io.EOF {
+		return nil, err
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if perr, ok := err.(*csv.ParseError); ok {
+			errs.Add(perr.Line, "%v", perr.Err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		zip := strings.TrimSpace(record[0])
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		lon, err2 := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		switch {
+		case len(zip) != 5 || strings.Trim(zip, "0123456789") != "":
+			errs.Add(line, "bad ZIP %q", zip)
+		case err1 != nil || lat < -90 || lat > 90:
+			errs.Add(line, "bad latitude %q", record[1])
+		case err2 != nil || lon < -180 || lon > 180:
+			errs.Add(line, "bad longitude %q", record[2])
+		default:
+			centroids[zip] = [2]float64{lat, lon}
+		}
+	}
+	return centroids, errs.OrNil()
+}
+
+// Where to put the location on a map, and how closely: "zip" from the
+// ZIP table, "state" from the state's centre if the ZIP is not in the
+// table, or "" (and no point) if there is no location at all.
+func (l Location) point() (lat float64, lon float64, precision string) {
+	if p, ok := zipCentroids[l.Zip]; ok {
+		return p[0], p[1], "zip"
+	}
+	if s, ok := states[l.State]; ok {
+		return s.Lat, s.Lon, "state"
+	}
+	return 0, 0, ""
+}
+
+/****/
+
+/** GeoJSON **/
+
+// RFC 7946. Properties are the company's name and address fields only.
+type geoCollection struct {
+	Type     string        `json:"type"`
+	Features []*geoFeature `json:"features"`
+}
+
+type geoFeature struct {
+	Type       string                 `json:"type"`
+	Id         int                    `json:"id"`
+	Geometry   *geoPoint              `json:"geometry"` // null if not located
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"` // longitude first
+}
+
+func companyFeature(c *Company) *geoFeature {
+	loc := c.Location()
+	f := &geoFeature{Type: "Feature", Id: c.Id, Properties: map[string]interface{}{
+		"name": c.Name, "address1": c.Address1, "address2": c.Address2,
+		"city": loc.City, "state": loc.State, "zip": loc.Zip}}
+	lat, lon, precision := loc.point()
+	if precision != "" {
+		f.Geometry = &geoPoint{Type: "Point", Coordinates: [2]float64{lon, lat}}
+	}
+	f.Properties["precision"] = precision
+	return f
+}
+
+/****/
+
+/** handlers **/
+
+// The companies grouped by state, in state-name order, with those that
+// have no state last.
+func groupByState() []*StateView {
+	groups := map[string]*StateView{}
+	for _, c := range companiesList {
+		code := c.Location().State
+		if groups[code] == nil {
+			groups[code] = stateView(code)
+		}
+		groups[code].Companies = append(groups[code].Companies, companyView(c))
+	}
+	list := []*StateView{}
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Code == "" || list[j].Code == "" {
+			return list[j].Code == "" && list[i].Code != ""
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func stateView(code string) *StateView {
+	v := &StateView{Code: code, Name: states[code].Name, Companies: []*CompanyView{}}
+	if code != "" {
+		v.URL = "/companies/by-state/" + code
+	}
+	return v
+}
+
+// GET /companies/by-state
+func StatesH(rw http.ResponseWriter, r *http.Request) {
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+	present(rw, r, "states.html", &StatesPage{States: groupByState()})
+
+	log("companies/by-state")
+}
+
+// GET /companies/by-state/{st:[A-Za-z]{2}}
+// Lower case redirects to upper, so each state has one URL.
+func StateH(rw http.ResponseWriter, r *http.Request) {
+	st := mux.Vars(r)["st"]
+	code := strings.ToUpper(st)
+	if _, ok := states[code]; !ok {
+		presentError(rw, r, http.StatusNotFound, "No state "+st+".")
+		return
+	}
+	if code != st {
+		http.Redirect(rw, r, "/companies/by-state/"+code+path.Ext(r.URL.Path), http.StatusMovedPermanently)
+		return
+	}
+
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+	page := &StatePage{StateView: stateView(code)}
+	for _, c := range companiesList {
+		if c.Location().State == code {
+			page.Companies = append(page.Companies, companyView(c))
+		}
+	}
+	present(rw, r, "state.html", page)
+
+	log("companies/by-state/" + code)
+}
+
+// GET /companies.geojson[?state=ST]
+// Every company, or one state's, as a GeoJSON FeatureCollection.
+func CompaniesGeoH(rw http.ResponseWriter, r *http.Request) {
+	state := strings.ToUpper(r.FormValue("state"))
+	if _, ok := states[state]; state != "" && !ok {
+		sendJSONError(rw, http.StatusBadRequest, "No state "+state+".")
+		return
+	}
+
+	dataLock.RLock()
+	collection := &geoCollection{Type: "FeatureCollection", Features: []*geoFeature{}}
+	for _, c := range companiesList {
+		if state == "" || c.Location().State == state {
+			collection.Features = append(collection.Features, companyFeature(c))
+		}
+	}
+	dataLock.RUnlock()
+
+	doc, err := json.MarshalIndent(collection, "", "  ")
+	if err != nil {
+		sendJSONError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rw.Header().Set("Content-Type", "application/geo+json")
+	rw.Write(doc)
+
+	log("companies.geojson")
+}
+
+/****/
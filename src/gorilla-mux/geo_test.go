@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Every company in the data files is placed by its ZIP.
+func TestZipCoverage(t *testing.T) {
+	newTestSite(t)
+	for _, c := range companiesList {
+		if _, _, precision := c.Location().point(); precision != "zip" {
+			t.Errorf("company %d (%s): precision %q, want \"zip\"", c.Id, c.Address2, precision)
+		}
+	}
+}
+
+func TestGroupByState(t *testing.T) {
+	ts := newTestSite(t)
+	// One company with no state to group it under.
+	response, _ := ts.post("/companies/new", url.Values{"name": {"Nowhere Inc."}, "ceo": {"Test"},
+		"address1": {"1 Main St"}, "address2": {"Somewhere"}})
+	expectStatus(t, "create", response, http.StatusSeeOther)
+
+	got := []string{}
+	for _, g := range groupByState() {
+		ids := []string{}
+		for _, c := range g.Companies {
+			ids = append(ids, strconv.Itoa(c.Id))
+		}
+		got = append(got, g.Code+":"+strings.Join(ids, ","))
+	}
+	expect(t, "groups", got, []string{"AS:6", "AR:15", "CO:9,11", "DC:14", "HI:5", "KS:7", "LA:13",
+		"NY:1,2", "NC:4", "OR:8,12,16", "SD:3", "TX:10", ":17"})
+
+	for _, c := range []struct {
+		path     string
+		want     int
+		location string
+		count    int // companies on the page, if it is JSON
+	}{
+		{"/companies/by-state", http.StatusOK, "", -1},
+		{"/companies/by-state/OR", http.StatusOK, "", -1},
+		{"/companies/by-state/OR.json", http.StatusOK, "", 3},
+		{"/companies/by-state/WY.json", http.StatusOK, "", 0},
+		{"/companies/by-state/or", http.StatusMovedPermanently, "/companies/by-state/OR", -1},
+		{"/companies/by-state/co.json", http.StatusMovedPermanently, "/companies/by-state/CO.json", -1},
+		{"/companies/by-state/ZZ", http.StatusNotFound, "", -1},
+	} {
+		response, body := ts.get(c.path)
+		expectStatus(t, c.path, response, c.want)
+		expect(t, c.path+" location", response.Header.Get("Location"), c.location)
+		if c.count >= 0 {
+			var page StatePage
+			if err := json.Unmarshal([]byte(body), &page); err != nil {
+				t.Fatalf("%s: %v", c.path, err)
+			}
+			expect(t, c.path+" companies", len(page.Companies), c.count)
+		}
+	}
+}
+
+func TestCompaniesGeoJSON(t *testing.T) {
+	ts := newTestSite(t)
+	// A ZIP not in the table falls back to the state's centre; no address
+	// at all means no point.
+	for _, address2 := range []string{"Salem, OR 97301", "Somewhere"} {
+		response, _ := ts.post("/companies/new", url.Values{"name": {"Test Inc."}, "ceo": {"Test"},
+			"address1": {"1 Main St"}, "address2": {address2}})
+		expectStatus(t, "create "+address2, response, http.StatusSeeOther)
+	}
+
+	type feature struct {
+		Id       int
+		Geometry *struct {
+			Type        string
+			Coordinates [2]float64
+		}
+		Properties map[string]interface{}
+	}
+	for _, c := range []struct {
+		query string
+		want  int
+		ids   []int
+	}{
+		{"", http.StatusOK, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18}},
+		{"?state=OR", http.StatusOK, []int{8, 12, 16, 17}},
+		{"?state=or", http.StatusOK, []int{8, 12, 16, 17}},
+		{"?state=WY", http.StatusOK, []int{}},
+		{"?state=ZZ", http.StatusBadRequest, nil},
+	} {
+		response, body := ts.get("/companies.geojson" + c.query)
+		expectStatus(t, c.query, response, c.want)
+		if c.ids == nil {
+			continue
+		}
+		expect(t, c.query+" content type", response.Header.Get("Content-Type"), "application/geo+json")
+		var collection struct {
+			Type     string
+			Features []*feature
+		}
+		if err := json.Unmarshal([]byte(body), &collection); err != nil {
+			t.Fatalf("%s: %v", c.query, err)
+		}
+		expect(t, c.query+" type", collection.Type, "FeatureCollection")
+		ids := []int{}
+		for _, f := range collection.Features {
+			ids = append(ids, f.Id)
+		}
+		expect(t, c.query+" ids", ids, c.ids)
+	}
+
+	_, body := ts.get("/companies.geojson")
+	var collection struct{ Features []*feature }
+	json.Unmarshal([]byte(body), &collection)
+	byId := map[int]*feature{}
+	for _, f := range collection.Features {
+		byId[f.Id] = f
+	}
+	oregon := states["OR"]
+	for _, c := range []struct {
+		id          int
+		precision   string
+		coordinates [2]float64 // longitude first
+	}{
+		{1, "zip", [2]float64{zipCentroids["84325"][1], zipCentroids["84325"][0]}},
+		{16, "zip", [2]float64{zipCentroids["25089"][1], zipCentroids["25089"][0]}},
+		{17, "state", [2]float64{oregon.Lon, oregon.Lat}},
+		{18, "", [2]float64{}},
+	} {
+		f := byId[c.id]
+		if f == nil {
+			t.Fatalf("no feature %d", c.id)
+		}
+		expect(t, "precision "+strconv.Itoa(c.id), f.Properties["precision"], c.precision)
+		if c.precision == "" {
+			if f.Geometry != nil {
+				t.Errorf("feature %d: geometry %v, want null", c.id, f.Geometry)
+			}
+			continue
+		}
+		if f.Geometry == nil || f.Geometry.Type != "Point" {
+			t.Fatalf("feature %d: geometry %v, want a Point", c.id, f.Geometry)
+		}
+		expect(t, "coordinates "+strconv.Itoa(c.id), f.Geometry.Coordinates, c.coordinates)
+	}
+}
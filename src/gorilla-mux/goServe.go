@@ -3,21 +3,31 @@ package main
 /** imports **/
 
 import (
+	"datafiles"
 	"github.com/gorilla/mux"
 	"net/http"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"strings"
-	"text/template"
 	"regexp"
 	"strconv"
-	"encoding/json"
+	"flag"
+	"tlsconf"
+	"cors"
+	"context"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 /****/
 
 /** data structures **/
 
+// A Saying belongs to at most one Company (Company_id 0 for none); a
+// Company may have any number of Sayings.
 type Saying struct {
 	Id         int
 	Company_id int
@@ -25,22 +35,23 @@ type Saying struct {
 	Prediction string
 }
 
+// Website, Industry and Founded are optional (see companies.go).
 type Company struct {
 	Id        int
-	Saying_id int
 	CEO       string
 	Name      string
 	Address1  string
 	Address2  string
+	Website   string
+	Industry  string
+	Founded   int
 }
 
-type SayingCompany struct {
-	Who   string
-	Which string
-	What  string
-}
+// The pages' view models are in views.go.
 
+// See cliches.go.
 type Cliche struct {
+	Id     int
    Truism string
 	Author string
    Words  int
@@ -49,107 +60,220 @@ type Cliche struct {
 /** globals **/
 var sayingsList = []*Saying{}
 var companiesList = []*Company{}
+var nextSayingId, nextCompanyId = 1, 1
+
+// Lookups by id, built from the lists by indexData. The lists, the
+// lookups and the data files change together, under dataLock (see data.go);
+// handlers that read them hold it for reading throughout.
+var dataLock sync.RWMutex
+var sayingsById = map[int]*Saying{}
+var companiesById = map[int]*Company{}
+var sayingsByCompany = map[int][]*Saying{}
+var tlsSettings tlsconf.Settings
+var corsOptions cors.Options
+
+// On SIGINT or SIGTERM, /readyz fails for this long before the server
+// stops, so that load balancers stop sending requests first.
+const drainPeriod = 5 * time.Second
 
 /** request handlers **/
 
 // GET /
 // GET /home
+// The page itself is all links and forms; the twins list the pages.
 func HomeH(response http.ResponseWriter, request *http.Request) {
-	// home.html is static rather than templated HTML
-	html := readFile("home.html")
-	response.Write([]byte(html))
+	present(response, request, "home.html", &HomePage{Links: []*Link{
+		{"companies", "/companies"},
+		{"companies-by-state", "/companies/by-state"},
+		{"companies-geojson", "/companies.geojson"},
+		{"predictions", "/predictions"}}})
 
 	log("home")
 }
 
-// POST /companies
+// GET /companies?q=&sort=&desc=&page=&per= (see listing.go)
 func CompaniesH(response http.ResponseWriter, request *http.Request) {
-	t := getTemplate("companies.html")
-	t.Execute(response, companiesList)
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+	companies, listing := listCompanies(parseListQuery(request, companySorts))
+	present(response, request, "companies.html", &CompaniesPage{Companies: companyViews(companies), Listing: &listing})
 
 	log("companies")
 }
 
-// POST /predictions
+// GET /predictions?q=&sort=&desc=&page=&per= (see listing.go)
 func PredictionsH(response http.ResponseWriter, request *http.Request) {
-	t := getTemplate("predictions.html")
-	t.Execute(response, sayingsList)
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+	sayings, listing := listSayings(parseListQuery(request, sayingSorts))
+	page := &PredictionsPage{SayingsTable: SayingsTable{Predictions: sayingViews(sayings), Listing: &listing}}
+	present(response, request, "predictions.html", page)
 
 	log("predictions")
 }
 
-// GET /prediction
+// GET /predictions/{id:[0-9]+}
+func PredictionIdH(response http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)["id"]
+
+	sendResponse(response, request, id)
+	log("predictions/" + id)
+}
+
+// GET /companies/{id:[0-9]+}
+// The company with all of its predictions.
+func CompanyH(response http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)["id"]
+	i, _ := strconv.Atoi(id)
+
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+	company, ok := companiesById[i]
+	if !ok {
+		presentError(response, request, http.StatusNotFound, "No company " + id + ".")
+		return
+	}
+	page := &CompanyPage{CompanyView: companyView(company)}
+	page.Predictions, page.NoCompany = sayingViews(company.Sayings()), true
+	present(response, request, "company.html", page)
+
+	log("companies/" + id)
+}
+
+// The saying with the given id, together with its company.
+func sendResponse(response http.ResponseWriter, request *http.Request, id string) {
+	i, _ := strconv.Atoi(id) // Convert string to int.
+
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+	saying, ok := sayingsById[i]
+	if !ok {
+		presentError(response, request, http.StatusNotFound, "No prediction " + id + ".")
+		return
+	}
+
+	page := &PredictionPage{SayingView: sayingView(saying)}
+	for i, s := range sayingsList {
+		if s == saying {
+			if i > 0 {
+				page.Prev = sayingRef(sayingsList[i-1])
+			}
+			if i+1 < len(sayingsList) {
+				page.Next = sayingRef(sayingsList[i+1])
+			}
+		}
+	}
+
+	present(response, request, "prediction.html", page)
+}
+
+// The company the saying belongs to, or nil.
+func (s *Saying) Company() *Company {
+	return companiesById[s.Company_id]
+}
+
+// The company's sayings, in id order.
+func (c *Company) Sayings() []*Saying {
+	return sayingsByCompany[c.Id]
+}
+/****/
+
+/** legacy routes **/
+
+// The first version of the site fetched every page with a form POST, to
+// /companies, /predictions, /prediction (with the id in the form) and
+// /predictionD/{id}. These now redirect to the GET pages, so that old
+// bookmarks and forms keep working: a POST gets 303 See Other, which the
+// browser follows with a GET, and a GET gets 301 Moved Permanently.
+func redirectLegacy(response http.ResponseWriter, request *http.Request, to string) {
+	status := http.StatusMovedPermanently
+	if request.Method == http.MethodPost {
+		status = http.StatusSeeOther
+	}
+	http.Redirect(response, request, to, status)
+}
+
+// POST /companies
+// POST /predictions
+// Any form fields are kept as query parameters.
+func LegacyListH(response http.ResponseWriter, request *http.Request) {
+	request.ParseForm()
+	to := request.URL.Path
+	if query := request.Form.Encode(); query != "" {
+		to += "?" + query
+	}
+	redirectLegacy(response, request, to)
+
+	log("legacy " + request.URL.Path)
+}
+
+// GET|POST /prediction?saying={id}
 func PredictionH(response http.ResponseWriter, request *http.Request) {
 	// Extract the user-provided index.
-	request.ParseForm()
-	form := request.Form
-	id := form["saying"][0] // 1st and only member of a list
+	id := strings.TrimSpace(request.FormValue("saying"))
 
 	flag, _ := regexp.MatchString("^[0-9]+$", id)
 	if flag {
-		sendResponse(response, id)
+		redirectLegacy(response, request, "/predictions/" + id)
 	} else {
-		msg := "<html><body><h3>"
-		msg += "Bad request! Please enter integers only in the text field."
-		msg += "</h3><p><a href = '/home'>Home</a></p></body></html>"
-		response.Write([]byte(msg))
+		msg := "Bad request! Please enter integers only in the text field."
+		renderError(response, http.StatusBadRequest, msg)
 	}
 
 	log("prediction")
 }
 
-// GET /predictionD/{id:[0-9]+}
+// GET|POST /predictionD/{id:[0-9]+}
 func PredictionD(response http.ResponseWriter, request *http.Request) {
-	vars := mux.Vars(request)
-	id := vars["id"]
+	id := mux.Vars(request)["id"]
 
-	sendResponse(response, id)
+	redirectLegacy(response, request, "/predictions/" + id)
 	log("predictionD")
 }
-
-// GET /ajax
-func AjaxH(rw http.ResponseWriter, r *http.Request) { 
-	// Create a cliche and set its properties.
-	//cliche := new(Cliche)
-	//cliche.Truism = "A penny saved is a penny earned."
-	//cliche.Author = "Ben Franklin (apocryphal?)"
-	//parts := strings.Split(cliche.Truism, " ")
-	//cliche.Words = len(parts)
-
-	// Convert the cliche to JSON.
-	clich := "whatever"
-	obj, err := json.Marshal(cliche)
-	if err != nil {
-		fmt.Println("error:", err)
-	}
-
-	// Write the JSON back to the client.
-	rw.Write(obj)
-
-	log("ajax")
-}
-
-func sendResponse(response http.ResponseWriter, id string) {
-	i, _ := strconv.Atoi(id) // Convert string to int.
-	i = i % 16 // Ensure no out of bounds problems.
-
-	// Set up template data.
-	params := new(SayingCompany)
-	params.Who = sayingsList[i].Predictor
-	params.What = sayingsList[i].Prediction
-	params.Which = companiesList[i].Name
-	
-	t := getTemplate("prediction.html")
-	t.Execute(response, params)
-}
 /****/
 
 /** primary functions **/
 
 func main() {
+	// -tls-cert and -tls-key switch on HTTPS and HTTP/2 (see gencert);
+	// -cors-origins opens /ajax to pages served from elsewhere; -dev
+	// reads templates and assets from disk rather than the binary, and
+	// reloads edited templates without a restart.
+	tlsSettings.RegisterFlags()
+	corsOptions.RegisterFlags()
+	dev := flag.Bool("dev", false, "serve templates and assets from disk, re-parsing templates when they change")
+	flag.Parse()
+	if *dev {
+		siteFiles = os.DirFS(".")
+	}
+
+	// Hash every asset and parse every page up front: a broken template
+	// stops the server here rather than failing requests later.
+	staticFiles, err := fs.Sub(siteFiles, staticDir)
+	if err == nil {
+		assets, err = newAssetStore(staticFiles)
+	}
+	if err != nil {
+		notifyAndMaybeDie(err.Error(), true)
+	}
+	templateFiles, err := fs.Sub(siteFiles, templatesDir)
+	if err == nil {
+		templates, err = newRegistry(templateFiles, *dev)
+	}
+	if err != nil {
+		notifyAndMaybeDie(err.Error(), true)
+	}
+
 	// Get lists of predictions and companies from the
 	// data store (in this case, text files).
-	sayingsList, companiesList = readData()
+	readData()
+	indexData()
+	if err := clicheStore.load(clichesFile); err != nil {
+		notifyAndMaybeDie(err.Error(), true)
+	}
+	if zipCentroids, err = loadZipCentroids(zipFile); err != nil {
+		notifyAndMaybeDie(err.Error(), true)
+	}
 
 	flag := false // true for dump of lists
 	if flag {
@@ -157,85 +281,137 @@ func main() {
 		dumpCompanies(companiesList)
 	}
 
+	registerChecks()
 	startServer()
 }
 
 func startServer() {
+	router := newRouter()
+
+	// Enable the router.
+   http.Handle("/", router)
+
+	// Start the server; a SIGHUP reloads the TLS certificate, if any.
+	fmt.Println("\nListening on port 8080...")
+	corsOptions.Routable = func(r *http.Request) bool {
+		var match mux.RouteMatch
+		return router.Match(r, &match) && match.MatchErr == nil
+	}
+	srv := &http.Server{Addr: ":8080", Handler: cors.Handler(corsOptions, router)}
+	stopped := make(chan bool)
+	go drainOnSignal(srv, stopped)
+
+	err := tlsconf.ListenAndServe(srv, tlsSettings)
+	if err != http.ErrServerClosed {
+		notifyAndMaybeDie(err.Error(), true)
+	}
+	<-stopped
+}
+
+func newRouter() *mux.Router {
    router := mux.NewRouter()
 
 	// Dispatch map
    router.HandleFunc("/", HomeH).Methods("GET")
-	router.HandleFunc("/home", HomeH).Methods("GET")
+	handlePage(router, "/home", HomeH)
+
+	handlePage(router, "/predictions", PredictionsH)
+	handlePage(router, "/predictions/{id:[0-9]+}", PredictionIdH)
+	router.HandleFunc("/predictions/new", csrfProtect(SayingNewH)).Methods("GET", "POST")
+	router.HandleFunc("/predictions/{id:[0-9]+}/edit", csrfProtect(SayingEditH)).Methods("GET", "POST")
+	router.HandleFunc("/predictions/{id:[0-9]+}/delete", csrfProtect(SayingDeleteH)).Methods("POST")
+
+	handlePage(router, "/companies", CompaniesH)
+	handlePage(router, "/companies/{id:[0-9]+}", CompanyH)
+	router.HandleFunc("/companies/new", csrfProtect(CompanyNewH)).Methods("GET", "POST")
+	router.HandleFunc("/companies/{id:[0-9]+}/edit", csrfProtect(CompanyEditH)).Methods("GET", "POST")
+	router.HandleFunc("/companies/{id:[0-9]+}/delete", csrfProtect(CompanyDeleteH)).Methods("POST")
+	handlePage(router, "/companies/by-state", StatesH)
+	handlePage(router, "/companies/by-state/{st:[A-Za-z]{2}}", StateH)
+	router.HandleFunc("/companies.geojson", CompaniesGeoH).Methods("GET")
+
+	// The old POST-only routes (see redirectLegacy).
+	router.HandleFunc("/companies", LegacyListH).Methods("POST")
+	router.HandleFunc("/predictions", LegacyListH).Methods("POST")
+	router.HandleFunc("/prediction", PredictionH).Methods("GET", "POST")
+	router.HandleFunc("/predictionD/{id:[0-9]+}", PredictionD).Methods("GET", "POST")
 
-	router.HandleFunc("/predictions", PredictionsH).Methods("POST")
-   router.HandleFunc("/prediction", PredictionH).Methods("POST") 
-	router.HandleFunc("/predictionD/{id:[0-9]+}", PredictionD).Methods("POST")
+	router.HandleFunc("/ajax", AjaxH).Methods("GET")
+	router.HandleFunc("/ajax/{id:[0-9]+}", AjaxIdH).Methods("GET")
+	router.HandleFunc("/cliches", ClichesH).Methods("GET")
+	router.HandleFunc("/cliches", csrfProtectJSON(ClicheCreateH)).Methods("POST")
+	router.HandleFunc("/cliches/{id:[0-9]+}", csrfProtectJSON(ClicheEditH)).Methods("PUT")
+	router.HandleFunc("/cliches/{id:[0-9]+}", csrfProtectJSON(ClicheDeleteH)).Methods("DELETE")
 
-   router.HandleFunc("/companies", CompaniesH).Methods("POST")
+	router.PathPrefix("/" + staticDir + "/").HandlerFunc(StaticH).Methods("GET", "HEAD")
 
-	router.HandleFunc("/ajax", AjaxH).Methods("GET")
+	router.HandleFunc("/healthz", checker.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", checker.Readyz).Methods("GET")
+	return router
+}
 
-	// Enable the router.
-   http.Handle("/", router)
+// Route GETs of a page and of its JSON and XML twins (see views.go) to
+// the handler.
+func handlePage(router *mux.Router, path string, handler http.HandlerFunc) {
+	for _, suffix := range []string{"", ".json", ".xml"} {
+		router.HandleFunc(path + suffix, handler).Methods("GET")
+	}
+}
 
-	// Start the server.
-	fmt.Println("\nListening on port 8080...")
-	http.ListenAndServe(":8080", router);
+// Fail readiness, wait out the drain period, then let in-flight requests
+// finish.
+func drainOnSignal(srv *http.Server, stopped chan bool) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	log((<-ch).String() + ": draining")
+
+	checker.Drain()
+	time.Sleep(drainPeriod)
+	ctx, cancel := context.WithTimeout(context.Background(), drainPeriod)
+	defer cancel()
+	srv.Shutdown(ctx)
+	close(stopped)
 }
 /****/
 
 /** utilities **/
 
-func createCompanies(cs string) []*Company {
-	var records = splitString(cs, "\n")
-	if len(records) < 1 {
-		notifyAndMaybeDie("Need > 0 companies.", true)
+// The file's format is shared with rest and sayingsctl (see datafiles).
+func createSayings(inputs string) ([]*Saying, int) {
+	records, nextId, err := datafiles.ParseSayings(sayingsFile, inputs)
+	if err != nil {
+		notifyAndMaybeDie(err.Error(), true)
 	}
 
-   var id = 1
-	var company *Company
-	var companies = []*Company{}
-
-	for i, record := range records {
-		n := i % 4
-		switch {
-		case n == 0:
-			company = new(Company)
-			company.Id = id
-			company.Saying_id = id
-			id++
-			company.CEO = record
-		case n == 1:
-			company.Name = record
-		case n == 2:
-			company.Address1 = record
-		case n == 3:
-			company.Address2 = record
-			companies = append(companies, company)
-		}
+	var sayings = []*Saying{}
+	for _, r := range records {
+		sayings = append(sayings, &Saying{Id: r.Id, Company_id: r.CompanyId,
+			Predictor: r.Predictor, Prediction: r.Prediction})
 	}
-	return companies
+	return sayings, nextId
 }
 
-func createSayings(inputs string) []*Saying {
-	var ss = splitString(inputs, "\n")
-	if len(ss) < 1 {
-		notifyAndMaybeDie("Need >= 1 sayings.", true)
-	}
+// Build the lookups by id. A saying naming a company that does not exist
+// is fatal: the data files disagree.
+func indexData() {
+	sayingsById = map[int]*Saying{}
+	companiesById = map[int]*Company{}
+	sayingsByCompany = map[int][]*Saying{}
 
-	var sayings = []*Saying{}
-	for i, saying := range ss {
-		parts := splitString(saying, "!")
-		if len(parts) == 2 {
-			sayingStruct := new(Saying)
-			sayingStruct.Id = i + 1
-			sayingStruct.Company_id = i + 1
-			sayingStruct.Predictor = parts[0]
-			sayingStruct.Prediction = parts[1]
-			sayings = append(sayings, sayingStruct)
+	for _, company := range companiesList {
+		companiesById[company.Id] = company
+	}
+	for _, saying := range sayingsList {
+		sayingsById[saying.Id] = saying
+		if saying.Company_id == 0 {
+			continue
+		}
+		if _, ok := companiesById[saying.Company_id]; !ok {
+			msg := fmt.Sprintf("Saying %d names company %d, which is not in %s.", saying.Id, saying.Company_id, companiesFile)
+			notifyAndMaybeDie(msg, true)
 		}
+		sayingsByCompany[saying.Company_id] = append(sayingsByCompany[saying.Company_id], saying)
 	}
-	return sayings
 }
 
 func dumpCompanies(companies []*Company) {
@@ -262,15 +438,6 @@ func dumpSayings(sayings []*Saying) {
 	}
 }
 
-func getTemplate(filename string) *template.Template {
-	records := readFile(filename)
-
-	tmpl, err := template.New("records").Parse(records)
-	if err != nil { panic(err) }
-
-	return tmpl
-}
-
 func notifyAndMaybeDie(msg string, die bool) {
 	fmt.Println("\n!!! " + msg);
 	if die {
@@ -278,10 +445,15 @@ func notifyAndMaybeDie(msg string, die bool) {
 	}
 }
 
-func readData() ([]*Saying, []*Company) {
-	sayings := readFile("sayings.db")
-	companies := readFile("companies.db")
-	return createSayings(sayings), createCompanies(companies)
+// Set the lists, and the next ids, from the data files.
+func readData() {
+	sayings := readFile(sayingsFile)
+	companies, nextId, err := loadCompanies()
+	if err != nil {
+		notifyAndMaybeDie(err.Error(), true)
+	}
+	companiesList, nextCompanyId = companies, nextId
+	sayingsList, nextSayingId = createSayings(sayings)
 }
 
 func readFile(file_name string) string {
@@ -292,10 +464,6 @@ func readFile(file_name string) string {
 	return string(records)
 }
 
-func splitString(in string, delimiter string) []string {
-	return strings.Split(in, delimiter)
-}
-
 func log(msg string) {
 	fmt.Println(msg)
 }
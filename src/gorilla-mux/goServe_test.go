@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// End-to-end tests: each runs the router of main over a copy of the data
+// files in a directory of its own, served by httptest. The templates and
+// assets are the embedded ones, as in production.
+
+var dataFiles = []string{sayingsFile, companiesFile, clichesFile, zipFile}
+
+var sourceDir string // of the package, holding the data files
+
+func TestMain(m *testing.M) {
+	var err error
+	if sourceDir, err = os.Getwd(); err != nil {
+		panic(err)
+	}
+	staticFiles, err := fs.Sub(embeddedFiles, staticDir)
+	if err == nil {
+		assets, err = newAssetStore(staticFiles)
+	}
+	if err != nil {
+		panic(err)
+	}
+	templateFiles, err := fs.Sub(embeddedFiles, templatesDir)
+	if err == nil {
+		templates, err = newRegistry(templateFiles, false)
+	}
+	if err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type testSite struct {
+	*httptest.Server
+	t *testing.T
+}
+
+// The site over fresh copies of the data files, which become the working
+// directory for the rest of the test. Its client keeps cookies and does
+// not follow redirects, so that tests see them.
+func newTestSite(t *testing.T) *testSite {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range dataFiles {
+		doc, err := ioutil.ReadFile(filepath.Join(sourceDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), doc, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	dataLock.Lock()
+	readData()
+	indexData()
+	dataLock.Unlock()
+	clicheStore = &ClicheStore{cliches: make(map[int]*Cliche), nextId: 1}
+	if err := clicheStore.load(clichesFile); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if zipCentroids, err = loadZipCentroids(zipFile); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := &testSite{Server: httptest.NewServer(newRouter()), t: t}
+	t.Cleanup(ts.Close)
+	ts.Client().Jar, _ = cookiejar.New(nil)
+	ts.Client().CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return ts
+}
+
+// Send a request, with form (if any) as the body, and return the response
+// with its body read.
+func (ts *testSite) do(method string, path string, form url.Values, header http.Header) (*http.Response, string) {
+	ts.t.Helper()
+	body := strings.NewReader(form.Encode())
+	request, err := http.NewRequest(method, ts.URL+path, body)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if form != nil {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer response.Body.Close()
+	doc, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return response, string(doc)
+}
+
+func (ts *testSite) get(path string) (*http.Response, string) {
+	ts.t.Helper()
+	return ts.do("GET", path, nil, nil)
+}
+
+// GET path and decode its JSON into v.
+func (ts *testSite) getJSON(path string, v interface{}) {
+	ts.t.Helper()
+	response, body := ts.get(path)
+	expectStatus(ts.t, path, response, http.StatusOK)
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		ts.t.Fatalf("%s: %v", path, err)
+	}
+}
+
+// Submit a form as the browser would, with the CSRF token.
+func (ts *testSite) post(path string, form url.Values) (*http.Response, string) {
+	ts.t.Helper()
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set(csrfField, ts.token())
+	return ts.do("POST", path, form, nil)
+}
+
+// The client's CSRF token, from its cookie, fetching a page for one if
+// it has none yet.
+func (ts *testSite) token() string {
+	ts.t.Helper()
+	u, _ := url.Parse(ts.URL)
+	for i := 0; i < 2; i++ {
+		for _, cookie := range ts.Client().Jar.Cookies(u) {
+			if cookie.Name == csrfCookie {
+				return cookie.Value
+			}
+		}
+		ts.get("/predictions/new")
+	}
+	ts.t.Fatal("no CSRF cookie")
+	return ""
+}
+
+func expect(t *testing.T, what string, got interface{}, want interface{}) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func expectStatus(t *testing.T, what string, response *http.Response, want int) {
+	t.Helper()
+	if response.StatusCode != want {
+		t.Errorf("%s: status %s, want %d", what, response.Status, want)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"health"
+)
+
+/** health checks **/
+
+// /healthz and /readyz, on the same rule as in rest: liveness asks only
+// that the data lock answer, so that a process still serving is never
+// restarted for want of a dependency. Readiness wants the data loaded, the
+// data files readable and the page templates parsed, and fails once
+// shutdown starts draining the server.
+var checker = health.New()
+
+func registerChecks() {
+	checker.Live("data", func() error {
+		dataLock.RLock()
+		dataLock.RUnlock()
+		return nil
+	})
+	checker.Ready("loaded", func() error {
+		dataLock.RLock()
+		defer dataLock.RUnlock()
+		if len(sayingsList) == 0 || len(companiesList) == 0 {
+			return errors.New("no sayings or companies loaded")
+		}
+		return nil
+	})
+	for _, file_name := range []string{sayingsFile, companiesFile, clichesFile} {
+		checker.Ready(file_name, health.Readable(file_name))
+	}
+	checker.Ready("templates", templates.check)
+}
+/****/
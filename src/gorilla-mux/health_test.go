@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"health"
+	"net/http"
+	"os"
+	"testing"
+)
+
+// Whatever the pages lack, readiness fails and liveness holds.
+func TestHealth(t *testing.T) {
+	checker = health.New() // before the router takes its handlers
+	registerChecks()
+	ts := newTestSite(t)
+
+	for _, c := range []struct {
+		name  string
+		spoil func()
+		check string // the readiness check that fails, if any
+	}{
+		{"ok", func() {}, ""},
+		{"no companies file", func() { os.Remove(companiesFile) }, companiesFile},
+		{"no sayings", func() {
+			dataLock.Lock()
+			sayingsList = nil
+			dataLock.Unlock()
+		}, "loaded"},
+		{"draining", checker.Drain, ""},
+	} {
+		c.spoil()
+		response, _ := ts.get("/healthz")
+		expectStatus(t, c.name+" healthz", response, http.StatusOK)
+
+		response, body := ts.get("/readyz")
+		want := http.StatusServiceUnavailable
+		if c.name == "ok" {
+			want = http.StatusOK
+		}
+		expectStatus(t, c.name+" readyz", response, want)
+		var report health.Report
+		if err := json.Unmarshal([]byte(body), &report); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range report.Checks {
+			if r.Name == c.check && r.OK {
+				t.Errorf("%s: %s passed", c.name, c.check)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// The old POST routes, and GETs of them, land on the GET pages.
+func TestLegacyRedirects(t *testing.T) {
+	ts := newTestSite(t)
+	for _, c := range []struct {
+		method   string
+		path     string
+		form     url.Values
+		want     int
+		location string
+	}{
+		{"POST", "/companies", nil, http.StatusSeeOther, "/companies"},
+		{"POST", "/companies", url.Values{"q": {"sons"}, "page": {"2"}}, http.StatusSeeOther, "/companies?page=2&q=sons"},
+		{"POST", "/predictions", url.Values{"sort": {"predictor"}}, http.StatusSeeOther, "/predictions?sort=predictor"},
+		{"POST", "/prediction", url.Values{"saying": {" 7 "}}, http.StatusSeeOther, "/predictions/7"},
+		{"GET", "/prediction?saying=7", nil, http.StatusMovedPermanently, "/predictions/7"},
+		{"POST", "/prediction", url.Values{"saying": {"seven"}}, http.StatusBadRequest, ""},
+		{"GET", "/prediction?saying=-1", nil, http.StatusBadRequest, ""},
+		{"GET", "/prediction", nil, http.StatusBadRequest, ""},
+		{"POST", "/predictionD/3", nil, http.StatusSeeOther, "/predictions/3"},
+		{"GET", "/predictionD/3", nil, http.StatusMovedPermanently, "/predictions/3"},
+		{"GET", "/predictionD/three", nil, http.StatusNotFound, ""},
+		{"PUT", "/companies", nil, http.StatusMethodNotAllowed, ""},
+	} {
+		what := c.method + " " + c.path + " " + c.form.Encode()
+		response, _ := ts.do(c.method, c.path, c.form, nil)
+		expectStatus(t, what, response, c.want)
+		expect(t, what+" location", response.Header.Get("Location"), c.location)
+	}
+
+	// Following the redirect gets the page itself.
+	ts.Client().CheckRedirect = nil
+	response, body := ts.do("POST", "/prediction", url.Values{"saying": {"7"}}, nil)
+	expectStatus(t, "followed", response, http.StatusOK)
+	expect(t, "followed to", response.Request.URL.Path, "/predictions/7")
+	expect(t, "followed with", response.Request.Method, "GET")
+	if !strings.Contains(body, sayingsById[7].Prediction) {
+		t.Errorf("followed: not prediction 7: %s", body)
+	}
+}
+
+// The pages link to each other, so that every page can be reached by GET.
+func TestPageLinks(t *testing.T) {
+	ts := newTestSite(t)
+	for _, c := range []struct {
+		path string
+		has  []string
+		not  []string
+	}{
+		{"/home", []string{"'/companies'", "'/predictions'", "'/companies/by-state'"}, nil},
+		{"/predictions/1", []string{"'/predictions/2'", "'/companies/1'", "'/predictions/1/edit'"}, []string{"Previous"}},
+		{"/predictions/8", []string{"'/predictions/7'", "'/predictions/9'", "'/companies/8'"}, nil},
+		{"/predictions/16", []string{"'/predictions/15'"}, []string{"Next &rsaquo;"}},
+		{"/companies/1", []string{"'/predictions/1'", "'/companies/1/edit'"}, []string{"'/predictions/2'"}},
+		{"/predictions", []string{"'/predictions/16'", "'/companies/13'"}, nil},
+		{"/companies", []string{"'/companies/14'"}, nil},
+	} {
+		response, body := ts.get(c.path)
+		expectStatus(t, c.path, response, http.StatusOK)
+		for _, s := range c.has {
+			if !strings.Contains(body, "href = "+s) {
+				t.Errorf("%s: no link to %s", c.path, s)
+			}
+		}
+		for _, s := range c.not {
+			if strings.Contains(body, s) {
+				t.Errorf("%s: has %q", c.path, s)
+			}
+		}
+	}
+}
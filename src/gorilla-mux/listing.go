@@ -0,0 +1,219 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/** paging, sorting and searching **/
+
+// The companies and predictions pages take their view from the query
+// string, so every view is a plain link that works without JavaScript:
+//
+//	?q=words   keep the rows containing every word, in any searched field
+//	?sort=key  order by that column (see companySorts and sayingSorts)
+//	?desc=1    ... in reverse
+//	?page=n    show the nth page, of ?per=rows (perPageDefault by default)
+//
+// Anything unknown or out of range falls back to the default rather than
+// failing, since these come from links and hand-edited URLs.
+const (
+	perPageDefault = 20
+	perPageMax     = 100
+)
+
+type ListQuery struct {
+	Path    string `json:"-" xml:"-"` // of the page, for its links
+	Q       string `json:"q,omitempty" xml:"q,attr,omitempty"`
+	Sort    string `json:"sort" xml:"sort,attr"`
+	Desc    bool   `json:"desc" xml:"desc,attr"`
+	Page    int    `json:"page" xml:"page,attr"`
+	PerPage int    `json:"per" xml:"per,attr"`
+}
+
+// A page of a list: the query that chose it and where it falls.
+type Listing struct {
+	ListQuery
+	Total int `json:"total" xml:"total,attr"` // rows matching Q
+	Pages int `json:"pages" xml:"pages,attr"`
+	First int `json:"first" xml:"first,attr"` // 1-based positions of the rows shown, 0 if none
+	Last  int `json:"last" xml:"last,attr"`
+}
+
+func parseListQuery(r *http.Request, sorts []string) ListQuery {
+	q := ListQuery{Path: r.URL.Path, Q: strings.TrimSpace(r.FormValue("q")), Sort: sorts[0],
+		Desc: r.FormValue("desc") == "1", Page: 1, PerPage: perPageDefault}
+	if sort := r.FormValue("sort"); contains(sorts, sort) {
+		q.Sort = sort
+	}
+	if n, err := strconv.Atoi(r.FormValue("page")); err == nil && n > 0 {
+		q.Page = n
+	}
+	if n, err := strconv.Atoi(r.FormValue("per")); err == nil && n > 0 && n <= perPageMax {
+		q.PerPage = n
+	}
+	return q
+}
+
+// Whether every word of Q appears, ignoring case, in one of the fields.
+func (q ListQuery) matches(fields ...string) bool {
+	text := strings.ToLower(strings.Join(fields, "\n"))
+	for _, word := range strings.Fields(strings.ToLower(q.Q)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Page through n rows; a page past the end shows the last one. Returns
+// the bounds of the rows to show.
+func (q ListQuery) paginate(n int) (Listing, int, int) {
+	l := Listing{ListQuery: q, Total: n, Pages: (n + q.PerPage - 1) / q.PerPage}
+	if l.Pages == 0 {
+		l.Pages = 1
+	}
+	if l.Page > l.Pages {
+		l.Page = l.Pages
+	}
+	start := (l.Page - 1) * l.PerPage
+	end := start + l.PerPage
+	if end > n {
+		end = n
+	}
+	if start < end {
+		l.First, l.Last = start+1, end
+	}
+	return l, start, end
+}
+
+// The link to this view with some parameters changed. Defaults are left
+// out to keep the links short.
+func (q ListQuery) url(sort string, desc bool, page int) string {
+	v := url.Values{}
+	if q.Q != "" {
+		v.Set("q", q.Q)
+	}
+	v.Set("sort", sort)
+	if desc {
+		v.Set("desc", "1")
+	}
+	if page > 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	if q.PerPage != perPageDefault {
+		v.Set("per", strconv.Itoa(q.PerPage))
+	}
+	return q.Path + "?" + v.Encode()
+}
+
+// For a column header: sort by the column, reversing the order if the
+// list is sorted by it already, from the first page.
+func (l Listing) SortURL(sort string) string {
+	return l.url(sort, sort == l.Sort && !l.Desc, 1)
+}
+
+// An arrow for the column the list is sorted by.
+func (l Listing) SortMark(sort string) string {
+	if sort != l.Sort {
+		return ""
+	}
+	if l.Desc {
+		return "▼"
+	}
+	return "▲"
+}
+
+func (l Listing) PageURL(page int) string {
+	return l.url(l.Sort, l.Desc, page)
+}
+
+func (l Listing) Prev() int { return l.Page - 1 }
+func (l Listing) Next() int {
+	if l.Page >= l.Pages {
+		return 0
+	}
+	return l.Page + 1
+}
+
+/****/
+
+/** the lists **/
+
+// Sort keys, the default first. Ties keep id order.
+var companySorts = []string{"company", "ceo", "location", "predictions"}
+var sayingSorts = []string{"id", "predictor", "company"}
+
+func listCompanies(q ListQuery) ([]*Company, Listing) {
+	companies := []*Company{}
+	for _, c := range companiesList {
+		if q.matches(c.Name, c.CEO, c.Address1, c.Address2, c.Industry, c.Website) {
+			companies = append(companies, c)
+		}
+	}
+
+	key := func(c *Company) string {
+		switch q.Sort {
+		case "ceo":
+			return strings.ToLower(c.CEO)
+		case "location":
+			loc := c.Location()
+			return strings.ToLower(loc.State + "\n" + loc.City)
+		}
+		return strings.ToLower(c.Name)
+	}
+	sort.SliceStable(companies, func(i, j int) bool {
+		a, b := companies[i], companies[j]
+		if q.Desc {
+			a, b = b, a
+		}
+		if q.Sort == "predictions" {
+			return len(a.Sayings()) < len(b.Sayings())
+		}
+		return key(a) < key(b)
+	})
+
+	l, start, end := q.paginate(len(companies))
+	return companies[start:end], l
+}
+
+func listSayings(q ListQuery) ([]*Saying, Listing) {
+	sayings := []*Saying{}
+	for _, s := range sayingsList {
+		company := ""
+		if c := s.Company(); c != nil {
+			company = c.Name
+		}
+		if q.matches(s.Predictor, s.Prediction, company) {
+			sayings = append(sayings, s)
+		}
+	}
+
+	key := func(s *Saying) string {
+		if q.Sort == "company" {
+			if c := s.Company(); c != nil {
+				return strings.ToLower(c.Name)
+			}
+			return ""
+		}
+		return strings.ToLower(s.Predictor)
+	}
+	sort.SliceStable(sayings, func(i, j int) bool {
+		a, b := sayings[i], sayings[j]
+		if q.Desc {
+			a, b = b, a
+		}
+		if q.Sort == "id" {
+			return a.Id < b.Id
+		}
+		return key(a) < key(b)
+	})
+
+	l, start, end := q.paginate(len(sayings))
+	return sayings[start:end], l
+}
+
+/****/
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// The JSON twin shows which rows a query picks, and the listing's bounds.
+func TestCompanyListing(t *testing.T) {
+	ts := newTestSite(t)
+	for _, c := range []struct {
+		query string
+		ids   []int
+		page  string // sort desc page per total pages first last
+	}{
+		{"", []int{14, 3, 7, 1, 12, 15, 2, 8, 5, 16, 11, 4, 9, 6, 13, 10}, "company false 1 20 16 1 1 16"},
+		{"?per=5", []int{14, 3, 7, 1, 12}, "company false 1 5 16 4 1 5"},
+		{"?per=5&page=4", []int{10}, "company false 4 5 16 4 16 16"},
+		{"?per=5&page=9", []int{10}, "company false 4 5 16 4 16 16"},
+		{"?per=5&page=0", []int{14, 3, 7, 1, 12}, "company false 1 5 16 4 1 5"},
+		{"?per=5&page=two", []int{14, 3, 7, 1, 12}, "company false 1 5 16 4 1 5"},
+		{"?per=0", nil, "company false 1 20 16 1 1 16"},
+		{"?per=101", nil, "company false 1 20 16 1 1 16"},
+		{"?per=100", nil, "company false 1 100 16 1 1 16"},
+		{"?sort=ceo&per=4", []int{12, 6, 13, 5}, "ceo false 1 4 16 4 1 4"},
+		{"?sort=ceo&desc=1&per=4", []int{15, 8, 11, 4}, "ceo true 1 4 16 4 1 4"},
+		{"?sort=location&per=4", []int{15, 6, 9, 11}, "location false 1 4 16 4 1 4"},
+		{"?sort=predictions&per=4", []int{1, 2, 3, 4}, "predictions false 1 4 16 4 1 4"},
+		{"?sort=predictions&desc=1&per=4", []int{1, 2, 3, 4}, "predictions true 1 4 16 4 1 4"},
+		{"?sort=nonesuch&per=4", []int{14, 3, 7, 1}, "company false 1 4 16 4 1 4"},
+		{"?q=sons", []int{11, 4}, "company false 1 20 2 1 1 2"},
+		{"?q=GRAHAM+donnelly", []int{1, 12}, "company false 1 20 2 1 1 2"},
+		{"?q=software", []int{2}, "company false 1 20 1 1 1 1"},
+		{"?q=group&desc=1", []int{16, 3}, "company true 1 20 2 1 1 2"},
+		{"?q=nonesuch&page=3", []int{}, "company false 1 20 0 1 0 0"},
+	} {
+		var page CompaniesPage
+		ts.getJSON("/companies.json"+c.query, &page)
+		if c.ids != nil {
+			ids := []int{}
+			for _, company := range page.Companies {
+				ids = append(ids, company.Id)
+			}
+			expect(t, c.query+" ids", ids, c.ids)
+		}
+		l := page.Listing
+		expect(t, c.query+" page", fmt.Sprintf("%s %v %d %d %d %d %d %d", l.Sort, l.Desc, l.Page, l.PerPage, l.Total, l.Pages, l.First, l.Last), c.page)
+	}
+}
+
+func TestPredictionListing(t *testing.T) {
+	ts := newTestSite(t)
+	for _, c := range []struct {
+		query string
+		ids   []int
+	}{
+		{"", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+		{"?desc=1&per=3", []int{16, 15, 14}},
+		{"?per=3&page=6", []int{16}},
+		{"?sort=predictor&per=5", []int{10, 5, 11, 3, 14}},
+		{"?sort=company&per=5", []int{14, 3, 7, 1, 12}},
+		{"?sort=company&desc=1&per=3", []int{10, 13, 6}},
+		{"?q=boehm", []int{3, 16}},
+		{"?q=boehm&sort=predictor", []int{3, 16}},
+	} {
+		var page PredictionsPage
+		ts.getJSON("/predictions.json"+c.query, &page)
+		ids := []int{}
+		for _, s := range page.Predictions {
+			ids = append(ids, s.Id)
+		}
+		expect(t, c.query+" ids", ids, c.ids)
+	}
+}
+
+// The HTML page links to the other views, keeping the query.
+func TestListingLinks(t *testing.T) {
+	ts := newTestSite(t)
+	for _, c := range []struct {
+		path string
+		has  []string
+		not  []string
+	}{
+		{"/companies?per=5&page=2&q=a", []string{
+			"/companies?per=5&amp;q=a&amp;sort=company'",
+			"/companies?page=3&amp;per=5&amp;q=a&amp;sort=company",
+			"/companies?desc=1&amp;per=5&amp;q=a&amp;sort=company",
+			"/companies?per=5&amp;q=a&amp;sort=ceo",
+			"▲"}, nil},
+		{"/companies?sort=ceo&desc=1", []string{"/companies?sort=ceo'", "▼"}, []string{"Next &rsaquo;", "Previous"}},
+		{"/predictions?per=10", []string{"/predictions?page=2&amp;per=10&amp;sort=id", "Next &rsaquo;"}, []string{"Previous"}},
+		{"/predictions?q=nonesuch", []string{"value = 'nonesuch'"}, []string{"/predictions/1'"}},
+	} {
+		response, body := ts.get(c.path)
+		expectStatus(t, c.path, response, http.StatusOK)
+		for _, s := range c.has {
+			if !strings.Contains(body, s) {
+				t.Errorf("%s: no %q", c.path, s)
+			}
+		}
+		for _, s := range c.not {
+			if strings.Contains(body, s) {
+				t.Errorf("%s: has %q", c.path, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,16 @@
+// Fetch a random cliche from /ajax and show it.
+function ajax_call() {
+   var req = new XMLHttpRequest();
+   // Specify an ajax callback.
+   req.onreadystatechange = function() {
+      if (req.readyState == 4) {
+        var obj = JSON.parse(req.responseText);
+        document.getElementById('who').textContent = obj.Author + " in " + obj.Words + " words:";
+        document.getElementById('what').textContent = obj.Truism;
+      }
+   }
+
+   // Generate and send an asynchronous Ajax request.
+   req.open("GET", "/ajax", true);
+   req.send();
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/** template registry **/
+
+// The site's pages, parsed once at startup. Under templatesDir, base.html
+// is the layout every page shares, partials/ holds the pieces it and the
+// pages include, and each file in pages/ is one page, which fills in the
+// layout's "title" and "content" blocks, and "head" if it needs more in
+// the page's head. In dev mode (-dev) a page render first checks the
+// files' modification times and re-parses if any changed, so edits show
+// up without a restart.
+const templatesDir = "templates"
+
+type Registry struct {
+	files   fs.FS // rooted at templatesDir
+	dev     bool
+	pages   map[string]*template.Template // "companies.html" -> layout plus page
+	stamp   string                        // of the files parsed, in dev mode
+	lastErr error                         // from the latest re-parse, in dev mode
+	lock    sync.RWMutex
+}
+
+var templates *Registry
+
+// Functions the templates may call.
+var templateFuncs = template.FuncMap{
+	"field": newFormField, // see forms.go
+	"asset": func(name string) (string, error) { return assets.URL(name) }, // see assets.go
+}
+
+// An error page's data.
+type errorPage struct {
+	Status  int
+	Message string
+}
+
+func newRegistry(files fs.FS, dev bool) (*Registry, error) {
+	r := &Registry{files: files, dev: dev}
+	pages, err := r.parse()
+	if err != nil {
+		return nil, err
+	}
+	r.pages = pages
+	if dev {
+		r.stamp, _ = r.modStamp()
+	}
+	return r, nil
+}
+
+// Parse the layout and partials once, then clone them for each page.
+func (r *Registry) parse() (map[string]*template.Template, error) {
+	layout, err := template.New("base.html").Funcs(templateFuncs).ParseFS(r.files, "base.html", "partials/*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := fs.Glob(r.files, "pages/*.html")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no pages in " + templatesDir + "/pages")
+	}
+	pages := make(map[string]*template.Template)
+	for _, file := range files {
+		page, err := template.Must(layout.Clone()).ParseFS(r.files, file)
+		if err != nil {
+			return nil, err
+		}
+		pages[path.Base(file)] = page
+	}
+	return pages, nil
+}
+
+// In dev mode, re-parse if any file has changed since the last parse. A
+// failed re-parse keeps the pages as they were and is reported by render.
+func (r *Registry) refresh() {
+	stamp, err := r.modStamp()
+	r.lock.RLock()
+	same := err == nil && stamp == r.stamp
+	r.lock.RUnlock()
+	if same {
+		return
+	}
+
+	pages, err := r.parse()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stamp, r.lastErr = stamp, err
+	if err != nil {
+		notifyAndMaybeDie("Templates not reloaded: "+err.Error(), false)
+		return
+	}
+	r.pages = pages
+	log("templates reloaded")
+}
+
+// Every file's name, size and modification time, as one string.
+func (r *Registry) modStamp() (string, error) {
+	entries := []string{}
+	err := fs.WalkDir(r.files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, name+"|"+info.ModTime().Format(time.RFC3339Nano)+"|"+strconv.FormatInt(info.Size(), 10))
+		return nil
+	})
+	sort.Strings(entries)
+	return strings.Join(entries, "\n"), err
+}
+
+// The latest re-parse's error, for /readyz.
+func (r *Registry) check() error {
+	if r.dev {
+		r.refresh()
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.lastErr
+}
+
+// Render the page into a buffer first, so that a failure sends an error
+// page rather than half of the page.
+func (r *Registry) render(rw http.ResponseWriter, status int, name string, data interface{}) {
+	if r.dev {
+		r.refresh()
+	}
+	r.lock.RLock()
+	page, ok := r.pages[name]
+	lastErr := r.lastErr
+	r.lock.RUnlock()
+
+	var buffer bytes.Buffer
+	err := lastErr
+	if !ok {
+		err = errors.New("no page " + name)
+	} else if err == nil {
+		err = page.ExecuteTemplate(&buffer, "base.html", data)
+	}
+	if err != nil {
+		notifyAndMaybeDie("Cannot render "+name+": "+err.Error(), false)
+		msg := "Internal error."
+		if r.dev {
+			msg = err.Error()
+		}
+		http.Error(rw, msg, http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(status)
+	buffer.WriteTo(rw)
+}
+/****/
+
+/** rendering helpers **/
+
+func renderPage(rw http.ResponseWriter, name string, data interface{}) {
+	templates.render(rw, http.StatusOK, name, data)
+}
+
+func renderError(rw http.ResponseWriter, status int, msg string) {
+	templates.render(rw, status, "error.html", &errorPage{Status: status, Message: msg})
+}
+/****/
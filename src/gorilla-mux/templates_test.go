@@ -0,0 +1,183 @@
+package main
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// Every page renders in the shared layout, with its own title.
+func TestPages(t *testing.T) {
+	ts := newTestSite(t)
+	stylesheet, _ := assets.URL("site.css")
+
+	for _, c := range []struct {
+		path  string
+		want  int
+		title string
+		has   string // somewhere in the content
+	}{
+		{"/", http.StatusOK, "GoLang Server Demo", "/predictions"},
+		{"/home", http.StatusOK, "GoLang Server Demo", "/companies"},
+		{"/companies", http.StatusOK, "Companies", "Donnelly, Block and Runte"},
+		{"/companies/1", http.StatusOK, "Donnelly, Block and Runte", "Karlee Graham"},
+		{"/predictions", http.StatusOK, "Predictions", "Eryn Hackett"},
+		{"/predictions/1", http.StatusOK, "Saying of the day", "Realigned reciprocal concept"},
+		{"/predictions/new", http.StatusOK, "New prediction", `name = 'csrf_token'`},
+		{"/companies/1/edit", http.StatusOK, "Edit Donnelly, Block and Runte", "Karlee Graham"},
+		{"/companies/by-state", http.StatusOK, "Companies by state", "Oregon"},
+		{"/companies/by-state/OR", http.StatusOK, "Companies in Oregon", "/companies/8"},
+		{"/predictions/999", http.StatusNotFound, "Error 404", "No prediction 999."},
+		{"/companies/999", http.StatusNotFound, "Error 404", "No company 999."},
+		{"/predictions/999/edit", http.StatusNotFound, "Error 404", "No prediction 999."},
+	} {
+		response, body := ts.get(c.path)
+		expectStatus(t, c.path, response, c.want)
+		expect(t, c.path+" content type", response.Header.Get("Content-Type"), "text/html; charset=utf-8")
+		if !strings.Contains(body, "<title>"+c.title+"</title>") {
+			t.Errorf("%s: no title %q", c.path, c.title)
+		}
+		if !strings.Contains(body, c.has) {
+			t.Errorf("%s: no %q", c.path, c.has)
+		}
+		// The layout's stylesheet and the home partial, on every page.
+		if !strings.Contains(body, stylesheet) || !strings.Contains(body, `href = '/home'`) {
+			t.Errorf("%s: not in the layout", c.path)
+		}
+	}
+}
+
+// Data is escaped for where it lands in the page.
+func TestEscaping(t *testing.T) {
+	ts := newTestSite(t)
+	response, _ := ts.post("/predictions/new", url.Values{"predictor": {"<b>Mallory</b>"},
+		"prediction": {`<script>alert("x")</script> will win.`}})
+	expectStatus(t, "create", response, http.StatusSeeOther)
+
+	_, body := ts.get(response.Header.Get("Location"))
+	if strings.Contains(body, "<script>alert") || strings.Contains(body, "<b>Mallory") {
+		t.Errorf("unescaped: %s", body)
+	}
+	if !strings.Contains(body, "&lt;script&gt;") || !strings.Contains(body, "&lt;b&gt;Mallory") {
+		t.Errorf("not escaped as expected: %s", body)
+	}
+}
+
+func TestRegistryErrors(t *testing.T) {
+	good := fstest.MapFS{
+		"base.html":       {Data: []byte(`{{block "content" .}}{{end}}`)},
+		"partials/x.html": {Data: []byte(`{{define "x"}}x{{end}}`)},
+		"pages/page.html": {Data: []byte(`{{define "content"}}page{{end}}`)},
+	}
+	for _, c := range []struct {
+		name    string
+		file    string
+		content string // "" to leave the file out
+	}{
+		{"bad layout", "base.html", `{{block "content" .}}`},
+		{"bad partial", "partials/x.html", `{{define "x"}}`},
+		{"bad page", "pages/page.html", `{{if}}`},
+		{"unknown function", "pages/page.html", `{{define "content"}}{{nonesuch}}{{end}}`},
+		{"no pages", "pages/page.html", ""},
+	} {
+		files := fstest.MapFS{}
+		for name, f := range good {
+			files[name] = f
+		}
+		if c.content == "" {
+			delete(files, c.file)
+		} else {
+			files[c.file] = &fstest.MapFile{Data: []byte(c.content)}
+		}
+		if _, err := newRegistry(files, false); err == nil {
+			t.Errorf("%s: no error", c.name)
+		}
+	}
+
+	r, err := newRegistry(good, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	r.render(recorder, http.StatusOK, "nonesuch.html", nil)
+	expect(t, "unknown page", recorder.Code, http.StatusInternalServerError)
+	recorder = httptest.NewRecorder()
+	r.render(recorder, http.StatusTeapot, "page.html", nil)
+	expect(t, "status", recorder.Code, http.StatusTeapot)
+	expect(t, "page", recorder.Body.String(), "page")
+}
+
+// In dev mode an edit shows up on the next render; a broken edit keeps
+// the pages as they were, and fails the page and readiness until fixed.
+func TestDevReload(t *testing.T) {
+	dir := t.TempDir()
+	err := fs.WalkDir(embeddedFiles, templatesDir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		doc, err := fs.ReadFile(embeddedFiles, name)
+		if err != nil {
+			return err
+		}
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		return ioutil.WriteFile(file, doc, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRegistry(os.DirFS(filepath.Join(dir, templatesDir)), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := filepath.Join(dir, templatesDir, "pages", "error.html")
+	stamp := time.Now()
+	edit := func(content string) {
+		stamp = stamp.Add(time.Second) // whatever the file system's resolution
+		if err := ioutil.WriteFile(page, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(page, stamp, stamp)
+	}
+	render := func() (int, string) {
+		recorder := httptest.NewRecorder()
+		r.render(recorder, http.StatusNotFound, "error.html", &errorPage{Status: 404, Message: "Gone."})
+		return recorder.Code, recorder.Body.String()
+	}
+
+	code, body := render()
+	if code != http.StatusNotFound || !strings.Contains(body, "<h3>Gone.</h3>") {
+		t.Fatalf("before: %d %s", code, body)
+	}
+
+	edit(`{{define "content"}}<p class = 'edited'>{{.Message}}</p>{{end}}`)
+	code, body = render()
+	if code != http.StatusNotFound || !strings.Contains(body, "<p class = 'edited'>Gone.</p>") {
+		t.Errorf("after an edit: %d %s", code, body)
+	}
+
+	edit(`{{define "content"}}{{if}}{{end}}`)
+	code, body = render()
+	if code != http.StatusInternalServerError || !strings.Contains(body, "error.html") {
+		t.Errorf("after a broken edit: %d %s", code, body)
+	}
+	if r.check() == nil {
+		t.Error("check: no error after a broken edit")
+	}
+
+	edit(`{{define "content"}}<p>{{.Message}}</p>{{end}}`)
+	if err := r.check(); err != nil {
+		t.Errorf("check after the fix: %v", err)
+	}
+	if code, body = render(); !strings.Contains(body, "<p>Gone.</p>") {
+		t.Errorf("after the fix: %d %s", code, body)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+/** view models **/
+
+// Every page is built as a view model, and the same view model is then
+// rendered as the HTML page or, when the page's URL has ".json" or ".xml"
+// appended, as its JSON or XML twin: /companies.json, /predictions/3.xml,
+// /companies/by-state/OR.json and so on (see handlePage). The URLs inside
+// a view model are those of the HTML pages; append the suffix for a twin.
+
+// A link to another record.
+type Ref struct {
+	Id   int    `json:"id" xml:"id,attr"`
+	Name string `json:"name,omitempty" xml:",chardata"`
+	URL  string `json:"url" xml:"href,attr"`
+}
+
+type CompanyView struct {
+	Id              int    `json:"id" xml:"id,attr"`
+	URL             string `json:"url" xml:"href,attr"`
+	Name            string `json:"name" xml:"name"`
+	CEO             string `json:"ceo" xml:"ceo"`
+	Address1        string `json:"address1" xml:"address1"`
+	Address2        string `json:"address2" xml:"address2"`
+	City            string `json:"city,omitempty" xml:"city,omitempty"`
+	State           string `json:"state,omitempty" xml:"state,omitempty"`
+	StateName       string `json:"state_name,omitempty" xml:"state-name,omitempty"`
+	Zip             string `json:"zip,omitempty" xml:"zip,omitempty"`
+	Website         string `json:"website,omitempty" xml:"website,omitempty"`
+	Industry        string `json:"industry,omitempty" xml:"industry,omitempty"`
+	Founded         int    `json:"founded,omitempty" xml:"founded,omitempty"`
+	PredictionCount int    `json:"prediction_count" xml:"prediction-count"`
+}
+
+type SayingView struct {
+	Id         int    `json:"id" xml:"id,attr"`
+	URL        string `json:"url" xml:"href,attr"`
+	Predictor  string `json:"predictor" xml:"predictor"`
+	Prediction string `json:"prediction" xml:"text"`
+	Company    *Ref   `json:"company" xml:"company,omitempty"` // nil if none
+}
+
+// Companies grouped by state; Code is "" for those whose address was not
+// recognized (see Location).
+type StateView struct {
+	Code      string         `json:"code,omitempty" xml:"code,attr,omitempty"`
+	Name      string         `json:"name,omitempty" xml:"name,attr,omitempty"`
+	URL       string         `json:"url,omitempty" xml:"href,attr,omitempty"`
+	Companies []*CompanyView `json:"companies" xml:"company"`
+}
+
+// For the "sayings" partial, which leaves out the company column when
+// the page is about a single company, and has sortable headers when it
+// is one page of a Listing.
+type SayingsTable struct {
+	Predictions []*SayingView `json:"predictions" xml:"prediction"`
+	NoCompany   bool          `json:"-" xml:"-"`
+	Listing     *Listing      `json:"page,omitempty" xml:"page,omitempty"`
+}
+
+/****/
+
+/** pages **/
+
+// GET /home
+type HomePage struct {
+	XMLName xml.Name `json:"-" xml:"home"`
+	Links   []*Link  `json:"links" xml:"link"`
+}
+
+type Link struct {
+	Rel string `json:"rel" xml:"rel,attr"`
+	URL string `json:"url" xml:"href,attr"`
+}
+
+// GET /companies
+type CompaniesPage struct {
+	XMLName   xml.Name       `json:"-" xml:"companies"`
+	Companies []*CompanyView `json:"companies" xml:"company"`
+	Listing   *Listing       `json:"page" xml:"page"`
+}
+
+// GET /companies/{id}
+type CompanyPage struct {
+	XMLName xml.Name `json:"-" xml:"company"`
+	*CompanyView
+	SayingsTable
+}
+
+// GET /predictions
+type PredictionsPage struct {
+	XMLName xml.Name `json:"-" xml:"predictions"`
+	SayingsTable
+}
+
+// GET /predictions/{id}, with its neighbours in id order.
+type PredictionPage struct {
+	XMLName xml.Name `json:"-" xml:"prediction"`
+	*SayingView
+	Prev *Ref `json:"prev,omitempty" xml:"prev,omitempty"`
+	Next *Ref `json:"next,omitempty" xml:"next,omitempty"`
+}
+
+// GET /companies/by-state
+type StatesPage struct {
+	XMLName xml.Name     `json:"-" xml:"states"`
+	States  []*StateView `json:"states" xml:"state"`
+}
+
+// GET /companies/by-state/{st}
+type StatePage struct {
+	XMLName xml.Name `json:"-" xml:"state"`
+	*StateView
+}
+
+/****/
+
+/** building view models **/
+
+func companyView(c *Company) *CompanyView {
+	loc := c.Location()
+	return &CompanyView{Id: c.Id, URL: "/companies/" + strconv.Itoa(c.Id),
+		Name: c.Name, CEO: c.CEO, Address1: c.Address1, Address2: c.Address2,
+		City: loc.City, State: loc.State, StateName: loc.StateName(), Zip: loc.Zip,
+		Website: c.Website, Industry: c.Industry, Founded: c.Founded,
+		PredictionCount: len(c.Sayings())}
+}
+
+func companyViews(companies []*Company) []*CompanyView {
+	views := []*CompanyView{}
+	for _, c := range companies {
+		views = append(views, companyView(c))
+	}
+	return views
+}
+
+func companyRef(c *Company) *Ref {
+	return &Ref{Id: c.Id, Name: c.Name, URL: "/companies/" + strconv.Itoa(c.Id)}
+}
+
+func sayingView(s *Saying) *SayingView {
+	v := &SayingView{Id: s.Id, URL: "/predictions/" + strconv.Itoa(s.Id),
+		Predictor: s.Predictor, Prediction: s.Prediction}
+	if c := s.Company(); c != nil {
+		v.Company = companyRef(c)
+	}
+	return v
+}
+
+func sayingViews(sayings []*Saying) []*SayingView {
+	views := []*SayingView{}
+	for _, s := range sayings {
+		views = append(views, sayingView(s))
+	}
+	return views
+}
+
+func sayingRef(s *Saying) *Ref {
+	return &Ref{Id: s.Id, Name: s.Predictor, URL: "/predictions/" + strconv.Itoa(s.Id)}
+}
+
+/****/
+
+/** formats **/
+
+// "json" or "xml" for a twin's URL, else "html".
+func formatOf(r *http.Request) string {
+	switch path.Ext(r.URL.Path) {
+	case ".json":
+		return "json"
+	case ".xml":
+		return "xml"
+	}
+	return "html"
+}
+
+// Send the view model in the format asked for; page is its template.
+func present(rw http.ResponseWriter, r *http.Request, page string, view interface{}) {
+	switch formatOf(r) {
+	case "json":
+		sendJSON(rw, http.StatusOK, view)
+	case "xml":
+		sendXML(rw, http.StatusOK, view)
+	default:
+		renderPage(rw, page, view)
+	}
+}
+
+func presentError(rw http.ResponseWriter, r *http.Request, status int, msg string) {
+	switch formatOf(r) {
+	case "json":
+		sendJSONError(rw, status, msg)
+	case "xml":
+		sendXML(rw, status, &xmlError{Message: msg})
+	default:
+		renderError(rw, status, msg)
+	}
+}
+
+type xmlError struct {
+	XMLName xml.Name `xml:"error"`
+	Message string   `xml:",chardata"`
+}
+
+func sendXML(rw http.ResponseWriter, status int, v interface{}) {
+	doc, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		notifyAndMaybeDie("error: "+err.Error(), false)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	rw.WriteHeader(status)
+	rw.Write([]byte(xml.Header))
+	rw.Write(doc)
+}
+
+/****/
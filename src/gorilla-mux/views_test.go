@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Each page's JSON and XML twins carry the same view model, and so the
+// same data as the HTML page.
+func TestTwins(t *testing.T) {
+	ts := newTestSite(t)
+	for _, c := range []struct {
+		path string
+		root string // the XML document element
+		page func() interface{}
+		has  string // in the HTML page and both twins
+	}{
+		{"/home", "home", func() interface{} { return &HomePage{} }, "/companies/by-state"},
+		{"/companies", "companies", func() interface{} { return &CompaniesPage{} }, "Bode, Purdy and Schumm"},
+		{"/companies?sort=ceo&per=3&page=2", "companies", func() interface{} { return &CompaniesPage{} }, "Dessie Kovacek"},
+		{"/companies/1", "company", func() interface{} { return &CompanyPage{} }, "Realigned reciprocal concept"},
+		{"/predictions", "predictions", func() interface{} { return &PredictionsPage{} }, "Presley Boehm"},
+		{"/predictions/8", "prediction", func() interface{} { return &PredictionPage{} }, "Kessler-Tillman"},
+		{"/companies/by-state", "states", func() interface{} { return &StatesPage{} }, "American Samoa"},
+		{"/companies/by-state/OR", "state", func() interface{} { return &StatePage{} }, "Kessler-Tillman"},
+	} {
+		path, query := c.path, ""
+		if i := strings.Index(path, "?"); i >= 0 {
+			path, query = path[:i], path[i:]
+		}
+		_, html := ts.get(c.path)
+		if !strings.Contains(html, c.has) {
+			t.Errorf("%s: no %q", c.path, c.has)
+		}
+
+		response, doc := ts.get(path + ".json" + query)
+		expectStatus(t, path+".json", response, http.StatusOK)
+		expect(t, path+".json content type", response.Header.Get("Content-Type"), "application/json")
+		fromJSON := c.page()
+		if err := json.Unmarshal([]byte(doc), fromJSON); err != nil {
+			t.Fatalf("%s.json: %v", path, err)
+		}
+
+		response, doc = ts.get(path + ".xml" + query)
+		expectStatus(t, path+".xml", response, http.StatusOK)
+		expect(t, path+".xml content type", response.Header.Get("Content-Type"), "application/xml; charset=utf-8")
+		if !strings.HasPrefix(doc, xml.Header+"<"+c.root) {
+			t.Errorf("%s.xml: want a <%s> document: %.80s", path, c.root, doc)
+		}
+		fromXML := c.page()
+		if err := xml.Unmarshal([]byte(doc), fromXML); err != nil {
+			t.Fatalf("%s.xml: %v", path, err)
+		}
+
+		// Compared as JSON, which leaves out the XML element names.
+		a, _ := json.Marshal(fromJSON)
+		b, _ := json.Marshal(fromXML)
+		if string(a) != string(b) {
+			t.Errorf("%s: the twins differ:\nJSON %s\nXML  %s", c.path, a, b)
+		}
+		if !strings.Contains(string(a), c.has) {
+			t.Errorf("%s: no %q in the twins", c.path, c.has)
+		}
+	}
+}
+
+// A missing record is a 404 in the page's own format.
+func TestTwinErrors(t *testing.T) {
+	ts := newTestSite(t)
+	for _, c := range []struct {
+		path        string
+		want        int
+		contentType string
+		body        string
+	}{
+		{"/predictions/99", http.StatusNotFound, "text/html; charset=utf-8", "<h3>No prediction 99.</h3>"},
+		{"/predictions/99.json", http.StatusNotFound, "application/json", `{"Error":"No prediction 99."}`},
+		{"/predictions/99.xml", http.StatusNotFound, "application/xml; charset=utf-8", "<error>No prediction 99.</error>"},
+		{"/companies/99.json", http.StatusNotFound, "application/json", `{"Error":"No company 99."}`},
+		{"/companies/99.xml", http.StatusNotFound, "application/xml; charset=utf-8", "<error>No company 99.</error>"},
+		{"/companies/by-state/ZZ.json", http.StatusNotFound, "application/json", `{"Error":"No state ZZ."}`},
+		{"/companies/by-state/ZZ.xml", http.StatusNotFound, "application/xml; charset=utf-8", "<error>No state ZZ.</error>"},
+		{"/predictions.yaml", http.StatusNotFound, "", ""},
+	} {
+		response, body := ts.get(c.path)
+		expectStatus(t, c.path, response, c.want)
+		if c.contentType != "" {
+			expect(t, c.path+" content type", response.Header.Get("Content-Type"), c.contentType)
+		}
+		if !strings.Contains(body, c.body) {
+			t.Errorf("%s: no %q in %s", c.path, c.body, body)
+		}
+	}
+}
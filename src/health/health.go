@@ -0,0 +1,184 @@
+// Package health serves /healthz and /readyz for the demo services.
+// Liveness checks say whether the process is still working at all (a
+// wedged store lock, say); readiness checks add whatever it needs to serve
+// traffic, such as readable data files, and fail once draining starts so
+// that a load balancer stops sending requests before the server exits.
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Set at link time: go build -ldflags "-X health.Version=1.4.0"
+var Version = "dev"
+
+// How long a single check may take before it counts as failed.
+const checkTimeout = 2 * time.Second
+
+type Checker struct {
+	live     []check
+	ready    []check
+	draining bool
+	started  time.Time
+	lock     sync.RWMutex
+}
+
+type check struct {
+	name string
+	fn   func() error
+}
+
+// The body of /healthz and /readyz.
+type Report struct {
+	Status   string // "ok" or "failing"
+	Draining bool
+	Uptime   string
+	Build    Build
+	Checks   []Result
+}
+
+type Result struct {
+	Name     string
+	OK       bool
+	Error    string `json:",omitempty"`
+	Duration string
+}
+
+type Build struct {
+	Version   string
+	GoVersion string
+	Revision  string `json:",omitempty"` // VCS details, when the build recorded them
+	Time      string `json:",omitempty"`
+	Modified  bool   `json:",omitempty"`
+}
+
+func New() *Checker {
+	return &Checker{started: time.Now()}
+}
+
+// Register a liveness check; readiness runs it too.
+func (c *Checker) Live(name string, fn func() error) {
+	c.lock.Lock()
+	c.live = append(c.live, check{name, fn})
+	c.lock.Unlock()
+}
+
+// Register a readiness check.
+func (c *Checker) Ready(name string, fn func() error) {
+	c.lock.Lock()
+	c.ready = append(c.ready, check{name, fn})
+	c.lock.Unlock()
+}
+
+// Start failing readiness, for good.
+func (c *Checker) Drain() {
+	c.lock.Lock()
+	c.draining = true
+	c.lock.Unlock()
+}
+
+func (c *Checker) Draining() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.draining
+}
+
+// GET /healthz
+func (c *Checker) Healthz(rw http.ResponseWriter, r *http.Request) {
+	c.lock.RLock()
+	checks := append([]check{}, c.live...)
+	c.lock.RUnlock()
+
+	c.serve(rw, c.run(checks, false))
+}
+
+// GET /readyz
+func (c *Checker) Readyz(rw http.ResponseWriter, r *http.Request) {
+	c.lock.RLock()
+	checks := append(append([]check{}, c.live...), c.ready...)
+	c.lock.RUnlock()
+
+	c.serve(rw, c.run(checks, true))
+}
+
+// Draining fails readiness but not liveness.
+func (c *Checker) run(checks []check, readiness bool) *Report {
+	report := &Report{Status: "ok", Draining: c.Draining(), Build: build(),
+		Uptime: time.Since(c.started).Round(time.Second).String(), Checks: []Result{}}
+	if readiness && report.Draining {
+		report.Status = "failing"
+	}
+
+	for _, ch := range checks {
+		start := time.Now()
+		err := runWithTimeout(ch.fn)
+		res := Result{Name: ch.name, OK: err == nil, Duration: time.Since(start).String()}
+		if err != nil {
+			res.Error = err.Error()
+			report.Status = "failing"
+		}
+		report.Checks = append(report.Checks, res)
+	}
+	return report
+}
+
+func (c *Checker) serve(rw http.ResponseWriter, report *Report) {
+	doc, _ := json.MarshalIndent(report, "", " ")
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	if report.Status != "ok" {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+	rw.Write(doc)
+}
+
+// A check that never returns (on a deadlocked mutex, say) is abandoned
+// and reported as failed.
+func runWithTimeout(fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(checkTimeout):
+		return errors.New("timed out after " + checkTimeout.String())
+	}
+}
+
+func build() Build {
+	b := Build{Version: Version, GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.time":
+			b.Time = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+// A check that the named file exists and can be opened for reading.
+func Readable(file_name string) func() error {
+	return func() error {
+		f, err := os.Open(file_name)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+}
@@ -0,0 +1,3 @@
+module mgu
+
+go 1.25.0
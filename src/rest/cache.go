@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Encoded list responses, keyed by path and query. Any change to the store
+// empties the cache (see GlobalState.changed), so entries are never stale.
+type ResponseCache struct {
+	entries    map[string]*cacheEntry
+	generation int // bumped on every flush
+	lock       sync.Mutex
+}
+
+// One encoded response, compressed lazily per encoding on first demand.
+type cacheEntry struct {
+	contentType string
+	body        []byte
+	encoded     map[string][]byte // "gzip" or "br" -> compressed body
+	lock        sync.Mutex
+}
+
+func newResponseCache() *ResponseCache {
+	return &ResponseCache{entries: make(map[string]*cacheEntry)}
+}
+
+// Drop every entry. Responses being built while this happens are not cached.
+func (rc *ResponseCache) flush() {
+	rc.lock.Lock()
+	rc.entries = make(map[string]*cacheEntry)
+	rc.generation++
+	rc.lock.Unlock()
+}
+
+// Wrap a list handler: answer conditional GETs with 304, serve the cached
+// body if there is one, and compress according to Accept-Encoding.
+func (gs *GlobalState) cached(handler http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		if gs.shutDown.Load() { return }
+
+		modified := gs.lastModified()
+		response.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		response.Header().Add("Vary", "Accept-Encoding")
+		if since, err := http.ParseTime(request.Header.Get("If-Modified-Since")); err == nil {
+			if !modified.Truncate(time.Second).After(since) {
+				response.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		key := cacheKey(request)
+		gs.cache.lock.Lock()
+		entry := gs.cache.entries[key]
+		generation := gs.cache.generation
+		gs.cache.lock.Unlock()
+
+		if entry == nil {
+			rec := &recorder{header: make(http.Header), status: http.StatusOK}
+			handler(rec, request)
+			if rec.status != http.StatusOK {
+				copyHeader(response.Header(), rec.header)
+				response.WriteHeader(rec.status)
+				response.Write(rec.body.Bytes())
+				return
+			}
+
+			entry = &cacheEntry{
+				contentType: rec.header.Get("Content-Type"),
+				body:        rec.body.Bytes(),
+				encoded:     make(map[string][]byte)}
+			if entry.contentType == "" {
+				entry.contentType = http.DetectContentType(entry.body)
+			}
+
+			gs.cache.lock.Lock()
+			if generation == gs.cache.generation {
+				gs.cache.entries[key] = entry
+			}
+			gs.cache.lock.Unlock()
+		}
+
+		response.Header().Set("Content-Type", entry.contentType)
+		encoding := negotiateEncoding(request.Header.Get("Accept-Encoding"))
+		body := entry.body
+		if encoding != "" {
+			body = entry.compressed(encoding)
+			response.Header().Set("Content-Encoding", encoding)
+		}
+		response.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		response.Write(body)
+	}
+}
+
+func (e *cacheEntry) compressed(encoding string) []byte {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if body, ok := e.encoded[encoding]; ok {
+		return body
+	}
+
+	var buffer bytes.Buffer
+	if encoding == "br" {
+		w := brotli.NewWriterLevel(&buffer, brotli.DefaultCompression)
+		w.Write(e.body)
+		w.Close()
+	} else {
+		w := gzip.NewWriter(&buffer)
+		w.Write(e.body)
+		w.Close()
+	}
+	e.encoded[encoding] = buffer.Bytes()
+	return e.encoded[encoding]
+}
+
+// Path plus the query parameters in a canonical order.
+func cacheKey(request *http.Request) string {
+	query := request.URL.Query()
+	names := []string{}
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	key := request.URL.Path
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		key += "&" + name + "=" + strings.Join(values, ",")
+	}
+	return key
+}
+
+// Pick br or gzip, whichever the client weights higher (br on a tie), or
+// "" for no compression.
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, _ = strconv.ParseFloat(param[2:], 64)
+			}
+		}
+		if coding == "*" {
+			coding = "br"
+		}
+		if (coding != "br" && coding != "gzip") || q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && coding == "br") {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// Captures what a handler writes so that it can be cached.
+type recorder struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+func (r *recorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *recorder) WriteHeader(status int) { r.status = status }
+
+func copyHeader(to http.Header, from http.Header) {
+	for k, v := range from {
+		to[k] = v
+	}
+}
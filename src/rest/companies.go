@@ -0,0 +1,67 @@
+package main
+
+import (
+	"datafiles"
+	"errors"
+	"io/fs"
+	"log"
+	"sort"
+)
+
+const (
+	companiesFile   = "companies.csv"
+	legacyCompanies = "companies.db"
+)
+
+// A Company, as listed in companies.csv (see datafiles.ParseCompanies).
+// Sayings point at their company through Saying.CompanyId.
+type Company struct {
+	Id       int
+	CEO      string
+	Name     string
+	Address1 string
+	Address2 string
+	Website  string
+	Industry string
+	Founded  int
+}
+
+// Read companies.csv, first migrating a legacy companies.db to it, as
+// gorilla-mux does, if either file is there. The companies are optional.
+// Caller holds the lock.
+func (gs *GlobalState) loadCompanies() error {
+	records, _, migrated, err := datafiles.LoadCompanies(gs.path(companiesFile), gs.path(legacyCompanies))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if migrated {
+		log.Println("Migrated " + legacyCompanies + " to " + companiesFile + ".")
+	}
+	for _, r := range records {
+		gs.companies[r.Id] = &Company{Id: r.Id, CEO: r.CEO, Name: r.Name, Address1: r.Address1,
+			Address2: r.Address2, Website: r.Website, Industry: r.Industry, Founded: r.Founded}
+	}
+	return nil
+}
+
+func (gs *GlobalState) ListifyCompanies() []*Company {
+	list := []*Company{}
+
+	gs.lock.RLock()
+	for _, c := range gs.companies {
+		list = append(list, c)
+	}
+	gs.lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	return list
+}
+
+func (gs *GlobalState) readCompany(id int) *Company {
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+	return gs.companies[id]
+}
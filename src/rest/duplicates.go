@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// What SayingCreate does with a new Saying that matches an existing one
+// (-dup-policy): refuse it, create it but say so, or hand back the match.
+const (
+	policyReject = "reject"
+	policyWarn   = "warn"
+	policyMerge  = "merge"
+)
+
+const (
+	shingleSize = 4  // characters of normalized text
+	minHashSize = 64 // hash functions per signature
+)
+
+// An existing Saying that a prediction matches. Exact means the two are
+// the same once normalized.
+type Duplicate struct {
+	SayingId   int
+	Similarity float64
+	Exact      bool
+}
+
+type duplicateError struct{ dup *Duplicate }
+
+func (e duplicateError) Error() string {
+	if e.dup.Exact {
+		return fmt.Sprintf("Duplicate of Saying %d", e.dup.SayingId)
+	}
+	return fmt.Sprintf("Near-duplicate of Saying %d (similarity %.2f)", e.dup.SayingId, e.dup.Similarity)
+}
+
+// One row of the /sayings/duplicates report: a Saying and the closest
+// earlier Saying it duplicates.
+type DuplicatePair struct {
+	SayingId    int
+	DuplicateOf int
+	Similarity  float64
+	Exact       bool
+}
+
+// GET /sayings/duplicates[?threshold=0.7][&format=xml]
+func (gs *GlobalState) SayingsDuplicates(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	threshold := gs.config.DupThreshold
+	if t := request.FormValue("threshold"); t != "" {
+		f, err := strconv.ParseFloat(t, 64)
+		if err != nil || f <= 0 || f > 1 {
+			sendStatus(response, http.StatusBadRequest, fmt.Errorf("Bad threshold %q", t))
+			return
+		}
+		threshold = f
+	}
+
+	gs.sendFormatted(response, request, gs.ListifyDuplicates(threshold))
+	log.Println("/sayings/duplicates")
+}
+
+// Pair each Saying with its closest match among those created before it.
+func (gs *GlobalState) ListifyDuplicates(threshold float64) []*DuplicatePair {
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+
+	ids := gs.sortedIds()
+	pairs := []*DuplicatePair{}
+	for i, id := range ids {
+		if dup := gs.closest(gs.sayings[id].Prediction, ids[:i], threshold); dup != nil {
+			pairs = append(pairs, &DuplicatePair{SayingId: id, DuplicateOf: dup.SayingId,
+				Similarity: dup.Similarity, Exact: dup.Exact})
+		}
+	}
+	return pairs
+}
+
+// The existing Saying closest to prediction, if it is at least as similar
+// as -dup-threshold. Caller holds the lock.
+func (gs *GlobalState) findDuplicate(prediction string, skipId int) *Duplicate {
+	ids := []int{}
+	for _, id := range gs.sortedIds() {
+		if id != skipId {
+			ids = append(ids, id)
+		}
+	}
+	return gs.closest(prediction, ids, gs.config.DupThreshold)
+}
+
+// An exact match wins outright, the lowest id first. Otherwise MinHash
+// signatures pick out likely candidates, whose similarity is then computed
+// exactly. Caller holds the lock.
+func (gs *GlobalState) closest(prediction string, ids []int, threshold float64) *Duplicate {
+	text := normalizeText(prediction)
+	sig := minHash(text)
+
+	var best *Duplicate
+	for _, id := range ids {
+		other := normalizeText(gs.sayings[id].Prediction)
+		if other == text {
+			return &Duplicate{SayingId: id, Similarity: 1, Exact: true}
+		}
+		// The estimate is rough for short texts, hence the slack.
+		if estimate(sig, gs.signatures.of(id, other)) < threshold-0.2 {
+			continue
+		}
+		sim := jaccard(shingles(text), shingles(other))
+		if sim >= threshold && (best == nil || sim > best.Similarity) {
+			best = &Duplicate{SayingId: id, Similarity: sim}
+		}
+	}
+	return best
+}
+
+// Caller holds the lock.
+func (gs *GlobalState) sortedIds() []int {
+	ids := make([]int, 0, len(gs.sayings))
+	for id := range gs.sayings {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+//** similarity
+// Lower case, letters and digits only, single spaces between words: so
+// "Email is dead!" and "email  is DEAD" are the same saying.
+func normalizeText(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// The set of overlapping shingleSize-character runs in text.
+func shingles(text string) map[string]bool {
+	runes := []rune(text)
+	set := make(map[string]bool)
+	if len(runes) <= shingleSize {
+		set[text] = true
+		return set
+	}
+	for i := 0; i+shingleSize <= len(runes); i++ {
+		set[string(runes[i:i+shingleSize])] = true
+	}
+	return set
+}
+
+func jaccard(a map[string]bool, b map[string]bool) float64 {
+	common := 0
+	for s := range a {
+		if b[s] {
+			common++
+		}
+	}
+	union := len(a) + len(b) - common
+	if union == 0 {
+		return 0
+	}
+	return float64(common) / float64(union)
+}
+
+// The MinHash signatures of the stored Sayings, by id, since the same
+// sayings are compared on every create. An edit or deletion evicts the
+// Saying's entry (see forget); a reload empties the cache. Its own lock,
+// since lookups fill it under the store's read lock.
+type signatureCache struct {
+	sigs map[int][]uint64
+	lock sync.Mutex
+}
+
+func newSignatureCache() *signatureCache {
+	return &signatureCache{sigs: make(map[int][]uint64)}
+}
+
+// The signature of Saying id, whose normalized text is text.
+func (c *signatureCache) of(id int, text string) []uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if sig, ok := c.sigs[id]; ok {
+		return sig
+	}
+	sig := minHash(text)
+	c.sigs[id] = sig
+	return sig
+}
+
+// An event listener: drop the signature of an edited or deleted Saying.
+func (c *signatureCache) forget(e SayingEvent) {
+	if e.Kind == EventCreated { return }
+
+	c.lock.Lock()
+	delete(c.sigs, e.Saying.Id)
+	c.lock.Unlock()
+}
+
+func (c *signatureCache) reset() {
+	c.lock.Lock()
+	c.sigs = make(map[int][]uint64)
+	c.lock.Unlock()
+}
+
+// The MinHash signature of normalized text.
+func minHash(text string) []uint64 {
+	sig := make([]uint64, minHashSize)
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	for s := range shingles(text) {
+		h := fnv.New64a()
+		h.Write([]byte(s))
+		base := h.Sum64()
+		for i := range sig {
+			if v := mix(base ^ uint64(i)*0x9e3779b97f4a7c15); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// The fraction of matching minimums estimates the Jaccard similarity.
+func estimate(a []uint64, b []uint64) float64 {
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
+
+// A 64-bit finalizer (from MurmurHash3), so that each seed gives an
+// independent-looking permutation.
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
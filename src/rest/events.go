@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// Kinds of change to a Saying.
+const (
+	EventCreated = "created"
+	EventEdited  = "edited"
+	EventDeleted = "deleted"
+)
+
+// A change to the store, as seen by watchers. Saying is a resolved copy;
+// for a deletion it is the Saying as it was.
+type SayingEvent struct {
+	Kind   string
+	Saying Saying
+}
+
+// Fans store changes out to every subscriber. Publishing never blocks: a
+// subscriber that falls a full buffer behind misses events. Listeners, by
+// contrast, are called synchronously and so see every event; they must be
+// quick.
+type EventHub struct {
+	subscribers map[chan SayingEvent]bool
+	listeners   []func(SayingEvent)
+	lock        sync.Mutex
+}
+
+func newEventHub() *EventHub {
+	return &EventHub{subscribers: make(map[chan SayingEvent]bool)}
+}
+
+// Subscribe returns a channel of events and a function that unsubscribes
+// and closes the channel.
+func (h *EventHub) subscribe() (<-chan SayingEvent, func()) {
+	ch := make(chan SayingEvent, 64)
+	h.lock.Lock()
+	h.subscribers[ch] = true
+	h.lock.Unlock()
+
+	cancel := func() {
+		h.lock.Lock()
+		if h.subscribers[ch] {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+		h.lock.Unlock()
+	}
+	return ch, cancel
+}
+
+func (h *EventHub) listen(fn func(SayingEvent)) {
+	h.lock.Lock()
+	h.listeners = append(h.listeners, fn)
+	h.lock.Unlock()
+}
+
+func (h *EventHub) publish(e SayingEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, fn := range h.listeners {
+		fn(e)
+	}
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+			log.Println("Watcher too slow; dropped", e.Kind, "event for Saying", e.Saying.Id)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// POST /graphql: sayings, predictors and companies with their links. The
+// mutations go through the same store operations as the HTTP handlers.
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	sayings(predictor: String, predictorId: Int, companyId: Int, contains: String,
+		first: Int = 20, offset: Int = 0): SayingPage!
+	saying(id: Int!): Saying
+	predictors(name: String, first: Int = 20, offset: Int = 0): PredictorPage!
+	predictor(id: Int!): Predictor
+	companies(name: String, first: Int = 20, offset: Int = 0): CompanyPage!
+	company(id: Int!): Company
+}
+
+type Mutation {
+	createSaying(prediction: String!, predictor: String, predictorId: Int): Saying!
+	editSaying(id: Int!, prediction: String, predictor: String, predictorId: Int): Saying!
+	deleteSaying(id: Int!): Boolean!
+}
+
+type Saying {
+	id: Int!
+	prediction: String!
+	predictor: Predictor
+	company: Company
+	tags: [String!]!
+}
+
+type Predictor {
+	id: Int!
+	name: String!
+	affiliation: String!
+	bio: String!
+	sayings: [Saying!]!
+}
+
+type Company {
+	id: Int!
+	name: String!
+	ceo: String!
+	address1: String!
+	address2: String!
+	website: String!
+	industry: String!
+	founded: Int!
+	sayings: [Saying!]!
+}
+
+type SayingPage {
+	totalCount: Int!
+	hasNextPage: Boolean!
+	items: [Saying!]!
+}
+
+type PredictorPage {
+	totalCount: Int!
+	hasNextPage: Boolean!
+	items: [Predictor!]!
+}
+
+type CompanyPage {
+	totalCount: Int!
+	hasNextPage: Boolean!
+	items: [Company!]!
+}
+`
+
+const maxPageSize = 100
+
+func (gs *GlobalState) graphqlHandler() http.Handler {
+	schema := graphql.MustParseSchema(graphqlSchema, &gqlResolver{gs})
+	handler := &relay.Handler{Schema: schema}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if gs.shutDown.Load() { return }
+
+		handler.ServeHTTP(response, request)
+		log.Println("/graphql")
+	})
+}
+
+//** root resolvers
+type gqlResolver struct{ gs *GlobalState }
+
+type pageArgs struct {
+	First  int32
+	Offset int32
+}
+
+func (r *gqlResolver) Sayings(args struct {
+	Predictor   *string
+	PredictorId *int32
+	CompanyId   *int32
+	Contains    *string
+	pageArgs
+}) *sayingPage {
+	matches := []*Saying{}
+	for _, s := range r.gs.ListifySayings() {
+		if args.Predictor != nil && !containsFold(s.Predictor, *args.Predictor) { continue }
+		if args.PredictorId != nil && s.PredictorId != int(*args.PredictorId) { continue }
+		if args.CompanyId != nil && s.CompanyId != int(*args.CompanyId) { continue }
+		if args.Contains != nil && !containsFold(s.Prediction, *args.Contains) { continue }
+		matches = append(matches, s)
+	}
+
+	lo, hi := pageBounds(len(matches), args.pageArgs)
+	page := &sayingPage{total: len(matches), more: hi < len(matches)}
+	for _, s := range matches[lo:hi] {
+		page.items = append(page.items, &sayingResolver{r.gs, s})
+	}
+	return page
+}
+
+func (r *gqlResolver) Saying(args struct{ Id int32 }) *sayingResolver {
+	if s := r.gs.readSaying(int(args.Id)); s != nil {
+		return &sayingResolver{r.gs, s}
+	}
+	return nil
+}
+
+func (r *gqlResolver) Predictors(args struct {
+	Name *string
+	pageArgs
+}) *predictorPage {
+	matches := []*Predictor{}
+	for _, p := range r.gs.ListifyPredictors() {
+		if args.Name == nil || containsFold(p.Name, *args.Name) {
+			matches = append(matches, p)
+		}
+	}
+
+	lo, hi := pageBounds(len(matches), args.pageArgs)
+	page := &predictorPage{total: len(matches), more: hi < len(matches)}
+	for _, p := range matches[lo:hi] {
+		page.items = append(page.items, &predictorResolver{r.gs, p})
+	}
+	return page
+}
+
+func (r *gqlResolver) Predictor(args struct{ Id int32 }) *predictorResolver {
+	if p := r.gs.readPredictor(int(args.Id)); p != nil {
+		return &predictorResolver{r.gs, p}
+	}
+	return nil
+}
+
+func (r *gqlResolver) Companies(args struct {
+	Name *string
+	pageArgs
+}) *companyPage {
+	matches := []*Company{}
+	for _, c := range r.gs.ListifyCompanies() {
+		if args.Name == nil || containsFold(c.Name, *args.Name) {
+			matches = append(matches, c)
+		}
+	}
+
+	lo, hi := pageBounds(len(matches), args.pageArgs)
+	page := &companyPage{total: len(matches), more: hi < len(matches)}
+	for _, c := range matches[lo:hi] {
+		page.items = append(page.items, &companyResolver{r.gs, c})
+	}
+	return page
+}
+
+func (r *gqlResolver) Company(args struct{ Id int32 }) *companyResolver {
+	if c := r.gs.readCompany(int(args.Id)); c != nil {
+		return &companyResolver{r.gs, c}
+	}
+	return nil
+}
+
+type sayingArgs struct {
+	Prediction  *string
+	Predictor   *string
+	PredictorId *int32
+}
+
+func (r *gqlResolver) CreateSaying(args struct {
+	Prediction  string
+	Predictor   *string
+	PredictorId *int32
+}) (*sayingResolver, error) {
+	created, err := r.gs.CreateSaying(args.Prediction, deref(args.Predictor), int(derefInt(args.PredictorId)))
+	if err != nil {
+		return nil, err
+	}
+	return &sayingResolver{r.gs, created.Saying}, nil
+}
+
+func (r *gqlResolver) EditSaying(args struct {
+	Id int32
+	sayingArgs
+}) (*sayingResolver, error) {
+	s, err := r.gs.EditSaying(int(args.Id), deref(args.Prediction), deref(args.Predictor),
+		int(derefInt(args.PredictorId)))
+	if err != nil {
+		return nil, err
+	}
+	return &sayingResolver{r.gs, s}, nil
+}
+
+func (r *gqlResolver) DeleteSaying(args struct{ Id int32 }) (bool, error) {
+	if err := r.gs.DeleteSaying(int(args.Id)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//** type resolvers
+type sayingResolver struct {
+	gs *GlobalState
+	s  *Saying
+}
+
+func (r *sayingResolver) Id() int32          { return int32(r.s.Id) }
+func (r *sayingResolver) Prediction() string { return r.s.Prediction }
+
+func (r *sayingResolver) Tags() []string {
+	if r.s.Tags == nil {
+		return []string{}
+	}
+	return r.s.Tags
+}
+
+func (r *sayingResolver) Predictor() *predictorResolver {
+	if p := r.gs.readPredictor(r.s.PredictorId); p != nil {
+		return &predictorResolver{r.gs, p}
+	}
+	return nil
+}
+
+func (r *sayingResolver) Company() *companyResolver {
+	if c := r.gs.readCompany(r.s.CompanyId); c != nil {
+		return &companyResolver{r.gs, c}
+	}
+	return nil
+}
+
+type predictorResolver struct {
+	gs *GlobalState
+	p  *Predictor
+}
+
+func (r *predictorResolver) Id() int32           { return int32(r.p.Id) }
+func (r *predictorResolver) Name() string        { return r.p.Name }
+func (r *predictorResolver) Affiliation() string { return r.p.Affiliation }
+func (r *predictorResolver) Bio() string         { return r.p.Bio }
+
+func (r *predictorResolver) Sayings() []*sayingResolver {
+	return sayingResolvers(r.gs, r.gs.SayingsBy(r.p.Id))
+}
+
+type companyResolver struct {
+	gs *GlobalState
+	c  *Company
+}
+
+func (r *companyResolver) Id() int32        { return int32(r.c.Id) }
+func (r *companyResolver) Name() string     { return r.c.Name }
+func (r *companyResolver) CEO() string      { return r.c.CEO }
+func (r *companyResolver) Address1() string { return r.c.Address1 }
+func (r *companyResolver) Address2() string { return r.c.Address2 }
+func (r *companyResolver) Website() string  { return r.c.Website }
+func (r *companyResolver) Industry() string { return r.c.Industry }
+func (r *companyResolver) Founded() int32   { return int32(r.c.Founded) }
+
+func (r *companyResolver) Sayings() []*sayingResolver {
+	list := []*Saying{}
+	for _, s := range r.gs.ListifySayings() {
+		if s.CompanyId == r.c.Id {
+			list = append(list, s)
+		}
+	}
+	return sayingResolvers(r.gs, list)
+}
+
+type sayingPage struct {
+	total int
+	more  bool
+	items []*sayingResolver
+}
+
+func (p *sayingPage) TotalCount() int32         { return int32(p.total) }
+func (p *sayingPage) HasNextPage() bool         { return p.more }
+func (p *sayingPage) Items() []*sayingResolver { return p.items }
+
+type predictorPage struct {
+	total int
+	more  bool
+	items []*predictorResolver
+}
+
+func (p *predictorPage) TotalCount() int32            { return int32(p.total) }
+func (p *predictorPage) HasNextPage() bool            { return p.more }
+func (p *predictorPage) Items() []*predictorResolver { return p.items }
+
+type companyPage struct {
+	total int
+	more  bool
+	items []*companyResolver
+}
+
+func (p *companyPage) TotalCount() int32          { return int32(p.total) }
+func (p *companyPage) HasNextPage() bool          { return p.more }
+func (p *companyPage) Items() []*companyResolver { return p.items }
+
+//** utility functions
+func sayingResolvers(gs *GlobalState, list []*Saying) []*sayingResolver {
+	rs := []*sayingResolver{}
+	for _, s := range list {
+		rs = append(rs, &sayingResolver{gs, s})
+	}
+	return rs
+}
+
+// Clamp the requested window to [0, total) and to maxPageSize items.
+func pageBounds(total int, args pageArgs) (int, int) {
+	first, offset := int(args.First), int(args.Offset)
+	if first < 0 { first = 0 }
+	if first > maxPageSize { first = maxPageSize }
+	if offset < 0 { offset = 0 }
+	if offset > total { offset = total }
+
+	hi := offset + first
+	if hi > total { hi = total }
+	return offset, hi
+}
+
+func containsFold(s string, sub string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+}
+
+func deref(s *string) string {
+	if s == nil { return "" }
+	return *s
+}
+
+func derefInt(n *int32) int32 {
+	if n == nil { return 0 }
+	return *n
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"log"
+	"net"
+	"rest/sayingspb"
+	"tlsconf"
+)
+
+// The gRPC Sayings service, backed by the same GlobalState as the HTTP
+// handlers and going through the same store operations, hence the same
+// validation.
+type sayingsServer struct {
+	sayingspb.UnimplementedSayingsServer
+	gs *GlobalState
+}
+
+func (srv sayingsServer) List(ctx context.Context, req *sayingspb.ListRequest) (*sayingspb.ListResponse, error) {
+	if srv.gs.shutDown.Load() { return nil, errShuttingDown }
+
+	resp := &sayingspb.ListResponse{}
+	for _, s := range srv.gs.ListifySayings() {
+		resp.Sayings = append(resp.Sayings, toProto(s))
+	}
+	log.Println("grpc List")
+	return resp, nil
+}
+
+func (srv sayingsServer) Get(ctx context.Context, req *sayingspb.GetRequest) (*sayingspb.Saying, error) {
+	if srv.gs.shutDown.Load() { return nil, errShuttingDown }
+
+	saying := srv.gs.readSaying(int(req.Id))
+	if saying == nil {
+		return nil, status.Errorf(codes.NotFound, "No such Saying %d", req.Id)
+	}
+	log.Println("grpc Get", req.Id)
+	return toProto(saying), nil
+}
+
+func (srv sayingsServer) Create(ctx context.Context, req *sayingspb.CreateRequest) (*sayingspb.Saying, error) {
+	if srv.gs.shutDown.Load() { return nil, errShuttingDown }
+
+	created, err := srv.gs.CreateSaying(req.Prediction, req.Predictor, int(req.PredictorId))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	log.Println("grpc Create", created.Saying.Id)
+	return toProto(created.Saying), nil
+}
+
+func (srv sayingsServer) Update(ctx context.Context, req *sayingspb.UpdateRequest) (*sayingspb.Saying, error) {
+	if srv.gs.shutDown.Load() { return nil, errShuttingDown }
+
+	saying, err := srv.gs.EditSaying(int(req.Id), req.Prediction, req.Predictor, int(req.PredictorId))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	log.Println("grpc Update", req.Id)
+	return toProto(saying), nil
+}
+
+func (srv sayingsServer) Delete(ctx context.Context, req *sayingspb.DeleteRequest) (*sayingspb.DeleteResponse, error) {
+	if srv.gs.shutDown.Load() { return nil, errShuttingDown }
+
+	if err := srv.gs.DeleteSaying(int(req.Id)); err != nil {
+		return nil, toStatus(err)
+	}
+	log.Println("grpc Delete", req.Id)
+	return &sayingspb.DeleteResponse{}, nil
+}
+
+func (srv sayingsServer) Watch(req *sayingspb.WatchRequest, stream sayingspb.Sayings_WatchServer) error {
+	if srv.gs.shutDown.Load() { return errShuttingDown }
+
+	events, cancel := srv.gs.hub.subscribe()
+	defer cancel()
+	log.Println("grpc Watch")
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-srv.gs.stopping:
+			return errShuttingDown
+		case e, ok := <-events:
+			if !ok { return nil }
+			err := stream.Send(&sayingspb.Event{Kind: eventKinds[e.Kind], Saying: toProto(&e.Saying)})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+var errShuttingDown = status.Error(codes.Unavailable, "Shutting down")
+
+var eventKinds = map[string]sayingspb.Event_Kind{
+	EventCreated: sayingspb.Event_CREATED,
+	EventEdited:  sayingspb.Event_EDITED,
+	EventDeleted: sayingspb.Event_DELETED}
+
+func toProto(s *Saying) *sayingspb.Saying {
+	return &sayingspb.Saying{
+		Id:          int32(s.Id),
+		PredictorId: int32(s.PredictorId),
+		Predictor:   s.Predictor,
+		Prediction:  s.Prediction,
+		Tags:        s.Tags,
+		CompanyId:   int32(s.CompanyId)}
+}
+
+func toStatus(err error) error {
+	if isNotFound(err) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if _, ok := err.(duplicateError); ok {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// Serve gRPC on its own port, over TLS if the HTTP server uses it. Only
+// the serving itself happens in the background.
+func startGRPC(gs *GlobalState, addr string) *grpc.Server {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	opts := []grpc.ServerOption{}
+	if tlsSettings.Enabled() {
+		r, err := tlsconf.NewReloader(tlsSettings)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		config, err := r.Config()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		r.WatchSIGHUP()
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	}
+
+	server := grpc.NewServer(opts...)
+	sayingspb.RegisterSayingsServer(server, sayingsServer{gs: gs})
+
+	log.Println("Starting gRPC server on", addr)
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Println(err)
+		}
+	}()
+	return server
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"health"
+	"os"
+)
+
+// /healthz and /readyz, on the same rule as in gorilla-mux: liveness asks
+// only that the store answer (a wedged lock fails it); readiness also
+// wants the last snapshot saved and the data files readable, if there,
+// and fails once shutdown starts.
+func (gs *GlobalState) registerChecks() {
+	gs.checker.Live("store", func() error {
+		gs.lock.RLock()
+		gs.lock.RUnlock()
+		return nil
+	})
+	gs.checker.Ready("snapshot", func() error {
+		gs.lock.RLock()
+		defer gs.lock.RUnlock()
+		return gs.saveErr
+	})
+	gs.checker.Ready(companiesFile, func() error {
+		// Optional, as for loadCompanies: only an unreadable file fails.
+		if _, err := os.Stat(gs.path(companiesFile)); os.IsNotExist(err) {
+			return nil
+		}
+		return health.Readable(gs.path(companiesFile))()
+	})
+	gs.checker.Ready("data file", func() error {
+		// sayings.db matters only until the first snapshot is written.
+		if _, err := os.Stat(gs.path(storeFile)); err == nil {
+			return health.Readable(gs.path(storeFile))()
+		}
+		return health.Readable(gs.path("sayings.db"))()
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What a POST /sayingCreate with an Idempotency-Key did. The records live
+// in the snapshot with the sayings, so they survive a restart together.
+type IdempotencyRecord struct {
+	SayingId    int
+	Fingerprint string // of the request, to catch a key reused for another
+	Created     time.Time
+	Response    *RecordedResponse `json:",omitempty"` // as first sent
+}
+
+// An HTTP answer as sent, headers and all, so that it can be sent again.
+type RecordedResponse struct {
+	Status int
+	Header http.Header `json:",omitempty"`
+	Body   string
+}
+
+func (r *RecordedResponse) send(rw http.ResponseWriter) {
+	for name, values := range r.Header {
+		rw.Header()[name] = values
+	}
+	rw.WriteHeader(r.Status)
+	rw.Write([]byte(r.Body))
+}
+
+// Create a Saying unless this key already created one, in which case that
+// Saying is returned again, marked Replayed. Either way the Created carries
+// the Response, which answer makes for a new Saying and the key keeps for
+// replays. Reusing a key for a different request is an error.
+func (gs *GlobalState) CreateSayingOnce(key string, prediction string, predictor string, predictorId int,
+	extras SayingExtras, answer func(*Created) *RecordedResponse) (*Created, error) {
+	fingerprint := requestFingerprint(prediction, predictor, predictorId, extras)
+
+	defer gs.webhooks.flush() // after the unlock; see WebhookState.enqueue
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	gs.expireKeys()
+	if r, ok := gs.idempotency[key]; ok {
+		if r.Fingerprint != fingerprint {
+			return nil, errors.New("Idempotency-Key " + key + " was used for a different request")
+		}
+		saying := &Saying{Id: r.SayingId}
+		if s, ok := gs.sayings[r.SayingId]; ok {
+			saying = gs.resolve(s)
+		}
+		replayed := &Created{Saying: saying, Replayed: true, Response: r.Response}
+		if replayed.Response == nil { // recorded before responses were
+			replayed.Response = answer(replayed)
+		}
+		return replayed, nil
+	}
+
+	if err := gs.validateNew(prediction, predictor, predictorId); err != nil {
+		return nil, err
+	}
+	created, err := gs.insertSaying(prediction, predictor, predictorId, extras)
+	if err != nil {
+		return nil, err
+	}
+	created.Response = answer(created)
+	gs.idempotency[key] = &IdempotencyRecord{SayingId: created.Saying.Id, Fingerprint: fingerprint,
+		Created: time.Now(), Response: created.Response}
+	gs.changed()
+	if !created.Merged {
+		gs.hub.publish(SayingEvent{Kind: EventCreated, Saying: *created.Saying})
+	}
+	return created, nil
+}
+
+// Forget keys older than the TTL. Caller holds the lock.
+func (gs *GlobalState) expireKeys() {
+	cutoff := time.Now().Add(-gs.config.IdempotencyTTL)
+	for key, r := range gs.idempotency {
+		if r.Created.Before(cutoff) {
+			delete(gs.idempotency, key)
+		}
+	}
+}
+
+// Extras count only when given, so that keys recorded before they could
+// be still match.
+func requestFingerprint(prediction string, predictor string, predictorId int, extras SayingExtras) string {
+	request := prediction + "\x00" + predictor + "\x00" + strconv.Itoa(predictorId)
+	if extras.CompanyId != 0 || len(extras.Tags) > 0 {
+		request += "\x00" + strconv.Itoa(extras.CompanyId) + "\x00" + strings.Join(extras.Tags, ",")
+	}
+	sum := sha256.Sum256([]byte(request))
+	return hex.EncodeToString(sum[:])
+}
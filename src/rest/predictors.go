@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Predictor is the person behind one or more Sayings.
+type Predictor struct {
+	Id          int
+	Name        string
+	Affiliation string `json:",omitempty" xml:",omitempty"`
+	Bio         string `json:",omitempty" xml:",omitempty"`
+}
+
+//** request handlers
+// GET /predictors
+func (gs *GlobalState) PredictorsList(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	gs.sendFormatted(response, request, gs.ListifyPredictors())
+	log.Println("/predictors")
+}
+
+// GET /predictors/{id:[0-9]+}
+func (gs *GlobalState) PredictorRead(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	n := mux.Vars(request)["id"]
+	id, _ := strconv.Atoi(n)
+
+	p := gs.readPredictor(id)
+	if p == nil {
+		sendStatus(response, http.StatusNotFound, errors.New("No such Predictor"))
+		return
+	}
+	gs.sendFormatted(response, request, p)
+	log.Println("/predictors/" + n)
+}
+
+// GET /predictors/{id:[0-9]+}/sayings
+func (gs *GlobalState) PredictorSayings(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	n := mux.Vars(request)["id"]
+	id, _ := strconv.Atoi(n)
+
+	if gs.readPredictor(id) == nil {
+		sendStatus(response, http.StatusNotFound, errors.New("No such Predictor"))
+		return
+	}
+	gs.sendFormatted(response, request, gs.SayingsBy(id))
+	log.Println("/predictors/" + n + "/sayings")
+}
+
+// POST /predictors
+func (gs *GlobalState) PredictorCreate(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	name := strings.TrimSpace(request.FormValue("name"))
+	if len(name) < gs.minLen {
+		err := fmt.Errorf("Name must be >= %d chars.", gs.minLen)
+		sendStatus(response, http.StatusBadRequest, err)
+		return
+	}
+
+	gs.lock.Lock()
+	if gs.predictorNamed(name, false) != nil {
+		gs.lock.Unlock()
+		sendStatus(response, http.StatusConflict, errors.New("Predictor " + name + " exists"))
+		return
+	}
+	p := gs.predictorNamed(name, true)
+	p.Affiliation = request.FormValue("affiliation")
+	p.Bio = request.FormValue("bio")
+	gs.changed()
+	gs.lock.Unlock()
+
+	msg := fmt.Sprintf("New Predictor %d created\n.", p.Id)
+	sendResponse(response, []byte(msg), nil)
+	log.Println("/predictorCreate")
+}
+
+// PUT /predictors/{id:[0-9]+}
+// Only the fields present in the request are changed.
+func (gs *GlobalState) PredictorEdit(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	n := mux.Vars(request)["id"]
+	id, _ := strconv.Atoi(n)
+	request.ParseForm()
+
+	name := strings.TrimSpace(request.FormValue("name"))
+	if _, ok := request.Form["name"]; ok && len(name) < gs.minLen {
+		err := fmt.Errorf("Name must be >= %d chars.", gs.minLen)
+		sendStatus(response, http.StatusBadRequest, err)
+		return
+	}
+
+	gs.lock.Lock()
+	p, ok := gs.predictors[id]
+	if !ok {
+		gs.lock.Unlock()
+		sendStatus(response, http.StatusNotFound, errors.New("No such Predictor"))
+		return
+	}
+	if other := gs.predictorNamed(name, false); other != nil && other.Id != id {
+		gs.lock.Unlock()
+		sendStatus(response, http.StatusConflict, errors.New("Predictor " + name + " exists"))
+		return
+	}
+	if name != "" {
+		p.Name = name
+	}
+	if _, ok := request.Form["affiliation"]; ok {
+		p.Affiliation = request.FormValue("affiliation")
+	}
+	if _, ok := request.Form["bio"]; ok {
+		p.Bio = request.FormValue("bio")
+	}
+	gs.changed()
+	gs.lock.Unlock()
+
+	sendResponse(response, []byte("Predictor " + n + " updated\n."), nil)
+	log.Println("/predictorEdit/" + n)
+}
+
+// DELETE /predictors/{id:[0-9]+}
+// A Predictor still referenced by a Saying cannot be deleted.
+func (gs *GlobalState) PredictorDelete(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	n := mux.Vars(request)["id"]
+	id, _ := strconv.Atoi(n)
+
+	gs.lock.Lock()
+	if _, ok := gs.predictors[id]; !ok {
+		gs.lock.Unlock()
+		sendStatus(response, http.StatusNotFound, errors.New("No such Predictor"))
+		return
+	}
+	for _, s := range gs.sayings {
+		if s.PredictorId == id {
+			gs.lock.Unlock()
+			sendStatus(response, http.StatusConflict, errors.New("Predictor " + n + " still has sayings"))
+			return
+		}
+	}
+	delete(gs.predictors, id)
+	gs.changed()
+	gs.lock.Unlock()
+
+	sendResponse(response, []byte("Predictor " + n + " deleted\n."), nil)
+	log.Println("/predictorDelete/" + n)
+}
+
+//** methods
+func (p Predictor) ToString() string {
+	return fmt.Sprintf("%2d. %s (%s)", p.Id, p.Name, p.Affiliation)
+}
+
+func (gs *GlobalState) ListifyPredictors() []*Predictor {
+	list := []*Predictor{}
+
+	gs.lock.RLock()
+	for _, p := range gs.predictors {
+		c := *p
+		list = append(list, &c)
+	}
+	gs.lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	return list
+}
+
+// Sayings attributed to the given Predictor, in Id order.
+func (gs *GlobalState) SayingsBy(predictorId int) []*Saying {
+	list := []*Saying{}
+
+	gs.lock.RLock()
+	for _, s := range gs.sayings {
+		if s.PredictorId == predictorId {
+			list = append(list, gs.resolve(s))
+		}
+	}
+	gs.lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	return list
+}
+
+// Find the Predictor with the given name, optionally creating it.
+// Caller holds the lock.
+func (gs *GlobalState) predictorNamed(name string, create bool) *Predictor {
+	name = strings.TrimSpace(name)
+	for _, p := range gs.predictors {
+		if p.Name == name {
+			return p
+		}
+	}
+	if !create { return nil }
+
+	p := &Predictor{Id: gs.predictorId, Name: name}
+	gs.predictors[p.Id] = p
+	gs.predictorId++
+	return p
+}
+
+// Resolve a Saying's predictor: an explicit (non-zero) id must exist,
+// whereas a name is found or created. Caller holds the lock.
+func (gs *GlobalState) lookupPredictor(id int, name string) (*Predictor, error) {
+	if id == 0 {
+		return gs.predictorNamed(name, true), nil
+	}
+	p, ok := gs.predictors[id]
+	if !ok {
+		return nil, notFoundError(fmt.Sprintf("No such Predictor %d", id))
+	}
+	return p, nil
+}
+
+//** utility functions
+func (gs *GlobalState) readPredictor(id int) *Predictor {
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+
+	p, ok := gs.predictors[id]
+	if !ok { return nil }
+	c := *p
+	return &c
+}
+
+// Marshal as XML if the client asks for it (?format=xml), otherwise JSON.
+func (gs *GlobalState) sendFormatted(rw http.ResponseWriter, request *http.Request, v interface{}) {
+	var doc []byte
+	var err error
+	if request.FormValue("format") == "xml" {
+		rw.Header().Set("Content-Type", "application/xml")
+		doc, err = xml.MarshalIndent(v, gs.indent1, gs.indent2)
+	} else {
+		rw.Header().Set("Content-Type", "application/json")
+		doc, err = json.MarshalIndent(v, gs.indent1, gs.indent2)
+	}
+	sendResponse(rw, doc, err)
+}
+
+func sendStatus(rw http.ResponseWriter, status int, err error) {
+	rw.WriteHeader(status)
+	sendResponse(rw, []byte(""), err)
+}
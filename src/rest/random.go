@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // so ?tz= works on hosts without a zoneinfo database
+)
+
+const (
+	dailyFile    = "daily.json"
+	dailyHistory = 400 // days of picks kept
+)
+
+// The saying of the day. Each date's pick is remembered, so it stays put
+// all day and across restarts; Used holds the picks since the pool was
+// last exhausted, none of which is picked again until it is.
+type DailyState struct {
+	Picks map[string]int // date (2006-01-02) -> Saying id
+	Used  []int
+
+	file string
+	lock sync.Mutex
+}
+
+//** request handlers
+// GET /sayings/random[?predictor=name|predictorId=n][&tag=t][&seed=n][&format=xml]
+// The same seed picks the same Saying, for as long as the matches stay put.
+func (gs *GlobalState) SayingRandom(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	predictorId, err := formId(request, "predictorId")
+	if err != nil {
+		sendStatus(response, http.StatusBadRequest, err)
+		return
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	if n := request.FormValue("seed"); n != "" {
+		seed, err := strconv.ParseInt(n, 10, 64)
+		if err != nil {
+			sendStatus(response, http.StatusBadRequest, errors.New("Bad seed " + n))
+			return
+		}
+		rng = rand.New(rand.NewSource(seed))
+	}
+
+	matches := gs.FilterSayings(request.FormValue("predictor"), predictorId, request.FormValue("tag"))
+	if len(matches) == 0 {
+		sendStatus(response, http.StatusNotFound, errors.New("No matching Saying"))
+		return
+	}
+	gs.sendFormatted(response, request, matches[rng.Intn(len(matches))])
+	log.Println("/sayings/random")
+}
+
+// GET /sayings/daily[?tz=America/Chicago][&format=xml]
+func (gs *GlobalState) SayingDaily(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	zone := request.FormValue("tz")
+	if zone == "" {
+		zone = gs.config.DailyZone
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		sendStatus(response, http.StatusBadRequest, errors.New("Unknown timezone " + zone))
+		return
+	}
+
+	saying := gs.daily.pick(time.Now().In(loc).Format("2006-01-02"), gs.ListifySayings())
+	if saying == nil {
+		sendStatus(response, http.StatusNotFound, errors.New("No Sayings"))
+		return
+	}
+	gs.sendFormatted(response, request, saying)
+	log.Println("/sayings/daily " + zone)
+}
+
+//** selection
+// Sayings by the named predictor (or the one with predictorId) carrying
+// tag, sorted by Id. Empty criteria match everything.
+func (gs *GlobalState) FilterSayings(predictor string, predictorId int, tag string) []*Saying {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	matches := []*Saying{}
+	for _, s := range gs.ListifySayings() {
+		if predictor != "" && !strings.EqualFold(s.Predictor, predictor) { continue }
+		if predictorId != 0 && s.PredictorId != predictorId { continue }
+		if tag != "" && !hasTag(s, tag) { continue }
+		matches = append(matches, s)
+	}
+	return matches
+}
+
+func hasTag(s *Saying, tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// The Saying for date from among sayings, choosing one if the date has none
+// yet (or its Saying has since been deleted). The choice is seeded by the
+// date, so a fresh pool gives the same sequence of days wherever it runs.
+func (d *DailyState) pick(date string, sayings []*Saying) *Saying {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if id, ok := d.Picks[date]; ok {
+		for _, s := range sayings {
+			if s.Id == id {
+				return s
+			}
+		}
+	}
+
+	pool := d.unused(sayings)
+	if len(pool) == 0 {
+		d.Used = nil
+		pool = d.unused(sayings)
+	}
+	if len(pool) == 0 {
+		return nil
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(date))
+	s := pool[rand.New(rand.NewSource(int64(h.Sum64()))).Intn(len(pool))]
+
+	d.Picks[date] = s.Id
+	d.Used = append(d.Used, s.Id)
+	d.prune()
+	if err := writeJSONFile(d.file, d); err != nil {
+		log.Println("Cannot save " + d.file + ":", err)
+	}
+	return s
+}
+
+// Sayings not picked since the pool was last exhausted. Caller holds the lock.
+func (d *DailyState) unused(sayings []*Saying) []*Saying {
+	used := make(map[int]bool)
+	for _, id := range d.Used {
+		used[id] = true
+	}
+	pool := []*Saying{}
+	for _, s := range sayings {
+		if !used[s.Id] {
+			pool = append(pool, s)
+		}
+	}
+	return pool
+}
+
+// Forget all but the latest dailyHistory days. Caller holds the lock.
+func (d *DailyState) prune() {
+	if len(d.Picks) <= dailyHistory {
+		return
+	}
+	dates := []string{}
+	for date := range d.Picks {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	for _, date := range dates[:len(dates)-dailyHistory] {
+		delete(d.Picks, date)
+	}
+}
+
+// The picks saved in file_name, if any.
+func loadDaily(file_name string) (*DailyState, error) {
+	d := &DailyState{file: file_name}
+	if _, err := readJSONFile(file_name, d); err != nil {
+		return nil, err
+	}
+	if d.Picks == nil {
+		d.Picks = make(map[string]int)
+	}
+	return d, nil
+}
@@ -2,143 +2,235 @@ package main
 
 import (
 	"bytes"
+	"cors"
+	"datafiles"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"health"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"tlsconf"
 )
 
+// A Saying refers to its Predictor by id. The Predictor field holds the
+// predictor's name only in copies handed out to readers (see resolve).
 type Saying struct {
-	Id         int
-	Predictor  string   
-	Prediction string   
+	Id          int
+	PredictorId int
+	Predictor   string `json:",omitempty" xml:",omitempty"`
+	Prediction  string   
+	CompanyId   int      `json:",omitempty" xml:",omitempty"`
+	Tags        []string `json:",omitempty" xml:"Tag,omitempty"`
 }
 
-// In effect, an in-memory data store. (Next is a real DB.)
+// In effect, an in-memory data store, snapshotted to storeFile on change,
+// together with everything that hangs off it. Every front end is handed
+// one; nothing refers to it globally, so tests can run several at once.
 type GlobalState struct {
-	sayings   map[int]*Saying
-   sayingId  int
-   shutDown  bool
-   minLen    int
-	indent1   string
-	indent2   string
-	lock      sync.RWMutex
+	sayings     map[int]*Saying
+	predictors  map[int]*Predictor
+	companies   map[int]*Company // read-only, from companies.csv
+   sayingId    int
+	predictorId int
+	modified    time.Time // of the last change, for Last-Modified
+	saveErr     error     // from the last snapshot, for /readyz
+	idempotency map[string]*IdempotencyRecord
+   shutDown    atomic.Bool
+	stopping    chan struct{} // closed by Shutdown, to end streams
+   minLen      int
+	indent1     string
+	indent2     string
+	lock        sync.RWMutex
+
+	config     Config
+	hub        *EventHub
+	cache      *ResponseCache
+	stats      *StatsState
+	daily      *DailyState
+	webhooks   *WebhookState
+	checker    *health.Checker
+	signatures *signatureCache
 }
-var gState *GlobalState
+
+// Settings fixed at startup, mostly from the command line.
+type Config struct {
+	Dir            string        // holds the data files; "" for the working directory
+	DupPolicy      string        // policyReject, policyWarn or policyMerge
+	DupThreshold   float64       // Jaccard similarity of shingle sets
+	DailyZone      string        // default timezone for /sayings/daily
+	IdempotencyTTL time.Duration // how long an Idempotency-Key is remembered
+}
+
+func DefaultConfig() Config {
+	return Config{DupPolicy: policyWarn, DupThreshold: 0.8, DailyZone: "Local",
+		IdempotencyTTL: 24 * time.Hour}
+}
+
+var tlsSettings tlsconf.Settings
+var corsOptions cors.Options
 
 //** request handlers
 // GET /sayingsXML
-func SayingsXML(response http.ResponseWriter, request *http.Request) {
-	if gState.shutDown { return }
+func (gs *GlobalState) SayingsXML(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
 
-	xmlDoc, err := xml.MarshalIndent(gState.ListifySayings(), gState.indent1, gState.indent2)
+	xmlDoc, err := xml.MarshalIndent(gs.ListifySayings(), gs.indent1, gs.indent2)
 	sendResponse(response, xmlDoc, err)
 	log.Println("/sayingsXML")
 }
 
 // GET /sayingXML/{id:[0-9]+}
-func SayingXML(response http.ResponseWriter, request *http.Request) {	
-	if gState.shutDown { return }
+func (gs *GlobalState) SayingXML(response http.ResponseWriter, request *http.Request) {	
+	if gs.shutDown.Load() { return }
 
 	// Extract and convert ID parameter. (Gorilla catches non-numeric Id.)
 	n := mux.Vars(request)["id"]
 	id, _ := strconv.Atoi(n)
 	
-	saying := readSaying(id)
-	xmlDoc, err := xml.MarshalIndent(saying, gState.indent1, gState.indent2)
+	saying := gs.readSaying(id)
+	if saying == nil {
+		sendStatus(response, http.StatusNotFound, errors.New("No such Saying"))
+		return
+	}
+	xmlDoc, err := xml.MarshalIndent(saying, gs.indent1, gs.indent2)
 	sendResponse(response, xmlDoc, err)
 	log.Println("/sayingXML/" + n)
 }
 
 // GET /sayingsJSON
-func SayingsJSON(response http.ResponseWriter, request *http.Request) {
-	if gState.shutDown { return }
+func (gs *GlobalState) SayingsJSON(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
 
-	jsonDoc, err := json.MarshalIndent(gState.ListifySayings(), gState.indent1, gState.indent2)
+	jsonDoc, err := json.MarshalIndent(gs.ListifySayings(), gs.indent1, gs.indent2)
 	sendResponse(response, jsonDoc, err)
 	log.Println("/sayingsJSON")
 }
 
 // GET /sayingJSON/{id:[0-9]+}
-func SayingJSON(response http.ResponseWriter, request *http.Request) {
-	if gState.shutDown { return }
+func (gs *GlobalState) SayingJSON(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
 
 	// Extract and convert ID parameter. (Gorilla catches non-numeric Id.)
 	n := mux.Vars(request)["id"]
 	id, _ := strconv.Atoi(n)
 
-	saying := readSaying(id)
-	jsonDoc, err := json.MarshalIndent(saying, gState.indent1, gState.indent2)
+	saying := gs.readSaying(id)
+	if saying == nil {
+		sendStatus(response, http.StatusNotFound, errors.New("No such Saying"))
+		return
+	}
+	jsonDoc, err := json.MarshalIndent(saying, gs.indent1, gs.indent2)
 	sendResponse(response, jsonDoc, err)
 	log.Println("/sayingXML/" + n)
 }
 
 // GET /sayingsPlain
-func SayingsPlain(response http.ResponseWriter, request *http.Request) {
-	if gState.shutDown { return }
+func (gs *GlobalState) SayingsPlain(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
 
-	sendResponse(response, []byte(gState.StringifySayings()), nil)
+	sendResponse(response, []byte(gs.StringifySayings()), nil)
 	log.Println("/sayingsPlain")
 }
 
 // GET /sayingPlain/{id:[0-9]+}
-func SayingPlain(response http.ResponseWriter, request *http.Request) {
-	if gState.shutDown { return }
+func (gs *GlobalState) SayingPlain(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
 
 	// Extract and convert ID parameter. (Gorilla catches non-numeric Id.)
 	n := mux.Vars(request)["id"]
 	id, _ := strconv.Atoi(n)
 	
-	saying := readSaying(id)
+	saying := gs.readSaying(id)
+	if saying == nil {
+		sendStatus(response, http.StatusNotFound, errors.New("No such Saying"))
+		return
+	}
 	sendResponse(response, []byte(saying.ToString()), nil)
 	log.Println("/sayingPlain/" + n)
 }
 
 // POST /saying
-func SayingCreate(response http.ResponseWriter, request *http.Request) {
-	if gState.shutDown { return }
+// Besides the saying's own fields, a companyId and comma-separated tags
+// may be given.
+func (gs *GlobalState) SayingCreate(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
 
-	minLen := gState.minLen
+	predictorId, err := formId(request, "predictorId")
+	if err != nil {
+		sendResponse(response, []byte(""), err)
+		return
+	}
+	companyId, err := formId(request, "companyId")
+	if err != nil {
+		sendResponse(response, []byte(""), err)
+		return
+	}
 	prediction := request.FormValue("prediction")
 	predictor := request.FormValue("predictor")
-	
-	if len(prediction) < minLen || len(predictor) < minLen {
-		err := errors.New("Prediction/predictor must be >= " + string(minLen) + " chars.")
+	extras := SayingExtras{CompanyId: companyId}
+	if tags := splitTags(request.FormValue("tags")); len(tags) > 0 {
+		extras.Tags = tags
+	}
+
+	// With an Idempotency-Key, a retry gets the original answer instead
+	// of a second Saying.
+	var created *Created
+	if key := request.Header.Get("Idempotency-Key"); key != "" {
+		created, err = gs.CreateSayingOnce(key, prediction, predictor, predictorId, extras, createdResponse)
+	} else if created, err = gs.CreateSayingWith(prediction, predictor, predictorId, extras); err == nil {
+		created.Response = createdResponse(created)
+	}
+	if d, ok := err.(duplicateError); ok {
+		response.Header().Set("X-Duplicate-Of", strconv.Itoa(d.dup.SayingId))
+		sendStatus(response, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
 		sendResponse(response, []byte(""), err)
 		return
 	}
-
-	saying := new(Saying)
-	saying.Prediction = prediction
-	saying.Predictor = predictor
-
-	// Insert into sayings list.
-	gState.lock.Lock()
-	saying.Id = gState.sayingId
-	gState.sayings[saying.Id] = saying
-	gState.sayingId++
-	gState.lock.Unlock()
-
-	msg := fmt.Sprintf("New Saying %d created\n.", saying.Id)
-	sendResponse(response, []byte(msg), nil)
+	if created.Replayed {
+		response.Header().Set("Idempotent-Replayed", "true")
+	}
+	created.Response.send(response)
 	log.Println("/sayingCreate")
 }
 
+// The answer to a create. Near-duplicates are flagged or merged, depending
+// on -dup-policy.
+func createdResponse(created *Created) *RecordedResponse {
+	r := &RecordedResponse{Status: http.StatusOK,
+		Body: fmt.Sprintf("New Saying %d created\n.", created.Saying.Id)}
+	if dup := created.Duplicate; dup != nil {
+		r.Header = http.Header{"X-Duplicate-Of": {strconv.Itoa(dup.SayingId)}}
+		if created.Merged {
+			r.Body = fmt.Sprintf("Saying %d already exists\n.", dup.SayingId)
+		} else {
+			r.Body = fmt.Sprintf("New Saying %d created (similar to Saying %d)\n.", created.Saying.Id, dup.SayingId)
+		}
+	}
+	return r
+}
+
 // PUT /saying
-func SayingEdit(response http.ResponseWriter, request *http.Request) {
-	if gState.shutDown { return }
+func (gs *GlobalState) SayingEdit(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
 
 	// Id provided?
 	id, err := strconv.Atoi(request.FormValue("id"))
@@ -149,73 +241,282 @@ func SayingEdit(response http.ResponseWriter, request *http.Request) {
 	}
 
 	// Need Prediction, Predictor, or both.
-	minLen := gState.minLen
-	prediction := request.FormValue("prediction")
-	predictor := request.FormValue("predictor")
-	if len(prediction) < minLen && len(predictor) < minLen {
-		err := errors.New("Prediction/predictor must be >= " + string(minLen) + " chars.")
+	predictorId, err := formId(request, "predictorId")
+	if err != nil {
 		sendResponse(response, []byte(""), err)
 		return
 	}
-
-	// Update the Saying.
-	gState.lock.Lock()
-	if len(prediction) >= minLen {
-		gState.sayings[id].Prediction = prediction
+	_, err = gs.EditSaying(id, request.FormValue("prediction"),
+		request.FormValue("predictor"), predictorId)
+	if isNotFound(err) {
+		sendStatus(response, http.StatusNotFound, err)
+		return
 	}
-	if len(predictor) >= minLen {
-		gState.sayings[id].Predictor = predictor
+	if err != nil {
+		sendResponse(response, []byte(""), err)
+		return
 	}
-	gState.lock.Unlock()
 
 	sendResponse(response, []byte("Saying " + request.FormValue("id") + " updated\n."), nil)
 	log.Println("/sayingEdit/" + request.FormValue("id"))
 }
 
+// PUT /sayings/{id:[0-9]+}/tags with tags=a,b,c (empty to clear)
+func (gs *GlobalState) SayingTags(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	n := mux.Vars(request)["id"]
+	id, _ := strconv.Atoi(n)
+
+	if _, err := gs.TagSaying(id, splitTags(request.FormValue("tags"))); err != nil {
+		if isNotFound(err) {
+			sendStatus(response, http.StatusNotFound, err)
+		} else {
+			sendResponse(response, []byte(""), err)
+		}
+		return
+	}
+
+	sendResponse(response, []byte("Saying " + n + " tagged\n."), nil)
+	log.Println("/sayings/" + n + "/tags")
+}
+
 // DELETE /saying/{id:[0-9]+}
-func SayingDelete(response http.ResponseWriter, request *http.Request) {
-	if gState.shutDown { return }
+func (gs *GlobalState) SayingDelete(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
 
 	// Extract and convert ID parameter. (Gorilla catches non-numeric Id.)
 	n := mux.Vars(request)["id"]
 	id, _ := strconv.Atoi(n)
 
-	gState.lock.Lock()
-	delete(gState.sayings, id)
-	gState.lock.Unlock()
+	if err := gs.DeleteSaying(id); isNotFound(err) {
+		sendStatus(response, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		sendResponse(response, []byte(""), err)
+		return
+	}
 
 	sendResponse(response, []byte("Saying " + n + " deleted\n."), nil)
 	log.Println("/sayingDelete/" + n)
 }
 
-// GET /reload (for test purposes only, hence not synchronized)
-func Reload(response http.ResponseWriter, request *http.Request) {
-	if gState.shutDown { return }
+// GET /reload (for test purposes only): re-import the data files, in
+// place of the sayings in the snapshot (see reload)
+func (gs *GlobalState) Reload(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
 
-	initialize()
+	if err := gs.reload(); err != nil {
+		sendStatus(response, http.StatusInternalServerError, err)
+		return
+	}
 	sendResponse(response, []byte("Reloaded data."), nil)
 	log.Println("/reload")
 }
 
-// Set up Gorilla router.
-func startServer() {
+// Map every route to its handler.
+func (gs *GlobalState) Router() *mux.Router {
    router := mux.NewRouter()
 
-   router.HandleFunc("/sayingsXML", SayingsXML).Methods("GET")
-	router.HandleFunc("/sayingXML/{id:[0-9]+}", SayingXML).Methods("GET")
-	router.HandleFunc("/sayingsJSON", SayingsJSON).Methods("GET")
-	router.HandleFunc("/sayingJSON/{id:[0-9]+}", SayingJSON).Methods("GET")
-	router.HandleFunc("/sayingsPlain", SayingsPlain).Methods("GET")
-	router.HandleFunc("/sayingPlain/{id:[0-9]+}", SayingPlain).Methods("GET")
-	router.HandleFunc("/sayingCreate", SayingCreate).Methods("POST")
-	router.HandleFunc("/sayingEdit", SayingEdit).Methods("PUT")
-	router.HandleFunc("/sayingDelete/{id:[0-9]+}", SayingDelete).Methods("DELETE")
-	router.HandleFunc("/reload", Reload).Methods("GET") // refresh the data
+   // The list routes are cached and compressed (see cache.go).
+   router.HandleFunc("/sayingsXML", gs.cached(gs.SayingsXML)).Methods("GET")
+	router.HandleFunc("/sayingXML/{id:[0-9]+}", gs.SayingXML).Methods("GET")
+	router.HandleFunc("/sayingsJSON", gs.cached(gs.SayingsJSON)).Methods("GET")
+	router.HandleFunc("/sayingJSON/{id:[0-9]+}", gs.SayingJSON).Methods("GET")
+	router.HandleFunc("/sayingsPlain", gs.cached(gs.SayingsPlain)).Methods("GET")
+	router.HandleFunc("/sayingPlain/{id:[0-9]+}", gs.SayingPlain).Methods("GET")
+	router.HandleFunc("/sayingCreate", gs.SayingCreate).Methods("POST")
+	router.HandleFunc("/sayingEdit", gs.SayingEdit).Methods("PUT")
+	router.HandleFunc("/sayingDelete/{id:[0-9]+}", gs.SayingDelete).Methods("DELETE")
+	router.HandleFunc("/sayings/duplicates", gs.cached(gs.SayingsDuplicates)).Methods("GET")
+	router.HandleFunc("/sayings/{id:[0-9]+}/tags", gs.SayingTags).Methods("PUT")
+	router.HandleFunc("/sayings/random", gs.SayingRandom).Methods("GET")
+	router.HandleFunc("/sayings/stats", gs.SayingsStats).Methods("GET")
+	router.HandleFunc("/sayings/daily", gs.SayingDaily).Methods("GET")
+	router.HandleFunc("/reload", gs.Reload).Methods("GET") // refresh the data
+	router.HandleFunc("/healthz", gs.checker.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", gs.checker.Readyz).Methods("GET")
+
+	router.HandleFunc("/predictors", gs.cached(gs.PredictorsList)).Methods("GET")
+	router.HandleFunc("/predictors", gs.PredictorCreate).Methods("POST")
+	router.HandleFunc("/predictors/{id:[0-9]+}", gs.PredictorRead).Methods("GET")
+	router.HandleFunc("/predictors/{id:[0-9]+}", gs.PredictorEdit).Methods("PUT")
+	router.HandleFunc("/predictors/{id:[0-9]+}", gs.PredictorDelete).Methods("DELETE")
+	router.HandleFunc("/predictors/{id:[0-9]+}/sayings", gs.PredictorSayings).Methods("GET")
+
+	router.Handle("/graphql", gs.graphqlHandler()).Methods("POST")
+
+	router.HandleFunc("/webhooks", gs.WebhooksList).Methods("GET")
+	router.HandleFunc("/webhooks", gs.WebhookCreate).Methods("POST")
+	router.HandleFunc("/webhooks/{id:[0-9]+}", gs.WebhookDelete).Methods("DELETE")
+	router.HandleFunc("/webhooks/deliveries", gs.WebhookDeliveries).Methods("GET")
+	router.HandleFunc("/webhooks/deadletters", gs.WebhookDeadLetters).Methods("GET")
+	router.HandleFunc("/webhooks/deadletters/{id:[0-9]+}/retry", gs.WebhookRetry).Methods("POST")
+	return router
+}
+
+// The router behind CORS, which answers preflights for any route.
+func (gs *GlobalState) Handler(options cors.Options) http.Handler {
+	router := gs.Router()
+	options.Routable = func(r *http.Request) bool {
+		var match mux.RouteMatch
+		return router.Match(r, &match) && match.MatchErr == nil
+	}
+	return cors.Handler(options, router)
+}
+
+func startServer(gs *GlobalState) {
+	if tlsSettings.Enabled() {
+		fmt.Println("\nStarting HTTPS server on port 9999...")
+	} else {
+		fmt.Println("\nStarting server on port 9999...")
+	}
+	srv := &http.Server{Addr: ":9999", Handler: gs.Handler(corsOptions)}
+	log.Fatalln(tlsconf.ListenAndServe(srv, tlsSettings))
+}
+
+//** store operations, shared by every front end (HTTP, gRPC, TCP, GraphQL)
+// The outcome of a create.
+type Created struct {
+	Saying    *Saying
+	Duplicate *Duplicate        // closest existing match, if any (see duplicates.go)
+	Merged    bool              // Saying is that match rather than a new one
+	Replayed  bool              // answered from an earlier request with the same key
+	Response  *RecordedResponse // the HTTP answer, for creates over HTTP
+}
+
+// The optional parts of a new Saying.
+type SayingExtras struct {
+	CompanyId int // 0 for none
+	Tags      []string
+}
+
+// A new Saying needs a prediction and a predictor, given by id or by name.
+func (gs *GlobalState) CreateSaying(prediction string, predictor string, predictorId int) (*Created, error) {
+	return gs.CreateSayingWith(prediction, predictor, predictorId, SayingExtras{})
+}
+
+// CreateSaying, with a company and tags. A merged Saying keeps its own.
+func (gs *GlobalState) CreateSayingWith(prediction string, predictor string, predictorId int,
+	extras SayingExtras) (*Created, error) {
+	if err := gs.validateNew(prediction, predictor, predictorId); err != nil {
+		return nil, err
+	}
+
+	defer gs.webhooks.flush() // after the unlock; see WebhookState.enqueue
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	created, err := gs.insertSaying(prediction, predictor, predictorId, extras)
+	if err != nil || created.Merged {
+		return created, err
+	}
+	gs.changed()
+	gs.hub.publish(SayingEvent{Kind: EventCreated, Saying: *created.Saying})
+	return created, nil
+}
+
+// Add a validated Saying to the maps, without saving or announcing it,
+// unless the duplicate policy rejects it or merges it into an existing one.
+// Caller holds the lock.
+func (gs *GlobalState) insertSaying(prediction string, predictor string, predictorId int,
+	extras SayingExtras) (*Created, error) {
+	dup := gs.findDuplicate(prediction, 0)
+	if dup != nil && gs.config.DupPolicy == policyReject {
+		return nil, duplicateError{dup}
+	}
+	if dup != nil && gs.config.DupPolicy == policyMerge {
+		return &Created{Saying: gs.resolve(gs.sayings[dup.SayingId]), Duplicate: dup, Merged: true}, nil
+	}
+
+	if _, ok := gs.companies[extras.CompanyId]; extras.CompanyId != 0 && !ok {
+		return nil, notFoundError("No such Company " + strconv.Itoa(extras.CompanyId))
+	}
+	p, err := gs.lookupPredictor(predictorId, predictor)
+	if err != nil {
+		return nil, err
+	}
+	saying := &Saying{Id: gs.sayingId, PredictorId: p.Id, Prediction: prediction,
+		CompanyId: extras.CompanyId, Tags: extras.Tags}
+	gs.sayings[saying.Id] = saying
+	gs.sayingId++
+	return &Created{Saying: gs.resolve(saying), Duplicate: dup}, nil
+}
+
+func (gs *GlobalState) validateNew(prediction string, predictor string, predictorId int) error {
+	minLen := gs.minLen
+	if len(prediction) < minLen || (len(predictor) < minLen && predictorId == 0) {
+		return fmt.Errorf("Prediction/predictor must be >= %d chars.", minLen)
+	}
+	return nil
+}
+
+// An edit changes the prediction, the predictor, or both; values that are
+// too short are taken as absent.
+func (gs *GlobalState) EditSaying(id int, prediction string, predictor string, predictorId int) (*Saying, error) {
+	minLen := gs.minLen
+	if len(prediction) < minLen && len(predictor) < minLen && predictorId == 0 {
+		return nil, fmt.Errorf("Prediction/predictor must be >= %d chars.", minLen)
+	}
+
+	defer gs.webhooks.flush() // after the unlock; see WebhookState.enqueue
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	saying, ok := gs.sayings[id]
+	if !ok {
+		return nil, notFoundError("No such Saying")
+	}
+	if len(predictor) >= minLen || predictorId != 0 {
+		p, err := gs.lookupPredictor(predictorId, predictor)
+		if err != nil {
+			return nil, err
+		}
+		saying.PredictorId = p.Id
+	}
+	if len(prediction) >= minLen {
+		saying.Prediction = prediction
+	}
+	gs.changed()
+
+	edited := gs.resolve(saying)
+	gs.hub.publish(SayingEvent{Kind: EventEdited, Saying: *edited})
+	return edited, nil
+}
+
+// Replace a Saying's tags.
+func (gs *GlobalState) TagSaying(id int, tags []string) (*Saying, error) {
+	defer gs.webhooks.flush() // after the unlock; see WebhookState.enqueue
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	saying, ok := gs.sayings[id]
+	if !ok {
+		return nil, notFoundError("No such Saying")
+	}
+	saying.Tags = tags
+	gs.changed()
+
+	edited := gs.resolve(saying)
+	gs.hub.publish(SayingEvent{Kind: EventEdited, Saying: *edited})
+	return edited, nil
+}
+
+func (gs *GlobalState) DeleteSaying(id int) error {
+	defer gs.webhooks.flush() // after the unlock; see WebhookState.enqueue
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
 
-   http.Handle("/", router)
+	saying, ok := gs.sayings[id]
+	if !ok {
+		return notFoundError("No such Saying")
+	}
+	deleted := gs.resolve(saying)
+	delete(gs.sayings, id)
+	gs.changed()
 
-	fmt.Println("\nStarting server on port 9999...")
-	http.ListenAndServe(":9999", router);
+	gs.hub.publish(SayingEvent{Kind: EventDeleted, Saying: *deleted})
+	return nil
 }
 
 //** methods
@@ -226,11 +527,11 @@ func (s Saying) ToString() string {
 func (gs *GlobalState) SortSayings() []int {
 	keys := []int{}
 
-	gState.lock.RLock()
-   for k, _ := range gState.sayings {
+	gs.lock.RLock()
+   for k, _ := range gs.sayings {
       keys = append(keys, k)
    }
-	gState.lock.RUnlock()
+	gs.lock.RUnlock()
 
    sort.Ints(keys)
 	return keys
@@ -239,40 +540,90 @@ func (gs *GlobalState) SortSayings() []int {
 func (gs *GlobalState) Dumper(keys []int) {
 	fmt.Println("\nPredictions:")	
 	for _, k := range keys {
-		fmt.Println(gState.sayings[k].ToString())
+		fmt.Println(gs.resolve(gs.sayings[k]).ToString())
 	}
 }
 
 func (gs *GlobalState) ListifySayings() []*Saying {
 	list := []*Saying{}
 	
-	gState.lock.RLock()
+	gs.lock.RLock()
 	for _, v := range gs.sayings {
-		list = append(list, v)
+		list = append(list, gs.resolve(v))
 	}
-	gState.lock.RUnlock()
+	gs.lock.RUnlock()
 
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
 	return list
 }
 
+// Return a copy of the Saying with its predictor's name filled in, so that
+// readers never see a stale name and never share the stored struct.
+// Caller holds the lock.
+func (gs *GlobalState) resolve(s *Saying) *Saying {
+	if s == nil { return nil }
+
+	c := *s
+	if p, ok := gs.predictors[s.PredictorId]; ok {
+		c.Predictor = p.Name
+	}
+	return &c
+}
+
 func (gs *GlobalState) StringifySayings() string {
    var buffer bytes.Buffer
 
-	gState.lock.RLock()
-	keys := gs.SortSayings()
+	gs.lock.RLock()
+	keys := gs.sortedIds()
 	for _, k := range keys {
-		buffer.WriteString(gs.sayings[k].ToString() + "\n")
+		buffer.WriteString(gs.resolve(gs.sayings[k]).ToString() + "\n")
 	}
-	gState.lock.RUnlock()	
+	gs.lock.RUnlock()	
 
 	return buffer.String()
 }
 
 //** utility functions
-func readSaying(id int) *Saying {
-   gState.lock.RLock()
-   defer gState.lock.RUnlock()
-	return gState.sayings[id]
+// A lookup that failed because the record does not exist.
+type notFoundError string
+
+func (e notFoundError) Error() string { return string(e) }
+
+func isNotFound(err error) bool {
+	_, ok := err.(notFoundError)
+	return ok
+}
+
+// An optional id form value, such as predictorId; 0 if absent.
+func formId(request *http.Request, name string) (int, error) {
+	n := request.FormValue(name)
+	if n == "" { return 0, nil }
+
+	id, err := strconv.Atoi(n)
+	if err != nil || id < 1 {
+		return 0, errors.New("Bad " + name + " " + n)
+	}
+	return id, nil
+}
+
+// Tags are lower case, without duplicates, in the order given.
+func splitTags(s string) []string {
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(s, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !seen[t] {
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func (gs *GlobalState) readSaying(id int) *Saying {
+   gs.lock.RLock()
+   defer gs.lock.RUnlock()
+	return gs.resolve(gs.sayings[id])
 }
 
 func sendResponse(rw http.ResponseWriter, doc []byte, err error) {
@@ -283,72 +634,213 @@ func sendResponse(rw http.ResponseWriter, doc []byte, err error) {
 	}
 }
 
-func readFile(file_name string) string {
-	records, err := ioutil.ReadFile(file_name)
+func splitString(in string, delimiter string) []string {
+	return strings.Split(in, delimiter)
+}
+
+// Caller holds the lock.
+func (gs *GlobalState) createSayings(inputs string) error {
+	records, nextId, err := datafiles.ParseSayings("sayings.db", inputs)
 	if err != nil {
-		log.Fatalln("Cannot read " + file_name + ". Exiting.")
+		return err
 	}
-	return string(records)
+	gs.sayingId = nextId
+
+	// The predictor in each record of the shared file is a name: migrate
+	// it to a reference, creating the Predictor on first sight. Ids and
+	// companies are the file's, and so is the next id, which the file's
+	// "# next id:" line keeps from reusing a deleted saying's.
+	for _, r := range records {
+		gs.sayings[r.Id] = &Saying{Id: r.Id, PredictorId: gs.predictorNamed(r.Predictor, true).Id,
+			Prediction: r.Prediction, CompanyId: r.CompanyId}
+	}
+	return nil
 }
 
-func splitString(in string, delimiter string) []string {
-	return strings.Split(in, delimiter)
+// A data file's path under the configured directory.
+func (gs *GlobalState) path(file_name string) string {
+	return filepath.Join(gs.config.Dir, file_name)
 }
 
-func createSayings(inputs string) {
-	var ss = splitString(inputs, "\n")
-	if len(ss) < 1 {
-		log.Fatalln("Need > 0 sayings.")
+// Prefer the snapshot; fall back to (and migrate) the legacy sayings.db.
+// Caller holds the lock.
+func (gs *GlobalState) load() error {
+	if err := gs.loadCompanies(); err != nil {
+		return err
+	}
+	found, err := gs.loadStore(gs.path(storeFile))
+	if err != nil || found {
+		return err
 	}
+	return gs.importSayings()
+}
 
-	for _, saying := range ss {
-		parts := splitString(saying, "!")
-		if len(parts) == 2 {
-			saying := new(Saying)
-			saying.Id = gState.sayingId
-			saying.Predictor = parts[0]
-			saying.Prediction = parts[1]
-			gState.sayings[gState.sayingId] = saying
-			gState.sayingId++
-		}
+// Read the sayings from sayings.db and snapshot them. Caller holds the lock.
+func (gs *GlobalState) importSayings() error {
+	records, err := ioutil.ReadFile(gs.path("sayings.db"))
+	if err != nil {
+		return err
+	}
+	if err := gs.createSayings(string(records)); err != nil {
+		return err
+	}
+	gs.save()
+	return nil
+}
+
+// Re-import the data files, which the snapshot shadows from the first
+// start on: the sayings and their ids are sayings.db's again, replacing
+// those in the snapshot, and the idempotency keys, which name the old
+// ones, are forgotten. Predictors are the store's own, so they are kept,
+// and the file's are matched to them by name. If the files cannot be
+// loaded, the store is left as it was.
+func (gs *GlobalState) reload() error {
+	gs.lock.Lock()
+	sayings, companies, idempotency, sayingId, modified := gs.sayings, gs.companies, gs.idempotency, gs.sayingId, gs.modified
+	gs.sayings = make(map[int]*Saying)
+	gs.companies = make(map[int]*Company)
+	gs.idempotency = make(map[string]*IdempotencyRecord)
+	gs.sayingId = 1
+	gs.modified = time.Now()
+	err := gs.loadCompanies()
+	if err == nil {
+		err = gs.importSayings()
 	}
+	if err != nil {
+		gs.sayings, gs.companies, gs.idempotency, gs.sayingId, gs.modified = sayings, companies, idempotency, sayingId, modified
+		gs.lock.Unlock()
+		return err
+	}
+	gs.lock.Unlock()
+
+	gs.signatures.reset()
+	gs.stats.rebuild(gs.ListifySayings())
+	gs.cache.flush()
+	return nil
 }
 
-func readAndDumpData() {
-	createSayings(readFile("sayings.db"))
-	gState.Dumper(gState.SortSayings())
+// A GlobalState with its data loaded from the files in config.Dir, its
+// statistics built, webhooks reloaded, and its health checks registered.
+// The webhook deliveries start with StartWebhooks.
+func NewGlobalState(config Config) (*GlobalState, error) {
+	if config.DupPolicy != policyReject && config.DupPolicy != policyWarn && config.DupPolicy != policyMerge {
+		return nil, errors.New("Unknown duplicate policy " + config.DupPolicy)
+	}
+	if _, err := time.LoadLocation(config.DailyZone); err != nil {
+		return nil, errors.New("Unknown timezone " + config.DailyZone)
+	}
+
+	gs := &GlobalState {
+		sayings:     make(map[int]*Saying),
+		predictors:  make(map[int]*Predictor),
+		companies:   make(map[int]*Company),
+		idempotency: make(map[string]*IdempotencyRecord),
+      sayingId:    1,
+		predictorId: 1,
+		indent1:     " ",
+		indent2:     "  ",  
+      minLen:      6,
+		modified:    time.Now(),
+		stopping:    make(chan struct{}),
+		config:      config,
+		hub:         newEventHub(),
+		cache:       newResponseCache(),
+		stats:       newStatsState(),
+		checker:     health.New(),
+		signatures:  newSignatureCache()}
+
+	gs.lock.Lock()
+	err := gs.load()
+	gs.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if gs.daily, err = loadDaily(gs.path(dailyFile)); err != nil {
+		return nil, err
+	}
+	if gs.webhooks, err = loadWebhooks(gs.path(webhooksFile)); err != nil {
+		return nil, err
+	}
+
+	gs.stats.rebuild(gs.ListifySayings())
+	gs.hub.listen(gs.stats.record)
+	gs.hub.listen(gs.webhooks.enqueue)
+	gs.hub.listen(gs.signatures.forget)
+	gs.registerChecks()
+	return gs, nil
 }
 
-func initialize() {
-	gState = &GlobalState {
-		sayings:   make(map[int]*Saying),
-      sayingId:  1,
-		indent1:   " ",
-		indent2:   "  ",  
-	   shutDown:  false,
-      minLen:    6}
-	readAndDumpData()
+// Stop serving: handlers answer nothing from here on, and /readyz fails.
+func (gs *GlobalState) Shutdown() {
+	if gs.shutDown.Swap(true) {
+		return
+	}
+	close(gs.stopping)
+	gs.checker.Drain()
 }
 
 //** main
 func main() {
-	// Point var globalState to a GlobalState instance, which embeds
-	// maps for Sayings together with auto-incremented counter for the Id.
-   // The data are read from the file sayings.db.
-	initialize()   
+	// With -tls-cert and -tls-key, serve HTTPS (and HTTP/2); a SIGHUP
+	// then reloads the certificate. See gencert for a development pair.
+	// -cors-origins lets browser clients on those origins call in.
+	// -grpc-addr and -tcp-addr set where the gRPC and line-protocol
+	// services listen ("" to disable).
+	config := DefaultConfig()
+	tlsSettings.RegisterFlags()
+	corsOptions.RegisterFlags()
+	grpcAddr := flag.String("grpc-addr", ":9998", "gRPC listen address, or empty for none")
+	tcpAddr := flag.String("tcp-addr", "127.0.0.1:9876", "line-protocol listen address, or empty for none")
+	tcpIdle := flag.Duration("tcp-idle", 5*time.Minute, "close line-protocol connections idle this long")
+	flag.StringVar(&config.Dir, "data-dir", config.Dir, "directory of the data files (default: the working directory)")
+	flag.DurationVar(&config.IdempotencyTTL, "idempotency-ttl", config.IdempotencyTTL, "how long Idempotency-Keys are remembered")
+	flag.StringVar(&config.DupPolicy, "dup-policy", config.DupPolicy, "on a near-duplicate saying: reject, warn or merge")
+	flag.StringVar(&config.DailyZone, "daily-tz", config.DailyZone, "default timezone for /sayings/daily")
+	flag.Float64Var(&config.DupThreshold, "dup-threshold", config.DupThreshold, "similarity (0-1) at which sayings count as duplicates")
+	flag.Parse()
+
+	// A GlobalState embeds maps for Sayings and Predictors together with
+	// auto-incremented counters for their Ids. The data are read from the
+	// snapshot in store.json or, failing that, from the file sayings.db;
+	// GET /reload imports sayings.db again after it is edited.
+	gs, err := NewGlobalState(config)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	gs.Dumper(gs.SortSayings())
+
+	// Webhooks fire on every change to the store from here on.
+	gs.StartWebhooks()
 
 	// Create a Gorilla router that maps HTTP requests to handler functions
 	// and start the HTTP server, which uses the router.
-	go startServer()
+	go startServer(gs)
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		grpcServer = startGRPC(gs, *grpcAddr)
+	}
+	var service *Service
+	if *tcpAddr != "" {
+		listener := getListener(*tcpAddr)
+		log.Println("Listening for line protocol on", listener.Addr())
+		service = NewService(gs, *tcpIdle)
+		go service.Serve(listener)
+	}
 
 	// Gracefully shut down by pausing to allow current requests to be
 	// handled. No new requests are processed during shutdown.
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM) // control-C
 	log.Println(<-ch)
 
-	gState.shutDown = true
+	gs.Shutdown()
 	log.Println("Gracefully shutting down...")
+	if grpcServer != nil {
+		go grpcServer.GracefulStop()
+	}
+	if service != nil {
+		go service.Stop()
+	}
 	time.Sleep(time.Duration(5) * time.Second)
 	os.Exit(0) // kill all goroutines
 }
@@ -0,0 +1,1170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"cors"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"rest/sayingspb"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// End-to-end tests: each runs a GlobalState over a copy of testdata in its
+// own directory, served by httptest through the same router as main.
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard) // the handlers log every request
+	os.Exit(m.Run())
+}
+
+type testServer struct {
+	*httptest.Server
+	gs *GlobalState
+	t  *testing.T
+}
+
+// The fixture: a copy of the data files, testdata's unless others are
+// named, in a directory of the test's own, with the config to match.
+func testConfig(t *testing.T, files ...string) Config {
+	t.Helper()
+	if len(files) == 0 {
+		files = []string{"testdata/sayings.db", "testdata/companies.csv"}
+	}
+	dir := t.TempDir()
+	for _, file_name := range files {
+		doc, err := ioutil.ReadFile(file_name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.Base(file_name)), doc, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := DefaultConfig()
+	config.Dir = dir
+	config.DailyZone = "UTC"
+	return config
+}
+
+// A server over the fixture, with config adjusted by tweak (which may be
+// nil).
+func newTestServer(t *testing.T, tweak func(*Config), files ...string) *testServer {
+	t.Helper()
+	config := testConfig(t, files...)
+	if tweak != nil {
+		tweak(&config)
+	}
+	gs, err := NewGlobalState(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs.StartWebhooks()
+
+	ts := &testServer{Server: httptest.NewServer(gs.Router()), gs: gs, t: t}
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// Send a request, with form (if any) as the body, and return the response
+// with its body read.
+func (ts *testServer) do(method string, path string, form url.Values, header http.Header) (*http.Response, string) {
+	ts.t.Helper()
+	response, body, err := ts.send(method, path, form, header)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return response, body
+}
+
+// As do, but returning an error rather than failing the test, so it is
+// safe in other goroutines.
+func (ts *testServer) send(method string, path string, form url.Values, header http.Header) (*http.Response, string, error) {
+	var body *strings.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+	request, err := http.NewRequest(method, ts.URL+path, body)
+	if err != nil {
+		return nil, "", err
+	}
+	if form != nil {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+	doc, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return response, string(doc), nil
+}
+
+func (ts *testServer) get(path string) (*http.Response, string) {
+	ts.t.Helper()
+	return ts.do("GET", path, nil, nil)
+}
+
+// GET path and decode its JSON into v.
+func (ts *testServer) getJSON(path string, v interface{}) {
+	ts.t.Helper()
+	response, body := ts.get(path)
+	if response.StatusCode != http.StatusOK {
+		ts.t.Fatalf("GET %s: %s: %s", path, response.Status, body)
+	}
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		ts.t.Fatalf("GET %s: %v in %q", path, err, body)
+	}
+}
+
+func (ts *testServer) sayings() []*Saying {
+	ts.t.Helper()
+	list := []*Saying{}
+	ts.getJSON("/sayingsJSON", &list)
+	return list
+}
+
+// Create a Saying and return its id.
+func (ts *testServer) create(predictor string, prediction string) int {
+	ts.t.Helper()
+	id, body, err := ts.tryCreate(predictor, prediction)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if id == 0 {
+		ts.t.Fatalf("create: %q", body)
+	}
+	return id
+}
+
+// Create a Saying and return its id, or 0 and the answer if the service
+// refuses. Like send, and unlike create, it is safe in other goroutines.
+func (ts *testServer) tryCreate(predictor string, prediction string) (int, string, error) {
+	_, body, err := ts.send("POST", "/sayingCreate", url.Values{"predictor": {predictor}, "prediction": {prediction}}, nil)
+	var id int
+	fmt.Sscanf(body, "New Saying %d created", &id)
+	return id, body, err
+}
+
+// Remove one of the data files.
+func (ts *testServer) remove(name string) {
+	ts.t.Helper()
+	if err := os.Remove(ts.gs.path(name)); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+func expect(t *testing.T, what string, got interface{}, want interface{}) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func expectStatus(t *testing.T, what string, response *http.Response, want int) {
+	t.Helper()
+	if response.StatusCode != want {
+		t.Errorf("%s: status %s, want %d", what, response.Status, want)
+	}
+}
+
+//** reading
+func TestReadSayings(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	list := ts.sayings()
+	expect(t, "sayings", len(list), 5)
+	expect(t, "first predictor", list[0].Predictor, "Eryn Hackett")
+	expect(t, "first company", list[0].CompanyId, 1)
+	expect(t, "fourth company", list[3].CompanyId, 0)
+
+	var one Saying
+	ts.getJSON("/sayingJSON/2", &one)
+	expect(t, "saying 2", one.Predictor, "Kristopher Ebert")
+
+	_, body := ts.get("/sayingsXML")
+	var doc struct {
+		Sayings []Saying `xml:"Saying"`
+	}
+	if err := xml.Unmarshal([]byte("<Sayings>"+body+"</Sayings>"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "XML sayings", len(doc.Sayings), 5)
+
+	_, body = ts.get("/sayingXML/3")
+	if !strings.Contains(body, "<Predictor>Caleigh Ortiz</Predictor>") {
+		t.Errorf("sayingXML/3: %q", body)
+	}
+	_, body = ts.get("/sayingsPlain")
+	expect(t, "plain lines", strings.Count(body, "\n"), 5)
+	_, body = ts.get("/sayingPlain/5")
+	if !strings.Contains(body, "Brant Bailey") {
+		t.Errorf("sayingPlain/5: %q", body)
+	}
+
+	response, _ := ts.get("/sayingJSON/x")
+	expectStatus(t, "non-numeric id", response, http.StatusNotFound)
+}
+
+// The sayings.db that gorilla-mux keeps, read as it is in the repo.
+func TestRepoData(t *testing.T) {
+	ts := newTestServer(t, nil, "../gorilla-mux/sayings.db", "../gorilla-mux/companies.csv")
+
+	expect(t, "companies", len(ts.gs.ListifyCompanies()), 16)
+	expect(t, "second company's industry", ts.gs.readCompany(2).Industry, "Software")
+	list := ts.sayings()
+	expect(t, "sayings", len(list), 16)
+	expect(t, "third saying's company", list[2].CompanyId, 3)
+	if strings.Contains(list[0].Prediction, "!") {
+		t.Errorf("company id left in the prediction: %q", list[0].Prediction)
+	}
+	_, body := ts.get("/sayingsPlain")
+	expect(t, "plain lines", strings.Count(body, "\n"), 16)
+	var predictors []*Predictor
+	ts.getJSON("/predictors", &predictors)
+	expect(t, "predictors", len(predictors), 16)
+
+	var snap snapshot
+	if _, err := readJSONFile(ts.gs.path(storeFile), &snap); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "saved sayings", len(snap.Sayings), 16)
+}
+
+// A legacy companies.db is migrated to companies.csv, numbered in file
+// order.
+func TestLegacyCompanies(t *testing.T) {
+	ts := newTestServer(t, nil, "testdata/sayings.db", "testdata/companies.db")
+
+	expect(t, "companies", len(ts.gs.ListifyCompanies()), 3)
+	expect(t, "first company", ts.gs.readCompany(1).Name, "Donnelly, Block and Runte")
+	if _, err := os.Stat(ts.gs.path(companiesFile)); err != nil {
+		t.Errorf("not migrated: %v", err)
+	}
+}
+
+func TestCachedLists(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	response, plain := ts.get("/sayingsJSON")
+	modified := response.Header.Get("Last-Modified")
+	if modified == "" {
+		t.Fatal("no Last-Modified")
+	}
+	response, _ = ts.do("GET", "/sayingsJSON", nil, http.Header{"If-Modified-Since": {modified}})
+	expectStatus(t, "conditional GET", response, http.StatusNotModified)
+
+	// The client's transport would decompress by itself if let.
+	request, _ := http.NewRequest("GET", ts.URL+"/sayingsJSON", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	response, err := ts.Client().Transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	expect(t, "encoding", response.Header.Get("Content-Encoding"), "gzip")
+	reader, err := gzip.NewReader(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unzipped, _ := ioutil.ReadAll(reader)
+	expect(t, "gzipped body", string(unzipped) == plain, true)
+
+	// A change empties the cache.
+	ts.create("Test Predictor", "Caches will be flushed on every change.")
+	expect(t, "sayings after create", len(ts.sayings()), 6)
+}
+
+//** changing
+func TestCreateEditDelete(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	_, body := ts.do("POST", "/sayingCreate", url.Values{"predictor": {"Ann"}, "prediction": {"Soon."}}, nil)
+	expect(t, "too short", body, "Prediction/predictor must be >= 6 chars.")
+
+	id := ts.create("Test Predictor", "Testing will become fashionable again.")
+	expect(t, "new id", id, 6)
+
+	_, body = ts.do("PUT", "/sayingEdit", url.Values{"id": {"6"}, "prediction": {"Testing will stay fashionable."}}, nil)
+	expect(t, "edit", body, "Saying 6 updated\n.")
+	_, body = ts.do("PUT", "/sayingEdit", url.Values{"prediction": {"No id here."}}, nil)
+	expect(t, "edit without id", body, "No Id provided")
+
+	_, body = ts.do("PUT", "/sayings/6/tags", url.Values{"tags": {"Tech, testing"}}, nil)
+	expect(t, "tag", body, "Saying 6 tagged\n.")
+
+	var s Saying
+	ts.getJSON("/sayingJSON/6", &s)
+	expect(t, "edited prediction", s.Prediction, "Testing will stay fashionable.")
+	expect(t, "tags", s.Tags, []string{"tech", "testing"})
+
+	// A create may name a company and tags as well.
+	form := url.Values{"predictor": {"Test Predictor"}, "prediction": {"Companies will tag their sayings."},
+		"companyId": {"2"}, "tags": {"Business, business,tech"}}
+	_, body = ts.do("POST", "/sayingCreate", form, nil)
+	expect(t, "create with extras", body, "New Saying 7 created\n.")
+	ts.getJSON("/sayingJSON/7", &s)
+	expect(t, "company", s.CompanyId, 2)
+	expect(t, "created tags", s.Tags, []string{"business", "tech"})
+	form.Set("companyId", "99")
+	_, body = ts.do("POST", "/sayingCreate", form, nil)
+	expect(t, "unknown company", body, "No such Company 99")
+	form.Set("companyId", "x")
+	_, body = ts.do("POST", "/sayingCreate", form, nil)
+	expect(t, "bad company", body, "Bad companyId x")
+
+	_, body = ts.do("DELETE", "/sayingDelete/6", nil, nil)
+	expect(t, "delete", body, "Saying 6 deleted\n.")
+	_, body = ts.do("DELETE", "/sayingDelete/7", nil, nil)
+	expect(t, "delete", body, "Saying 7 deleted\n.")
+	expect(t, "sayings after delete", len(ts.sayings()), 5)
+
+	// The snapshot carries the changes over to a fresh GlobalState.
+	gs, err := NewGlobalState(ts.gs.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "reloaded sayings", len(gs.ListifySayings()), 5)
+	expect(t, "reloaded next id", gs.sayingId, 8)
+}
+
+// Every route that names a Saying, Predictor or Webhook answers 404 for
+// one that does not exist.
+func TestMissingIds(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	for _, c := range []struct {
+		method string
+		path   string
+		form   url.Values
+	}{
+		{"GET", "/sayingXML/99", nil},
+		{"GET", "/sayingJSON/99", nil},
+		{"GET", "/sayingPlain/99", nil},
+		{"PUT", "/sayingEdit", url.Values{"id": {"99"}, "prediction": {"Nothing to edit here."}}},
+		{"DELETE", "/sayingDelete/99", nil},
+		{"PUT", "/sayings/99/tags", url.Values{"tags": {"tech"}}},
+		{"GET", "/predictors/99", nil},
+		{"PUT", "/predictors/99", url.Values{"affiliation": {"Nobody Inc."}}},
+		{"DELETE", "/predictors/99", nil},
+		{"GET", "/predictors/99/sayings", nil},
+		{"DELETE", "/webhooks/99", nil},
+		{"POST", "/webhooks/deadletters/99/retry", nil},
+	} {
+		response, body := ts.do(c.method, c.path, c.form, nil)
+		expectStatus(t, c.method+" "+c.path+" ("+body+")", response, http.StatusNotFound)
+	}
+	expect(t, "sayings", len(ts.sayings()), 5)
+}
+
+func TestIdempotentCreate(t *testing.T) {
+	ts := newTestServer(t, nil)
+	form := url.Values{"predictor": {"Test Predictor"}, "prediction": {"Retries will be harmless."}}
+	key := http.Header{"Idempotency-Key": {"abc"}}
+
+	_, first := ts.do("POST", "/sayingCreate", form, key)
+	response, second := ts.do("POST", "/sayingCreate", form, key)
+	expect(t, "replay", second, first)
+	expect(t, "replayed header", response.Header.Get("Idempotent-Replayed"), "true")
+	expect(t, "sayings", len(ts.sayings()), 6)
+
+	form.Set("prediction", "Something else entirely.")
+	_, body := ts.do("POST", "/sayingCreate", form, key)
+	if !strings.Contains(body, "was used for a different request") {
+		t.Errorf("reused key: %q", body)
+	}
+
+	// A replay is the whole first answer, duplicate flag included, even
+	// after a restart.
+	for _, policy := range []string{policyWarn, policyMerge} {
+		ts := newTestServer(t, func(c *Config) { c.DupPolicy = policy })
+		form := url.Values{"predictor": {"Test Predictor"},
+			"prediction": {"Realigned reciprocal concept will evolve turn-key action-items!"}}
+		first, firstBody := ts.do("POST", "/sayingCreate", form, key)
+		expect(t, policy+" flagged", first.Header.Get("X-Duplicate-Of"), "1")
+
+		gs, err := NewGlobalState(ts.gs.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restarted := &testServer{Server: httptest.NewServer(gs.Router()), gs: gs, t: t}
+		defer restarted.Close()
+		for what, server := range map[string]*testServer{"replay": ts, "replay after restart": restarted} {
+			response, body := server.do("POST", "/sayingCreate", form, key)
+			expectStatus(t, policy+" "+what, response, first.StatusCode)
+			expect(t, policy+" "+what, body, firstBody)
+			expect(t, policy+" "+what+" flagged", response.Header.Get("X-Duplicate-Of"), "1")
+			expect(t, policy+" "+what+" header", response.Header.Get("Idempotent-Replayed"), "true")
+		}
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.DupPolicy = policyReject })
+
+	prediction := "Realigned reciprocal concept will evolve turn-key action-items!"
+	response, body := ts.do("POST", "/sayingCreate", url.Values{"predictor": {"Test Predictor"}, "prediction": {prediction}}, nil)
+	expectStatus(t, "near-duplicate", response, http.StatusConflict)
+	expect(t, "duplicate of", response.Header.Get("X-Duplicate-Of"), "1")
+	if !strings.HasPrefix(body, "Duplicate of Saying 1") {
+		t.Errorf("near-duplicate: %q", body)
+	}
+
+	var pairs []*DuplicatePair
+	ts.getJSON("/sayings/duplicates", &pairs)
+	expect(t, "pairs", len(pairs), 0)
+	response, _ = ts.get("/sayings/duplicates?threshold=2")
+	expectStatus(t, "bad threshold", response, http.StatusBadRequest)
+
+	// An edit replaces the cached signature, a deletion drops it.
+	edited := "Quantum blockchain synergies will disrupt every enterprise cloud."
+	ts.do("PUT", "/sayingEdit", url.Values{"id": {"2"}, "prediction": {edited}}, nil)
+	response, _ = ts.do("POST", "/sayingCreate", url.Values{"predictor": {"Test Predictor"},
+		"prediction": {"Quantum blockchain synergies will disrupt every enterprise clouds."}}, nil)
+	expectStatus(t, "near-duplicate of edit", response, http.StatusConflict)
+	expect(t, "duplicate of edit", response.Header.Get("X-Duplicate-Of"), "2")
+	ts.do("DELETE", "/sayingDelete/2", nil, nil)
+	ts.gs.signatures.lock.Lock()
+	_, cached := ts.gs.signatures.sigs[2]
+	ts.gs.signatures.lock.Unlock()
+	expect(t, "signature of deleted", cached, false)
+}
+
+//** selection and analytics
+func TestRandomAndDaily(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	var a, b Saying
+	ts.getJSON("/sayings/random?seed=42", &a)
+	ts.getJSON("/sayings/random?seed=42", &b)
+	expect(t, "same seed", a.Id, b.Id)
+
+	ts.getJSON("/sayings/random?predictor=brant+bailey", &a)
+	expect(t, "by predictor", a.Id, 5)
+	response, _ := ts.get("/sayings/random?tag=none")
+	expectStatus(t, "no match", response, http.StatusNotFound)
+	response, _ = ts.get("/sayings/random?seed=x")
+	expectStatus(t, "bad seed", response, http.StatusBadRequest)
+
+	ts.getJSON("/sayings/daily", &a)
+	ts.getJSON("/sayings/daily", &b)
+	expect(t, "daily", a.Id, b.Id)
+	if _, err := os.Stat(ts.gs.path(dailyFile)); err != nil {
+		t.Errorf("daily pick not saved: %v", err)
+	}
+	response, _ = ts.get("/sayings/daily?tz=Mars/Olympus")
+	expectStatus(t, "bad timezone", response, http.StatusBadRequest)
+}
+
+func TestStats(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.create("Eryn Hackett", "Reciprocal concepts will evolve further still.")
+
+	var stats SayingStats
+	ts.getJSON("/sayings/stats?top=3", &stats)
+	expect(t, "sayings", stats.Sayings, 6)
+	expect(t, "top predictor", stats.Predictors[0].Predictor, "Eryn Hackett")
+	expect(t, "top predictor's sayings", stats.Predictors[0].Sayings, 2)
+	expect(t, "words", len(stats.Words), 3)
+	expect(t, "created in the last minute", stats.Rates[0].Created, 1)
+
+	_, body := ts.get("/sayings/stats?format=plain")
+	if !strings.HasPrefix(body, "6 sayings") {
+		t.Errorf("plain stats: %q", body)
+	}
+	response, _ := ts.get("/sayings/stats?top=0")
+	expectStatus(t, "bad top", response, http.StatusBadRequest)
+}
+
+//** predictors
+func TestPredictors(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	var list []*Predictor
+	ts.getJSON("/predictors", &list)
+	expect(t, "predictors", len(list), 5)
+
+	_, body := ts.do("POST", "/predictors", url.Values{"name": {"Test Predictor"}}, nil)
+	expect(t, "create", body, "New Predictor 6 created\n.")
+	response, _ := ts.do("POST", "/predictors", url.Values{"name": {"Test Predictor"}}, nil)
+	expectStatus(t, "create again", response, http.StatusConflict)
+
+	_, body = ts.do("PUT", "/predictors/6", url.Values{"affiliation": {"Testing Inc."}}, nil)
+	expect(t, "edit", body, "Predictor 6 updated\n.")
+	var p Predictor
+	ts.getJSON("/predictors/6", &p)
+	expect(t, "affiliation", p.Affiliation, "Testing Inc.")
+
+	var sayings []*Saying
+	ts.getJSON("/predictors/1/sayings", &sayings)
+	expect(t, "sayings by 1", len(sayings), 1)
+
+	response, _ = ts.do("DELETE", "/predictors/1", nil, nil)
+	expectStatus(t, "delete with sayings", response, http.StatusConflict)
+	_, body = ts.do("DELETE", "/predictors/6", nil, nil)
+	expect(t, "delete", body, "Predictor 6 deleted\n.")
+	response, _ = ts.get("/predictors/6")
+	expectStatus(t, "deleted", response, http.StatusNotFound)
+}
+
+//** GraphQL
+func TestGraphQL(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	query := func(q string) map[string]interface{} {
+		t.Helper()
+		doc, _ := json.Marshal(map[string]string{"query": q})
+		response, err := ts.Client().Post(ts.URL+"/graphql", "application/json", bytes.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var result struct {
+			Data   map[string]interface{}
+			Errors []interface{}
+		}
+		if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Errors) > 0 {
+			t.Fatalf("%s: %v", q, result.Errors)
+		}
+		return result.Data
+	}
+
+	data := query(`{ saying(id: 1) { predictor { name } company { name } } }`)
+	saying := data["saying"].(map[string]interface{})
+	expect(t, "predictor", saying["predictor"].(map[string]interface{})["name"], "Eryn Hackett")
+	expect(t, "company", saying["company"].(map[string]interface{})["name"], "Donnelly, Block and Runte")
+
+	// The same fields as the REST and gRPC views of the data.
+	ts.do("PUT", "/sayings/1/tags", url.Values{"tags": {"tech, ai"}}, nil)
+	data = query(`{ saying(id: 1) { tags company { website industry founded } } }`)
+	saying = data["saying"].(map[string]interface{})
+	expect(t, "tags", saying["tags"], []interface{}{"tech", "ai"})
+	company := saying["company"].(map[string]interface{})
+	expect(t, "website", company["website"], "https://donnellyblock.example.com")
+	expect(t, "industry", company["industry"], "Logistics")
+	expect(t, "founded", company["founded"], 1987)
+	data = query(`{ saying(id: 2) { tags } company(id: 3) { website } }`)
+	expect(t, "no tags", data["saying"].(map[string]interface{})["tags"], []interface{}{})
+	expect(t, "no website", data["company"].(map[string]interface{})["website"], "")
+
+	data = query(`mutation { createSaying(prediction: "GraphQL will outlive REST.", predictor: "Test Predictor") { id } }`)
+	expect(t, "created", data["createSaying"].(map[string]interface{})["id"], 6)
+	data = query(`{ sayings(first: 2) { totalCount hasNextPage } }`)
+	page := data["sayings"].(map[string]interface{})
+	expect(t, "total", page["totalCount"], 6)
+	expect(t, "more", page["hasNextPage"], true)
+	data = query(`mutation { deleteSaying(id: 6) }`)
+	expect(t, "deleted", data["deleteSaying"], true)
+}
+
+//** webhooks
+func TestWebhooks(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	type received struct {
+		event     string
+		payload   WebhookPayload
+		signature string
+		body      []byte
+	}
+	deliveries := make(chan received, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var got received
+		got.event = r.Header.Get("X-Sayings-Event")
+		got.signature = r.Header.Get("X-Sayings-Signature")
+		got.body = body
+		json.Unmarshal(body, &got.payload)
+		deliveries <- got
+	}))
+	defer receiver.Close()
+
+	form := url.Values{"url": {receiver.URL}, "secret": {"s3cret"}, "events": {"created,deleted"}}
+	_, body := ts.do("POST", "/webhooks", form, nil)
+	expect(t, "create", body, "New Webhook 1 created\n.")
+	response, _ := ts.do("POST", "/webhooks", url.Values{"url": {"ftp://x"}, "secret": {"s"}}, nil)
+	expectStatus(t, "bad url", response, http.StatusBadRequest)
+
+	var hooks []Webhook
+	ts.getJSON("/webhooks", &hooks)
+	expect(t, "webhooks", len(hooks), 1)
+	expect(t, "secret withheld", hooks[0].Secret, "")
+
+	id := ts.create("Test Predictor", "Webhooks will be delivered promptly.")
+	select {
+	case got := <-deliveries:
+		expect(t, "event", got.event, EventCreated)
+		expect(t, "saying", got.payload.Saying.Id, id)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(got.body)
+		expect(t, "signature", got.signature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+
+	var report struct {
+		Pending  []*Delivery
+		Attempts []*DeliveryAttempt
+	}
+	for i := 0; i < 50; i++ { // the attempt is logged just after the POST
+		ts.getJSON("/webhooks/deliveries", &report)
+		if len(report.Attempts) > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	expect(t, "attempts", len(report.Attempts), 1)
+	var dead []*Delivery
+	ts.getJSON("/webhooks/deadletters", &dead)
+	expect(t, "dead letters", len(dead), 0)
+	response, _ = ts.do("POST", "/webhooks/deadletters/1/retry", nil, nil)
+	expectStatus(t, "retry nothing", response, http.StatusNotFound)
+
+	_, body = ts.do("DELETE", "/webhooks/1", nil, nil)
+	expect(t, "delete", body, "Webhook 1 deleted\n.")
+	response, _ = ts.do("DELETE", "/webhooks/1", nil, nil)
+	expectStatus(t, "delete again", response, http.StatusNotFound)
+}
+
+// Dead letters are capped, and a deleted webhook takes its queued
+// deliveries and dead letters with it, in the file as well.
+func TestWebhookCleanup(t *testing.T) {
+	ts := newTestServer(t, nil)
+	refusing := httptest.NewServer(http.NotFoundHandler())
+	refusing.Close()
+	ts.do("POST", "/webhooks", url.Values{"url": {refusing.URL}, "secret": {"s"}}, nil)
+
+	ws := ts.gs.webhooks
+	ws.lock.Lock()
+	hook := *ws.Hooks[1]
+	for i := 0; i < maxDeadLetters; i++ {
+		ws.Dead = append(ws.Dead, &Delivery{Id: 100 + i, WebhookId: 1})
+	}
+	last := &Delivery{Id: 99, WebhookId: 1, Attempts: maxAttempts - 1}
+	later := &Delivery{Id: 98, WebhookId: 1, NextAttempt: time.Now().Add(time.Hour)}
+	ws.Queue = append(ws.Queue, last, later)
+	ws.lock.Unlock()
+
+	ws.attempt(last, hook)
+	var dead []*Delivery
+	ts.getJSON("/webhooks/deadletters", &dead)
+	expect(t, "dead letters", len(dead), maxDeadLetters)
+	expect(t, "newest dead", dead[len(dead)-1].Id, 99)
+
+	ts.do("DELETE", "/webhooks/1", nil, nil)
+	ts.getJSON("/webhooks/deadletters", &dead)
+	expect(t, "dead after delete", len(dead), 0)
+	saved, err := loadWebhooks(ts.gs.path(webhooksFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "saved queue", len(saved.Queue), 0)
+	expect(t, "saved dead", len(saved.Dead), 0)
+}
+
+// Webhook changes and queued deliveries are on disk before the request
+// that made them is answered, so a crash before the worker gets to them
+// loses nothing.
+func TestWebhookPersistence(t *testing.T) {
+	config := testConfig(t)
+	gs, err := NewGlobalState(config) // whose worker is never started
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{Server: httptest.NewServer(gs.Router()), gs: gs, t: t}
+	defer ts.Close()
+	events := make(chan string, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		events <- r.Header.Get("X-Sayings-Event")
+	}))
+	defer receiver.Close()
+
+	ts.do("POST", "/webhooks", url.Values{"url": {receiver.URL}, "secret": {"kept"}}, nil)
+	ts.do("POST", "/webhooks", url.Values{"url": {receiver.URL}, "secret": {"deleted"}}, nil)
+	_, body := ts.do("DELETE", "/webhooks/2", nil, nil)
+	expect(t, "delete", body, "Webhook 2 deleted\n.")
+	saved, err := loadWebhooks(gs.path(webhooksFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "saved hooks", len(saved.Hooks), 1)
+	if saved.Hooks[2] != nil {
+		t.Error("deleted webhook saved")
+	}
+
+	ts.create("Test Predictor", "Queued deliveries will survive a crash.")
+	if saved, err = loadWebhooks(gs.path(webhooksFile)); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "saved queue", len(saved.Queue), 1)
+
+	// On restart, the queued delivery goes out.
+	restarted, err := NewGlobalState(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.StartWebhooks()
+	select {
+	case event := <-events:
+		expect(t, "delivered", event, EventCreated)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery after the restart")
+	}
+	for i := 0; i < 50; i++ { // let the worker record it before the directory goes
+		if saved, _ = loadWebhooks(gs.path(webhooksFile)); saved != nil && len(saved.Queue) == 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+//** operations
+func TestHealthAndReload(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	response, _ := ts.get("/healthz")
+	expectStatus(t, "healthz", response, http.StatusOK)
+	response, body := ts.get("/readyz")
+	expectStatus(t, "readyz", response, http.StatusOK)
+	if !strings.Contains(body, `"Status": "ok"`) {
+		t.Errorf("readyz: %s", body)
+	}
+
+	// The companies file is optional, for readiness as for loading.
+	ts.remove(companiesFile)
+	response, _ = ts.get("/readyz")
+	expectStatus(t, "readyz without companies", response, http.StatusOK)
+
+	// Reload re-imports an edited sayings.db over the snapshot, keeping
+	// the predictors, and snapshots the result.
+	ts.create("Test Predictor", "Reloading will forget this.")
+	db, err := ioutil.ReadFile(ts.gs.path("sayings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(db), "# next id: 6\n",
+		"Test Predictor!Editing the file will show after a reload.\n# next id: 7\n", 1)
+	if err := ioutil.WriteFile(ts.gs.path("sayings.db"), []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, body = ts.get("/reload")
+	expect(t, "reload", body, "Reloaded data.")
+	sayings := ts.sayings()
+	expect(t, "sayings after reload", len(sayings), 6)
+	expect(t, "from the file", sayings[5].Prediction, "Editing the file will show after a reload.")
+	expect(t, "predictor kept", sayings[5].PredictorId, ts.gs.predictorNamed("Test Predictor", false).Id)
+	var stats SayingStats
+	ts.getJSON("/sayings/stats", &stats)
+	expect(t, "stats after reload", stats.Sayings, 6)
+
+	gs, err := NewGlobalState(ts.gs.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "snapshot after reload", len(gs.ListifySayings()), 6)
+
+	// A file that will not load leaves the store as it was.
+	if err := ioutil.WriteFile(ts.gs.path("sayings.db"), []byte("No separator here.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	response, _ = ts.get("/reload")
+	expectStatus(t, "bad reload", response, http.StatusInternalServerError)
+	expect(t, "sayings after a bad reload", len(ts.sayings()), 6)
+	ts.getJSON("/sayings/stats", &stats)
+	expect(t, "stats after a bad reload", stats.Sayings, 6)
+}
+
+func TestBadConfig(t *testing.T) {
+	for what, tweak := range map[string]func(*Config){
+		"no data files": func(c *Config) { c.Dir = t.TempDir() },
+		"bad policy":    func(c *Config) { c.DupPolicy = "ignore" },
+		"bad timezone":  func(c *Config) { c.DailyZone = "Mars/Olympus" },
+	} {
+		config := testConfig(t)
+		tweak(&config)
+		if _, err := NewGlobalState(config); err == nil {
+			t.Errorf("%s: no error", what)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	ts := newTestServer(t, nil)
+	srv := httptest.NewServer(ts.gs.Handler(cors.Options{AllowedOrigins: cors.List{"https://example.com"},
+		AllowedMethods: cors.List{"GET", "POST"}}))
+	defer srv.Close()
+
+	preflight := func(path string, method string) *http.Response {
+		request, _ := http.NewRequest("OPTIONS", srv.URL+path, nil)
+		request.Header.Set("Origin", "https://example.com")
+		request.Header.Set("Access-Control-Request-Method", method)
+		response, err := srv.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response
+	}
+	response := preflight("/sayingsJSON", "GET")
+	expect(t, "allowed origin", response.Header.Get("Access-Control-Allow-Origin"), "https://example.com")
+	response = preflight("/nowhere", "GET")
+	expect(t, "unroutable", response.Header.Get("Access-Control-Allow-Origin"), "")
+}
+
+// Creates, edits and deletes from many clients at once. Run with -race.
+func TestConcurrentChanges(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const workers, rounds = 8, 10
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 5*workers*rounds)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				id, body, err := ts.tryCreate(fmt.Sprintf("Worker %d", w),
+					fmt.Sprintf("Worker %d predicts round %d of %s.", w, r, strings.Repeat("x", w*7+r)))
+				if id == 0 {
+					errs <- fmt.Sprintf("create: %q %v", body, err)
+					continue
+				}
+				_, body, err = ts.send("PUT", "/sayingEdit", url.Values{"id": {strconv.Itoa(id)},
+					"prediction": {fmt.Sprintf("Worker %d revised round %d.", w, r)}}, nil)
+				if !strings.HasPrefix(body, "Saying "+strconv.Itoa(id)+" updated") {
+					errs <- fmt.Sprintf("edit: %q %v", body, err)
+				}
+				if r%2 == 0 {
+					_, body, err = ts.send("DELETE", "/sayingDelete/"+strconv.Itoa(id), nil, nil)
+					if !strings.HasPrefix(body, "Saying "+strconv.Itoa(id)+" deleted") {
+						errs <- fmt.Sprintf("delete: %q %v", body, err)
+					}
+				}
+				for _, path := range []string{"/sayingsJSON", "/sayings/stats"} {
+					if response, _, err := ts.send("GET", path, nil, nil); err != nil || response.StatusCode != http.StatusOK {
+						errs <- fmt.Sprintf("GET %s: %v", path, err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Error(e)
+	}
+
+	want := 5 + workers*rounds/2
+	list := ts.sayings()
+	expect(t, "sayings", len(list), want)
+	seen := make(map[int]bool)
+	for _, s := range list {
+		if seen[s.Id] {
+			t.Errorf("Saying %d listed twice", s.Id)
+		}
+		seen[s.Id] = true
+	}
+	var stats SayingStats
+	ts.getJSON("/sayings/stats", &stats)
+	expect(t, "stats", stats.Sayings, want)
+	expect(t, "created", stats.Rates[0].Created, workers*rounds)
+	expect(t, "edited", stats.Rates[0].Edited, workers*rounds)
+	expect(t, "deleted", stats.Rates[0].Deleted, workers*rounds/2)
+}
+
+// The gRPC view carries everything the HTTP views do, and a Watch ends
+// when the service shuts down rather than holding up GracefulStop.
+func TestGRPC(t *testing.T) {
+	ts := newTestServer(t, nil)
+	if _, err := ts.gs.TagSaying(1, []string{"cloud", "synergy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	sayingspb.RegisterSayingsServer(server, sayingsServer{gs: ts.gs})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := sayingspb.NewSayingsClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	one, err := client.Get(ctx, &sayingspb.GetRequest{Id: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "tags", strings.Join(one.Tags, ","), "cloud,synergy")
+	expect(t, "company", one.CompanyId, int32(1))
+
+	stream, err := client.Watch(ctx, &sayingspb.WatchRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.create("Test Predictor", "Streams will end on time.")
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	ts.gs.Shutdown()
+	_, err = stream.Recv()
+	expect(t, "watch ended", status.Code(err), codes.Unavailable)
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Error("GracefulStop hung")
+	}
+}
+
+//** line protocol
+// A Service over the test server's store, on a port of its own.
+func (ts *testServer) serveLines(idle time.Duration) (*Service, string) {
+	listener := getListener("127.0.0.1:0")
+	service := NewService(ts.gs, idle)
+	go service.Serve(listener)
+	return service, listener.Addr().String()
+}
+
+type lineClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	t      *testing.T
+}
+
+func dialLines(t *testing.T, addr string) *lineClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &lineClient{conn: conn, reader: bufio.NewReader(conn), t: t}
+}
+
+func (c *lineClient) send(line string) {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(line + "\n")); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// The next line from the server, without its newline.
+func (c *lineClient) read() string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+// The server hangs up, with nothing more to say.
+func (c *lineClient) expectClosed(what string) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if line, err := c.reader.ReadString('\n'); err != io.EOF {
+		c.t.Errorf("%s: got %q, %v, want the connection closed", what, line, err)
+	}
+}
+
+func TestLineProtocol(t *testing.T) {
+	ts := newTestServer(t, nil)
+	service, addr := ts.serveLines(time.Minute)
+	defer service.Stop()
+	c := dialLines(t, addr)
+
+	c.send("LIST")
+	expect(t, "LIST", c.read(), "OK 5")
+	for id := 1; id <= 5; id++ {
+		expect(t, "LIST line", c.read(), ts.gs.readSaying(id).ToString())
+	}
+	c.send("get 1")
+	expect(t, "GET", c.read(), "OK")
+	expect(t, "GET line", c.read(), ts.gs.readSaying(1).ToString())
+
+	// Line breaks are escaped both ways, so a saying stays on its line.
+	c.send(`ADD Test Predictor!Line breaks,\nand a \\ backslash, will travel.`)
+	expect(t, "ADD", c.read(), "OK 6")
+	expect(t, "added", ts.gs.readSaying(6).Prediction, "Line breaks,\nand a \\ backslash, will travel.")
+	ts.create("Test Predictor", "Over HTTP,\r\nthe line breaks are real.")
+	c.send("LIST")
+	expect(t, "LIST", c.read(), "OK 7")
+	for id := 1; id <= 5; id++ {
+		c.read()
+	}
+	expect(t, "escaped", c.read(), ` 6. Test Predictor says: Line breaks,\nand a \\ backslash, will travel.`)
+	expect(t, "escaped", c.read(), ` 7. Test Predictor says: Over HTTP,\r\nthe line breaks are real.`)
+	c.send("GET 7")
+	expect(t, "in step", c.read(), "OK")
+	expect(t, "in step", c.read(), ` 7. Test Predictor says: Over HTTP,\r\nthe line breaks are real.`)
+
+	for _, step := range []struct {
+		command string
+		want    string
+	}{
+		{"EDIT 6 !Edited over the line.", "OK"},
+		{"GET 6", "OK"},
+		{"", " 6. Test Predictor says: Edited over the line."},
+		{"DEL 6", "OK"},
+		{"GET 6", "ERR No such Saying"},
+		{"GET six", "ERR Bad id six"},
+		{"ADD Ann!Soon.", "ERR Prediction/predictor must be >= 6 chars."},
+		{"FROB 1", "ERR unknown command FROB"},
+		{"QUIT", "OK bye"},
+	} {
+		if step.command != "" {
+			c.send(step.command)
+		}
+		expect(t, step.command, c.read(), step.want)
+	}
+	c.expectClosed("after QUIT")
+}
+
+// Every watcher gets every event, until it sends a line.
+func TestLineWatch(t *testing.T) {
+	ts := newTestServer(t, nil)
+	service, addr := ts.serveLines(time.Minute)
+	defer service.Stop()
+
+	a, b := dialLines(t, addr), dialLines(t, addr)
+	for _, c := range []*lineClient{a, b} {
+		c.send("WATCH")
+		expect(t, "WATCH", c.read(), "OK watching")
+	}
+	ts.create("Test Predictor", "Both watchers,\nnot just one.")
+	for _, c := range []*lineClient{a, b} {
+		expect(t, "event", c.read(), `EVENT created  6. Test Predictor says: Both watchers,\nnot just one.`)
+	}
+
+	a.send("")
+	expect(t, "unwatch", a.read(), "OK done")
+	ts.gs.DeleteSaying(6)
+	expect(t, "still watching", b.read(), `EVENT deleted  6. Test Predictor says: Both watchers,\nnot just one.`)
+	a.send("GET 6")
+	expect(t, "back to commands", a.read(), "ERR No such Saying")
+}
+
+// An idle connection is closed, but not while it is watching.
+func TestLineIdle(t *testing.T) {
+	ts := newTestServer(t, nil)
+	service, addr := ts.serveLines(100 * time.Millisecond)
+	defer service.Stop()
+
+	idle := dialLines(t, addr)
+	watcher := dialLines(t, addr)
+	watcher.send("WATCH")
+	expect(t, "WATCH", watcher.read(), "OK watching")
+
+	expect(t, "idle", idle.read(), "ERR idle timeout")
+	idle.expectClosed("idle")
+
+	time.Sleep(300 * time.Millisecond)
+	ts.create("Test Predictor", "Watchers can wait a while.")
+	if line := watcher.read(); !strings.HasPrefix(line, "EVENT created") {
+		t.Errorf("watcher: %q", line)
+	}
+}
+
+// Stop tells each client, idle or watching, and hangs up on it, then
+// stops listening.
+func TestLineStop(t *testing.T) {
+	ts := newTestServer(t, nil)
+	service, addr := ts.serveLines(time.Minute)
+
+	idle := dialLines(t, addr)
+	watcher := dialLines(t, addr)
+	watcher.send("WATCH")
+	expect(t, "WATCH", watcher.read(), "OK watching")
+	idle.send("GET 1")
+	expect(t, "GET", idle.read(), "OK")
+	idle.read()
+
+	stopped := make(chan struct{})
+	go func() {
+		service.Stop()
+		close(stopped)
+	}()
+	for what, c := range map[string]*lineClient{"idle": idle, "watching": watcher} {
+		expect(t, what, c.read(), "ERR shutting down")
+		c.expectClosed(what)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop hung")
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("still listening")
+	}
+}
+
+// Once shut down, handlers answer with nothing and readiness fails, while
+// liveness holds so the process is not restarted mid-drain.
+func TestShutdown(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.gs.Shutdown()
+
+	for _, path := range []string{"/sayingsJSON", "/sayingJSON/1", "/sayings/random", "/predictors"} {
+		_, body := ts.get(path)
+		expect(t, path, body, "")
+	}
+	_, body := ts.do("POST", "/sayingCreate", url.Values{"predictor": {"Test Predictor"}, "prediction": {"Too late for this."}}, nil)
+	expect(t, "create", body, "")
+	expect(t, "sayings kept", len(ts.gs.ListifySayings()), 5)
+
+	response, _ := ts.get("/readyz")
+	expectStatus(t, "readyz", response, http.StatusServiceUnavailable)
+	response, _ = ts.get("/healthz")
+	expectStatus(t, "healthz", response, http.StatusOK)
+}
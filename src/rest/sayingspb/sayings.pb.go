@@ -0,0 +1,716 @@
+// gRPC face of the rest service's sayings store. The Go code beside this
+// file is generated from it:
+//
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//          --go-grpc_out=. --go-grpc_opt=paths=source_relative sayings.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.29.3
+// source: sayings.proto
+
+package sayingspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Event_Kind int32
+
+const (
+	Event_UNKNOWN Event_Kind = 0
+	Event_CREATED Event_Kind = 1
+	Event_EDITED  Event_Kind = 2
+	Event_DELETED Event_Kind = 3
+)
+
+// Enum value maps for Event_Kind.
+var (
+	Event_Kind_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "CREATED",
+		2: "EDITED",
+		3: "DELETED",
+	}
+	Event_Kind_value = map[string]int32{
+		"UNKNOWN": 0,
+		"CREATED": 1,
+		"EDITED":  2,
+		"DELETED": 3,
+	}
+)
+
+func (x Event_Kind) Enum() *Event_Kind {
+	p := new(Event_Kind)
+	*p = x
+	return p
+}
+
+func (x Event_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Event_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_sayings_proto_enumTypes[0].Descriptor()
+}
+
+func (Event_Kind) Type() protoreflect.EnumType {
+	return &file_sayings_proto_enumTypes[0]
+}
+
+func (x Event_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Event_Kind.Descriptor instead.
+func (Event_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_sayings_proto_rawDescGZIP(), []int{9, 0}
+}
+
+type Saying struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	PredictorId   int32                  `protobuf:"varint,2,opt,name=predictor_id,json=predictorId,proto3" json:"predictor_id,omitempty"`
+	Predictor     string                 `protobuf:"bytes,3,opt,name=predictor,proto3" json:"predictor,omitempty"` // the predictor's name, filled in on reads
+	Prediction    string                 `protobuf:"bytes,4,opt,name=prediction,proto3" json:"prediction,omitempty"`
+	Tags          []string               `protobuf:"bytes,5,rep,name=tags,proto3" json:"tags,omitempty"`
+	CompanyId     int32                  `protobuf:"varint,6,opt,name=company_id,json=companyId,proto3" json:"company_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Saying) Reset() {
+	*x = Saying{}
+	mi := &file_sayings_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Saying) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Saying) ProtoMessage() {}
+
+func (x *Saying) ProtoReflect() protoreflect.Message {
+	mi := &file_sayings_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Saying.ProtoReflect.Descriptor instead.
+func (*Saying) Descriptor() ([]byte, []int) {
+	return file_sayings_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Saying) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Saying) GetPredictorId() int32 {
+	if x != nil {
+		return x.PredictorId
+	}
+	return 0
+}
+
+func (x *Saying) GetPredictor() string {
+	if x != nil {
+		return x.Predictor
+	}
+	return ""
+}
+
+func (x *Saying) GetPrediction() string {
+	if x != nil {
+		return x.Prediction
+	}
+	return ""
+}
+
+func (x *Saying) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Saying) GetCompanyId() int32 {
+	if x != nil {
+		return x.CompanyId
+	}
+	return 0
+}
+
+type ListRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRequest) Reset() {
+	*x = ListRequest{}
+	mi := &file_sayings_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRequest) ProtoMessage() {}
+
+func (x *ListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sayings_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRequest.ProtoReflect.Descriptor instead.
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return file_sayings_proto_rawDescGZIP(), []int{1}
+}
+
+type ListResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sayings       []*Saying              `protobuf:"bytes,1,rep,name=sayings,proto3" json:"sayings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListResponse) Reset() {
+	*x = ListResponse{}
+	mi := &file_sayings_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListResponse) ProtoMessage() {}
+
+func (x *ListResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sayings_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListResponse.ProtoReflect.Descriptor instead.
+func (*ListResponse) Descriptor() ([]byte, []int) {
+	return file_sayings_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListResponse) GetSayings() []*Saying {
+	if x != nil {
+		return x.Sayings
+	}
+	return nil
+}
+
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_sayings_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sayings_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_sayings_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+// Name a predictor either by id or by name; a new name creates one.
+type CreateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prediction    string                 `protobuf:"bytes,1,opt,name=prediction,proto3" json:"prediction,omitempty"`
+	Predictor     string                 `protobuf:"bytes,2,opt,name=predictor,proto3" json:"predictor,omitempty"`
+	PredictorId   int32                  `protobuf:"varint,3,opt,name=predictor_id,json=predictorId,proto3" json:"predictor_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateRequest) Reset() {
+	*x = CreateRequest{}
+	mi := &file_sayings_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateRequest) ProtoMessage() {}
+
+func (x *CreateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sayings_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateRequest.ProtoReflect.Descriptor instead.
+func (*CreateRequest) Descriptor() ([]byte, []int) {
+	return file_sayings_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CreateRequest) GetPrediction() string {
+	if x != nil {
+		return x.Prediction
+	}
+	return ""
+}
+
+func (x *CreateRequest) GetPredictor() string {
+	if x != nil {
+		return x.Predictor
+	}
+	return ""
+}
+
+func (x *CreateRequest) GetPredictorId() int32 {
+	if x != nil {
+		return x.PredictorId
+	}
+	return 0
+}
+
+// Empty fields are left unchanged.
+type UpdateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Prediction    string                 `protobuf:"bytes,2,opt,name=prediction,proto3" json:"prediction,omitempty"`
+	Predictor     string                 `protobuf:"bytes,3,opt,name=predictor,proto3" json:"predictor,omitempty"`
+	PredictorId   int32                  `protobuf:"varint,4,opt,name=predictor_id,json=predictorId,proto3" json:"predictor_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateRequest) Reset() {
+	*x = UpdateRequest{}
+	mi := &file_sayings_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateRequest) ProtoMessage() {}
+
+func (x *UpdateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sayings_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateRequest.ProtoReflect.Descriptor instead.
+func (*UpdateRequest) Descriptor() ([]byte, []int) {
+	return file_sayings_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *UpdateRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *UpdateRequest) GetPrediction() string {
+	if x != nil {
+		return x.Prediction
+	}
+	return ""
+}
+
+func (x *UpdateRequest) GetPredictor() string {
+	if x != nil {
+		return x.Predictor
+	}
+	return ""
+}
+
+func (x *UpdateRequest) GetPredictorId() int32 {
+	if x != nil {
+		return x.PredictorId
+	}
+	return 0
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_sayings_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sayings_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_sayings_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_sayings_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sayings_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_sayings_proto_rawDescGZIP(), []int{7}
+}
+
+type WatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_sayings_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sayings_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_sayings_proto_rawDescGZIP(), []int{8}
+}
+
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Kind          Event_Kind             `protobuf:"varint,1,opt,name=kind,proto3,enum=sayings.Event_Kind" json:"kind,omitempty"`
+	Saying        *Saying                `protobuf:"bytes,2,opt,name=saying,proto3" json:"saying,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_sayings_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_sayings_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_sayings_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Event) GetKind() Event_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return Event_UNKNOWN
+}
+
+func (x *Event) GetSaying() *Saying {
+	if x != nil {
+		return x.Saying
+	}
+	return nil
+}
+
+var File_sayings_proto protoreflect.FileDescriptor
+
+const file_sayings_proto_rawDesc = "" +
+	"\n" +
+	"\rsayings.proto\x12\asayings\"\xac\x01\n" +
+	"\x06Saying\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12!\n" +
+	"\fpredictor_id\x18\x02 \x01(\x05R\vpredictorId\x12\x1c\n" +
+	"\tpredictor\x18\x03 \x01(\tR\tpredictor\x12\x1e\n" +
+	"\n" +
+	"prediction\x18\x04 \x01(\tR\n" +
+	"prediction\x12\x12\n" +
+	"\x04tags\x18\x05 \x03(\tR\x04tags\x12\x1d\n" +
+	"\n" +
+	"company_id\x18\x06 \x01(\x05R\tcompanyId\"\r\n" +
+	"\vListRequest\"9\n" +
+	"\fListResponse\x12)\n" +
+	"\asayings\x18\x01 \x03(\v2\x0f.sayings.SayingR\asayings\"\x1c\n" +
+	"\n" +
+	"GetRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\"p\n" +
+	"\rCreateRequest\x12\x1e\n" +
+	"\n" +
+	"prediction\x18\x01 \x01(\tR\n" +
+	"prediction\x12\x1c\n" +
+	"\tpredictor\x18\x02 \x01(\tR\tpredictor\x12!\n" +
+	"\fpredictor_id\x18\x03 \x01(\x05R\vpredictorId\"\x80\x01\n" +
+	"\rUpdateRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x1e\n" +
+	"\n" +
+	"prediction\x18\x02 \x01(\tR\n" +
+	"prediction\x12\x1c\n" +
+	"\tpredictor\x18\x03 \x01(\tR\tpredictor\x12!\n" +
+	"\fpredictor_id\x18\x04 \x01(\x05R\vpredictorId\"\x1f\n" +
+	"\rDeleteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\"\x10\n" +
+	"\x0eDeleteResponse\"\x0e\n" +
+	"\fWatchRequest\"\x94\x01\n" +
+	"\x05Event\x12'\n" +
+	"\x04kind\x18\x01 \x01(\x0e2\x13.sayings.Event.KindR\x04kind\x12'\n" +
+	"\x06saying\x18\x02 \x01(\v2\x0f.sayings.SayingR\x06saying\"9\n" +
+	"\x04Kind\x12\v\n" +
+	"\aUNKNOWN\x10\x00\x12\v\n" +
+	"\aCREATED\x10\x01\x12\n" +
+	"\n" +
+	"\x06EDITED\x10\x02\x12\v\n" +
+	"\aDELETED\x10\x032\xbe\x02\n" +
+	"\aSayings\x123\n" +
+	"\x04List\x12\x14.sayings.ListRequest\x1a\x15.sayings.ListResponse\x12+\n" +
+	"\x03Get\x12\x13.sayings.GetRequest\x1a\x0f.sayings.Saying\x121\n" +
+	"\x06Create\x12\x16.sayings.CreateRequest\x1a\x0f.sayings.Saying\x121\n" +
+	"\x06Update\x12\x16.sayings.UpdateRequest\x1a\x0f.sayings.Saying\x129\n" +
+	"\x06Delete\x12\x16.sayings.DeleteRequest\x1a\x17.sayings.DeleteResponse\x120\n" +
+	"\x05Watch\x12\x15.sayings.WatchRequest\x1a\x0e.sayings.Event0\x01B\x10Z\x0erest/sayingspbb\x06proto3"
+
+var (
+	file_sayings_proto_rawDescOnce sync.Once
+	file_sayings_proto_rawDescData []byte
+)
+
+func file_sayings_proto_rawDescGZIP() []byte {
+	file_sayings_proto_rawDescOnce.Do(func() {
+		file_sayings_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_sayings_proto_rawDesc), len(file_sayings_proto_rawDesc)))
+	})
+	return file_sayings_proto_rawDescData
+}
+
+var file_sayings_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_sayings_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_sayings_proto_goTypes = []any{
+	(Event_Kind)(0),        // 0: sayings.Event.Kind
+	(*Saying)(nil),         // 1: sayings.Saying
+	(*ListRequest)(nil),    // 2: sayings.ListRequest
+	(*ListResponse)(nil),   // 3: sayings.ListResponse
+	(*GetRequest)(nil),     // 4: sayings.GetRequest
+	(*CreateRequest)(nil),  // 5: sayings.CreateRequest
+	(*UpdateRequest)(nil),  // 6: sayings.UpdateRequest
+	(*DeleteRequest)(nil),  // 7: sayings.DeleteRequest
+	(*DeleteResponse)(nil), // 8: sayings.DeleteResponse
+	(*WatchRequest)(nil),   // 9: sayings.WatchRequest
+	(*Event)(nil),          // 10: sayings.Event
+}
+var file_sayings_proto_depIdxs = []int32{
+	1,  // 0: sayings.ListResponse.sayings:type_name -> sayings.Saying
+	0,  // 1: sayings.Event.kind:type_name -> sayings.Event.Kind
+	1,  // 2: sayings.Event.saying:type_name -> sayings.Saying
+	2,  // 3: sayings.Sayings.List:input_type -> sayings.ListRequest
+	4,  // 4: sayings.Sayings.Get:input_type -> sayings.GetRequest
+	5,  // 5: sayings.Sayings.Create:input_type -> sayings.CreateRequest
+	6,  // 6: sayings.Sayings.Update:input_type -> sayings.UpdateRequest
+	7,  // 7: sayings.Sayings.Delete:input_type -> sayings.DeleteRequest
+	9,  // 8: sayings.Sayings.Watch:input_type -> sayings.WatchRequest
+	3,  // 9: sayings.Sayings.List:output_type -> sayings.ListResponse
+	1,  // 10: sayings.Sayings.Get:output_type -> sayings.Saying
+	1,  // 11: sayings.Sayings.Create:output_type -> sayings.Saying
+	1,  // 12: sayings.Sayings.Update:output_type -> sayings.Saying
+	8,  // 13: sayings.Sayings.Delete:output_type -> sayings.DeleteResponse
+	10, // 14: sayings.Sayings.Watch:output_type -> sayings.Event
+	9,  // [9:15] is the sub-list for method output_type
+	3,  // [3:9] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_sayings_proto_init() }
+func file_sayings_proto_init() {
+	if File_sayings_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_sayings_proto_rawDesc), len(file_sayings_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_sayings_proto_goTypes,
+		DependencyIndexes: file_sayings_proto_depIdxs,
+		EnumInfos:         file_sayings_proto_enumTypes,
+		MessageInfos:      file_sayings_proto_msgTypes,
+	}.Build()
+	File_sayings_proto = out.File
+	file_sayings_proto_goTypes = nil
+	file_sayings_proto_depIdxs = nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Length buckets, in characters, for the distribution of predictions.
+const bucketWidth = 20
+
+// Words too common to be worth counting on their own. They still count
+// within n-grams.
+var stopWords = map[string]bool{"a": true, "an": true, "and": true, "the": true, "of": true,
+	"to": true, "in": true, "on": true, "for": true, "is": true, "will": true, "be": true}
+
+// Windows for the create/edit/delete rates; the last bounds the history kept.
+var rateWindows = []struct {
+	label  string
+	period time.Duration
+}{{"1m", time.Minute}, {"1h", time.Hour}, {"24h", 24 * time.Hour}}
+
+// Analytics over the sayings, kept up to date by the store's events rather
+// than recomputed per request. Each Saying's contribution is remembered so
+// that an edit or deletion can take it back out.
+type StatsState struct {
+	entries    map[int]*statsEntry
+	predictors map[int]int    // predictor id -> sayings
+	terms      map[string]int // words, bigrams and trigrams, each keyed by its words
+	lengths    map[int]int    // length in characters -> sayings
+	history    []statsEvent   // newest last
+	lock       sync.Mutex
+}
+
+type statsEntry struct {
+	predictorId int
+	length      int
+	words       []string
+}
+
+type statsEvent struct {
+	at   time.Time
+	kind string
+}
+
+func newStatsState() *StatsState {
+	return &StatsState{entries: make(map[int]*statsEntry), predictors: make(map[int]int),
+		terms: make(map[string]int), lengths: make(map[int]int)}
+}
+
+//** report types
+type SayingStats struct {
+	XMLName    xml.Name         `json:"-" xml:"Stats"`
+	Sayings    int
+	Predictors []PredictorCount `xml:"Predictors>Predictor"`
+	Words      []TermCount      `xml:"Words>Word"`
+	Bigrams    []TermCount      `xml:"Bigrams>Bigram"`
+	Trigrams   []TermCount      `xml:"Trigrams>Trigram"`
+	Lengths    LengthStats
+	Rates      []Rate           `xml:"Rates>Rate"`
+}
+
+type PredictorCount struct {
+	PredictorId int
+	Predictor   string
+	Sayings     int
+}
+
+type TermCount struct {
+	Term  string
+	Count int
+}
+
+type LengthStats struct {
+	Shortest int
+	Longest  int
+	Mean     float64
+	Buckets  []LengthBucket `xml:"Bucket"`
+}
+
+// Predictions of From to To characters, inclusive.
+type LengthBucket struct {
+	From  int
+	To    int
+	Count int
+}
+
+type Rate struct {
+	Window  string
+	Created int
+	Edited  int
+	Deleted int
+}
+
+//** request handler
+// GET /sayings/stats[?top=20][&format=xml|plain]
+// Top limits the word and n-gram tables.
+func (gs *GlobalState) SayingsStats(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	top := 20
+	if n := request.FormValue("top"); n != "" {
+		var err error
+		if top, err = strconv.Atoi(n); err != nil || top < 1 {
+			sendStatus(response, http.StatusBadRequest, fmt.Errorf("Bad top %q", n))
+			return
+		}
+	}
+
+	report := gs.stats.report(top, gs.readPredictor)
+	if request.FormValue("format") == "plain" {
+		sendResponse(response, []byte(report.ToString()), nil)
+	} else {
+		gs.sendFormatted(response, request, report)
+	}
+	log.Println("/sayings/stats")
+}
+
+//** upkeep
+// Start over from the store as it stands; record then follows its events.
+func (st *StatsState) rebuild(list []*Saying) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.entries = make(map[int]*statsEntry)
+	st.predictors = make(map[int]int)
+	st.terms = make(map[string]int)
+	st.lengths = make(map[int]int)
+	for _, s := range list {
+		st.add(s)
+	}
+}
+
+// A hub listener, so called with the store locked: quick and self-contained.
+func (st *StatsState) record(e SayingEvent) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.remove(e.Saying.Id)
+	if e.Kind != EventDeleted {
+		st.add(&e.Saying)
+	}
+	st.history = append(st.history, statsEvent{time.Now(), e.Kind})
+	st.prune()
+}
+
+// Caller holds the lock.
+func (st *StatsState) add(s *Saying) {
+	e := &statsEntry{predictorId: s.PredictorId, length: len([]rune(s.Prediction)),
+		words: strings.Fields(normalizeText(s.Prediction))}
+	st.entries[s.Id] = e
+	st.apply(e, 1)
+}
+
+// Caller holds the lock.
+func (st *StatsState) remove(id int) {
+	if e, ok := st.entries[id]; ok {
+		st.apply(e, -1)
+		delete(st.entries, id)
+	}
+}
+
+func (st *StatsState) apply(e *statsEntry, delta int) {
+	bump(st.predictors, e.predictorId, delta)
+	bump(st.lengths, e.length, delta)
+	for n := 1; n <= 3; n++ {
+		for i := 0; i+n <= len(e.words); i++ {
+			if n == 1 && stopWords[e.words[i]] {
+				continue
+			}
+			term := strings.Join(e.words[i:i+n], " ")
+			st.terms[term] += delta
+			if st.terms[term] == 0 {
+				delete(st.terms, term)
+			}
+		}
+	}
+}
+
+func bump(m map[int]int, key int, delta int) {
+	m[key] += delta
+	if m[key] == 0 {
+		delete(m, key)
+	}
+}
+
+// Drop events older than the longest window. Caller holds the lock.
+func (st *StatsState) prune() {
+	cutoff := time.Now().Add(-rateWindows[len(rateWindows)-1].period)
+	i := 0
+	for i < len(st.history) && st.history[i].at.Before(cutoff) {
+		i++
+	}
+	st.history = st.history[i:]
+}
+
+//** reporting
+// Predictors are named by lookup, which must not need the stats lock.
+func (st *StatsState) report(top int, lookup func(int) *Predictor) *SayingStats {
+	st.lock.Lock()
+	r := &SayingStats{Sayings: len(st.entries)}
+	perPredictor := make(map[int]int)
+	for id, n := range st.predictors {
+		perPredictor[id] = n
+	}
+	words, bigrams, trigrams := []TermCount{}, []TermCount{}, []TermCount{}
+	for term, n := range st.terms {
+		switch strings.Count(term, " ") {
+		case 0:
+			words = append(words, TermCount{term, n})
+		case 1:
+			bigrams = append(bigrams, TermCount{term, n})
+		default:
+			trigrams = append(trigrams, TermCount{term, n})
+		}
+	}
+	r.Lengths = st.lengthStats()
+	st.prune()
+	r.Rates = st.rates()
+	st.lock.Unlock()
+
+	// Names are looked up outside the lock: the store's lock comes first.
+	r.Predictors = []PredictorCount{}
+	for id, n := range perPredictor {
+		pc := PredictorCount{PredictorId: id, Sayings: n}
+		if p := lookup(id); p != nil {
+			pc.Predictor = p.Name
+		}
+		r.Predictors = append(r.Predictors, pc)
+	}
+	sort.Slice(r.Predictors, func(i, j int) bool {
+		a, b := r.Predictors[i], r.Predictors[j]
+		return a.Sayings > b.Sayings || (a.Sayings == b.Sayings && a.PredictorId < b.PredictorId)
+	})
+	r.Words, r.Bigrams, r.Trigrams = topTerms(words, top), topTerms(bigrams, top), topTerms(trigrams, top)
+	return r
+}
+
+// Caller holds the lock.
+func (st *StatsState) lengthStats() LengthStats {
+	ls := LengthStats{Buckets: []LengthBucket{}}
+	total, count := 0, 0
+	buckets := make(map[int]int)
+	for length, n := range st.lengths {
+		if count == 0 || length < ls.Shortest {
+			ls.Shortest = length
+		}
+		if length > ls.Longest {
+			ls.Longest = length
+		}
+		total += length * n
+		count += n
+		buckets[length/bucketWidth] += n
+	}
+	if count > 0 {
+		ls.Mean = float64(total) / float64(count)
+		for b := ls.Shortest / bucketWidth; b <= ls.Longest/bucketWidth; b++ {
+			ls.Buckets = append(ls.Buckets, LengthBucket{b * bucketWidth, (b+1)*bucketWidth - 1, buckets[b]})
+		}
+	}
+	return ls
+}
+
+// Caller holds the lock.
+func (st *StatsState) rates() []Rate {
+	now := time.Now()
+	rates := []Rate{}
+	for _, w := range rateWindows {
+		r := Rate{Window: w.label}
+		for _, e := range st.history {
+			if now.Sub(e.at) > w.period {
+				continue
+			}
+			switch e.kind {
+			case EventCreated:
+				r.Created++
+			case EventEdited:
+				r.Edited++
+			case EventDeleted:
+				r.Deleted++
+			}
+		}
+		rates = append(rates, r)
+	}
+	return rates
+}
+
+// The top most frequent, ties broken alphabetically.
+func topTerms(terms []TermCount, top int) []TermCount {
+	sort.Slice(terms, func(i, j int) bool {
+		return terms[i].Count > terms[j].Count || (terms[i].Count == terms[j].Count && terms[i].Term < terms[j].Term)
+	})
+	if len(terms) > top {
+		terms = terms[:top]
+	}
+	return terms
+}
+
+func (r *SayingStats) ToString() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d sayings\n\nSayings per predictor:\n", r.Sayings)
+	for _, pc := range r.Predictors {
+		fmt.Fprintf(&b, "  %4d  %s\n", pc.Sayings, pc.Predictor)
+	}
+	for _, table := range []struct {
+		title string
+		terms []TermCount
+	}{{"Words", r.Words}, {"Bigrams", r.Bigrams}, {"Trigrams", r.Trigrams}} {
+		fmt.Fprintf(&b, "\n%s:\n", table.title)
+		for _, t := range table.terms {
+			fmt.Fprintf(&b, "  %4d  %s\n", t.Count, t.Term)
+		}
+	}
+	fmt.Fprintf(&b, "\nLengths: shortest %d, longest %d, mean %.1f\n",
+		r.Lengths.Shortest, r.Lengths.Longest, r.Lengths.Mean)
+	for _, bk := range r.Lengths.Buckets {
+		fmt.Fprintf(&b, "  %3d-%-3d  %4d %s\n", bk.From, bk.To, bk.Count, strings.Repeat("*", bk.Count))
+	}
+	b.WriteString("\nChanges:\n")
+	for _, rt := range r.Rates {
+		fmt.Fprintf(&b, "  last %-8s %d created, %d edited, %d deleted\n", rt.Window, rt.Created, rt.Edited, rt.Deleted)
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// Snapshot of the GlobalState, rewritten after every change.
+const storeFile = "store.json"
+
+type snapshot struct {
+	SayingId        int
+	PredictorId     int
+	Predictors      []*Predictor
+	Sayings         []*Saying
+	IdempotencyKeys map[string]*IdempotencyRecord `json:",omitempty"`
+}
+
+// Record a change to the store: persist it and invalidate cached responses.
+// Caller holds the lock.
+func (gs *GlobalState) changed() {
+	gs.modified = time.Now()
+	gs.save()
+	gs.cache.flush()
+}
+
+func (gs *GlobalState) lastModified() time.Time {
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+	return gs.modified
+}
+
+// Write the snapshot. Caller holds the lock.
+func (gs *GlobalState) save() {
+	snap := snapshot{SayingId: gs.sayingId, PredictorId: gs.predictorId,
+		IdempotencyKeys: gs.idempotency}
+	for _, p := range gs.predictors {
+		snap.Predictors = append(snap.Predictors, p)
+	}
+	for _, s := range gs.sayings {
+		snap.Sayings = append(snap.Sayings, s)
+	}
+	sort.Slice(snap.Predictors, func(i, j int) bool { return snap.Predictors[i].Id < snap.Predictors[j].Id })
+	sort.Slice(snap.Sayings, func(i, j int) bool { return snap.Sayings[i].Id < snap.Sayings[j].Id })
+
+	gs.saveErr = writeJSONFile(gs.path(storeFile), snap)
+	if gs.saveErr != nil {
+		log.Println("Cannot save " + storeFile + ":", gs.saveErr)
+	}
+}
+
+// Write v to the file as indented JSON, by way of writeFile.
+func writeJSONFile(file_name string, v interface{}) error {
+	doc, err := json.MarshalIndent(v, "", " ")
+	if err != nil {
+		return err
+	}
+	return writeFile(file_name, doc)
+}
+
+// Write doc to a temporary file and rename it into place, so a crash
+// mid-write never leaves a truncated file.
+func writeFile(file_name string, doc []byte) error {
+	tmp := file_name + ".tmp"
+	if err := ioutil.WriteFile(tmp, doc, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file_name)
+}
+
+// Decode the file into v. Returns false if there is no such file.
+func readJSONFile(file_name string, v interface{}) (bool, error) {
+	doc, err := ioutil.ReadFile(file_name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.New("Cannot read " + file_name + ": " + err.Error())
+	}
+	if err := json.Unmarshal(doc, v); err != nil {
+		return false, errors.New("Cannot parse " + file_name + ": " + err.Error())
+	}
+	return true, nil
+}
+
+// Populate the store from the snapshot. Returns false if there is none.
+// Caller holds the lock.
+func (gs *GlobalState) loadStore(file_name string) (bool, error) {
+	var snap snapshot
+	if found, err := readJSONFile(file_name, &snap); !found {
+		return false, err
+	}
+	for _, p := range snap.Predictors {
+		gs.predictors[p.Id] = p
+	}
+	for _, s := range snap.Sayings {
+		s.Predictor = ""
+		gs.sayings[s.Id] = s
+	}
+	for key, r := range snap.IdempotencyKeys {
+		gs.idempotency[key] = r
+	}
+	gs.sayingId = snap.SayingId
+	gs.predictorId = snap.PredictorId
+	return true, nil
+}
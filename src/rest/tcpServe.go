@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ A line-oriented TCP face of the sayings store, for tools that cannot speak
+ HTTP. Each request is one line; each reply starts with OK or ERR:
+
+   LIST                       OK <n>, then n sayings, one per line
+   GET <id>                   OK, then the saying
+   ADD <predictor>!<text>     OK <id>
+   EDIT <id> <predictor>!<text>   OK (either side of the ! may be empty)
+   DEL <id>                   OK
+   WATCH                      OK, then EVENT <kind> <saying> lines until
+                              the client sends any line
+   QUIT                       OK bye
+
+ A saying goes on one line, so a backslash, newline or carriage return in
+ it is written as \\, \n or \r; the text of an ADD or EDIT is read the
+ same way. A connection idle for longer than the idle timeout is closed.
+*/
+
+type Service struct {
+	gs        *GlobalState
+	ch        chan bool
+	waitGroup *sync.WaitGroup
+	idle      time.Duration
+}
+
+// Make a new Service over the store in gs.
+func NewService(gs *GlobalState, idle time.Duration) *Service {
+	s := &Service{
+		gs:        gs,
+		ch:        make(chan bool),
+		waitGroup: &sync.WaitGroup{},
+		idle:      idle,
+	}
+	s.waitGroup.Add(1)
+	return s
+}
+
+// Accept connections and spawn a goroutine to serve each one.  Stop listening
+// if anything is received on the service's channel.
+func (s *Service) Serve(listener *net.TCPListener) {
+	defer s.waitGroup.Done()
+	for {
+		select {
+		case <-s.ch:
+			log.Println("stopping listening on", listener.Addr())
+			listener.Close()
+			return
+		default:
+		}
+		listener.SetDeadline(time.Now().Add(1e9))
+		conn, err := listener.AcceptTCP()
+		if nil != err {
+			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+				continue
+			}
+			log.Println(err)
+			continue
+		}
+		log.Println(conn.RemoteAddr(), "connected")
+		s.waitGroup.Add(1)
+		go s.handleRequest(conn)
+	}
+}
+
+// Stop the service by closing the service's channel.  Block until the service
+// is really stopped.
+func (s *Service) Stop() {
+	close(s.ch)
+	s.waitGroup.Wait()
+}
+
+// Serve a connection one command at a time. A stop interrupts a pending
+// read, but a command already being answered is finished first.
+func (s *Service) handleRequest(conn *net.TCPConn) {
+	defer conn.Close()
+	defer s.waitGroup.Done()
+
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-s.ch:
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	for {
+		// Checked after the deadline is set, so that a stop from here on
+		// cuts the read short, as one before it (say, mid-WATCH) skips it.
+		conn.SetReadDeadline(time.Now().Add(s.idle))
+		var line string
+		var err error
+		if !s.stopping() {
+			line, err = reader.ReadString('\n')
+		}
+		if s.stopping() {
+			writer.WriteString("ERR shutting down\n")
+			writer.Flush()
+			log.Println("disconnecting", conn.RemoteAddr())
+			return
+		}
+		if err != nil {
+			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+				writer.WriteString("ERR idle timeout\n")
+				writer.Flush()
+			}
+			log.Println(conn.RemoteAddr(), "disconnected")
+			return
+		}
+
+		command, arg := splitCommand(line)
+		if command == "QUIT" {
+			writer.WriteString("OK bye\n")
+			writer.Flush()
+			return
+		}
+		if command == "WATCH" {
+			s.watch(conn, reader, writer)
+			continue
+		}
+		if err := s.dispatch(writer, command, arg); err != nil {
+			writer.WriteString("ERR " + err.Error() + "\n")
+		}
+		if writer.Flush() != nil {
+			return
+		}
+		log.Println("tcp", command)
+	}
+}
+
+func (s *Service) dispatch(w *bufio.Writer, command string, arg string) error {
+	if s.gs.shutDown.Load() {
+		return errors.New("shutting down")
+	}
+
+	switch command {
+	case "LIST":
+		sayings := s.gs.ListifySayings()
+		fmt.Fprintf(w, "OK %d\n", len(sayings))
+		for _, saying := range sayings {
+			w.WriteString(sayingLine(saying))
+		}
+
+	case "GET":
+		id, err := parseId(arg)
+		if err != nil {
+			return err
+		}
+		saying := s.gs.readSaying(id)
+		if saying == nil {
+			return errors.New("No such Saying")
+		}
+		w.WriteString("OK\n" + sayingLine(saying))
+
+	case "ADD":
+		predictor, prediction := splitRecord(arg)
+		created, err := s.gs.CreateSaying(prediction, predictor, 0)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "OK %d\n", created.Saying.Id)
+
+	case "EDIT":
+		n, record := splitCommand(arg)
+		id, err := parseId(n)
+		if err != nil {
+			return err
+		}
+		predictor, prediction := splitRecord(record)
+		if _, err := s.gs.EditSaying(id, prediction, predictor, 0); err != nil {
+			return err
+		}
+		w.WriteString("OK\n")
+
+	case "DEL":
+		id, err := parseId(arg)
+		if err != nil {
+			return err
+		}
+		if err := s.gs.DeleteSaying(id); err != nil {
+			return err
+		}
+		w.WriteString("OK\n")
+
+	default:
+		return errors.New("unknown command " + command)
+	}
+	return nil
+}
+
+// Relay store events until the client sends a line, hangs up, or the
+// service stops. The idle timeout does not apply while watching.
+func (s *Service) watch(conn *net.TCPConn, reader *bufio.Reader, w *bufio.Writer) {
+	events, cancel := s.gs.hub.subscribe()
+	defer cancel()
+
+	w.WriteString("OK watching\n")
+	w.Flush()
+	log.Println("tcp WATCH")
+
+	conn.SetReadDeadline(time.Time{})
+	input := make(chan bool)
+	go func() {
+		reader.ReadString('\n')
+		close(input)
+	}()
+
+	for {
+		select {
+		case <-input:
+			w.WriteString("OK done\n")
+			w.Flush()
+			return
+		case <-s.ch:
+			conn.SetReadDeadline(time.Now())
+			<-input
+			return
+		case e, ok := <-events:
+			if !ok { return }
+			w.WriteString("EVENT " + e.Kind + " " + sayingLine(&e.Saying))
+			if w.Flush() != nil {
+				conn.Close()
+				<-input
+				return
+			}
+		}
+	}
+}
+
+func (s *Service) stopping() bool {
+	select {
+	case <-s.ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func getListener(endpoint string) *net.TCPListener {
+	socketType := "tcp"
+	addr, err := net.ResolveTCPAddr(socketType, endpoint)
+	if nil != err {
+		log.Fatalln(err)
+	}
+	listener, err := net.ListenTCP(socketType, addr)
+	if nil != err {
+		log.Fatalln(err)
+	}
+	return listener
+}
+
+// "EDIT 3 x!y" -> "EDIT", "3 x!y"
+func splitCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) < 2 {
+		return strings.ToUpper(parts[0]), ""
+	}
+	return strings.ToUpper(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// "predictor!prediction", as in sayings.db, with escapes undone.
+func splitRecord(record string) (string, string) {
+	parts := strings.SplitN(record, "!", 2)
+	if len(parts) < 2 {
+		return "", lineUnescaper.Replace(parts[0])
+	}
+	return lineUnescaper.Replace(parts[0]), lineUnescaper.Replace(parts[1])
+}
+
+// Backslash escapes for a saying's line breaks, and the way back.
+var lineEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+var lineUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r")
+
+// A saying as one line of the protocol, newline included.
+func sayingLine(s *Saying) string {
+	return lineEscaper.Replace(s.ToString()) + "\n"
+}
+
+func parseId(n string) (int, error) {
+	id, err := strconv.Atoi(n)
+	if err != nil {
+		return 0, errors.New("Bad id " + n)
+	}
+	return id, nil
+}
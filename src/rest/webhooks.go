@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outbound webhooks for saying lifecycle events. Each store change is
+// queued as one Delivery per matching Webhook and POSTed, signed with the
+// webhook's secret, by a background worker. Failures are retried with
+// exponential backoff; deliveries that keep failing go to the dead letters,
+// of which only the latest maxDeadLetters are kept. The lot is persisted in
+// webhooksFile, so nothing queued is lost on restart.
+const (
+	webhooksFile    = "webhooks.json"
+	maxAttempts     = 8
+	firstBackoff    = 2 * time.Second
+	maxBackoff      = time.Hour
+	maxLogEntries   = 200
+	maxDeadLetters  = 200
+	deliveryTimeout = 10 * time.Second
+)
+
+type Webhook struct {
+	Id     int
+	URL    string
+	Secret string   `json:",omitempty" xml:"-"`
+	Events []string `json:",omitempty"` // empty means every kind
+}
+
+// The JSON body POSTed to a webhook.
+type WebhookPayload struct {
+	DeliveryId int
+	Event      string
+	Saying     Saying
+	Time       time.Time
+}
+
+type Delivery struct {
+	Id          int
+	WebhookId   int
+	Event       string
+	Payload     json.RawMessage
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string `json:",omitempty"`
+}
+
+// One attempt to deliver, successful or not, for the delivery log.
+type DeliveryAttempt struct {
+	DeliveryId int
+	WebhookId  int
+	Attempt    int
+	Time       time.Time
+	Status     int    `json:",omitempty"`
+	Error      string `json:",omitempty"`
+}
+
+type WebhookState struct {
+	HookId     int
+	DeliveryId int
+	Hooks      map[int]*Webhook
+	Queue      []*Delivery
+	Dead       []*Delivery
+	Log        []*DeliveryAttempt
+
+	file   string
+	dirty  bool       // changed since the file was last written
+	lock   sync.Mutex
+	saving sync.Mutex // held from snapshot to rename, so writes land in order
+	wakeup chan bool
+	client *http.Client
+}
+
+//** request handlers
+// GET /webhooks
+func (gs *GlobalState) WebhooksList(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	gs.webhooks.lock.Lock()
+	list := []Webhook{}
+	for id := 1; id < gs.webhooks.HookId; id++ {
+		if h, ok := gs.webhooks.Hooks[id]; ok {
+			c := *h
+			c.Secret = ""
+			list = append(list, c)
+		}
+	}
+	gs.webhooks.lock.Unlock()
+
+	gs.sendFormatted(response, request, list)
+	log.Println("/webhooks")
+}
+
+// POST /webhooks
+// Form values: url, secret, and events (comma-separated created, edited,
+// deleted; omitted for all).
+func (gs *GlobalState) WebhookCreate(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	hook := &Webhook{URL: request.FormValue("url"), Secret: request.FormValue("secret")}
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		sendStatus(response, http.StatusBadRequest, errors.New("Need an http(s) url"))
+		return
+	}
+	if hook.Secret == "" {
+		sendStatus(response, http.StatusBadRequest, errors.New("Need a secret"))
+		return
+	}
+	for _, kind := range strings.Split(request.FormValue("events"), ",") {
+		kind = strings.TrimSpace(kind)
+		if kind == "" { continue }
+		if kind != EventCreated && kind != EventEdited && kind != EventDeleted {
+			sendStatus(response, http.StatusBadRequest, errors.New("Unknown event " + kind))
+			return
+		}
+		hook.Events = append(hook.Events, kind)
+	}
+
+	gs.webhooks.lock.Lock()
+	hook.Id = gs.webhooks.HookId
+	gs.webhooks.Hooks[hook.Id] = hook
+	gs.webhooks.HookId++
+	gs.webhooks.changed()
+	gs.webhooks.lock.Unlock()
+	gs.webhooks.flush()
+
+	msg := fmt.Sprintf("New Webhook %d created\n.", hook.Id)
+	sendResponse(response, []byte(msg), nil)
+	log.Println("/webhookCreate")
+}
+
+// DELETE /webhooks/{id:[0-9]+}
+// Pending deliveries and dead letters for the webhook are dropped with it.
+func (gs *GlobalState) WebhookDelete(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	n := mux.Vars(request)["id"]
+	id, _ := strconv.Atoi(n)
+
+	gs.webhooks.lock.Lock()
+	if _, ok := gs.webhooks.Hooks[id]; !ok {
+		gs.webhooks.lock.Unlock()
+		sendStatus(response, http.StatusNotFound, errors.New("No such Webhook"))
+		return
+	}
+	delete(gs.webhooks.Hooks, id)
+	gs.webhooks.changed()
+	gs.webhooks.dropOrphans()
+	gs.webhooks.lock.Unlock()
+	gs.webhooks.flush()
+
+	sendResponse(response, []byte("Webhook " + n + " deleted\n."), nil)
+	log.Println("/webhookDelete/" + n)
+}
+
+// GET /webhooks/deliveries
+// The pending queue and the most recent attempts, newest first.
+func (gs *GlobalState) WebhookDeliveries(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	gs.webhooks.lock.Lock()
+	report := struct {
+		Pending  []*Delivery
+		Attempts []*DeliveryAttempt
+	}{append([]*Delivery{}, gs.webhooks.Queue...), []*DeliveryAttempt{}}
+	for i := len(gs.webhooks.Log) - 1; i >= 0; i-- {
+		report.Attempts = append(report.Attempts, gs.webhooks.Log[i])
+	}
+	doc, err := json.MarshalIndent(report, gs.indent1, gs.indent2)
+	gs.webhooks.lock.Unlock()
+
+	response.Header().Set("Content-Type", "application/json")
+	sendResponse(response, doc, err)
+	log.Println("/webhooks/deliveries")
+}
+
+// GET /webhooks/deadletters
+func (gs *GlobalState) WebhookDeadLetters(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	gs.webhooks.lock.Lock()
+	doc, err := json.MarshalIndent(gs.webhooks.Dead, gs.indent1, gs.indent2)
+	gs.webhooks.lock.Unlock()
+
+	response.Header().Set("Content-Type", "application/json")
+	sendResponse(response, doc, err)
+	log.Println("/webhooks/deadletters")
+}
+
+// POST /webhooks/deadletters/{id:[0-9]+}/retry
+// Requeue a dead delivery with a fresh set of attempts.
+func (gs *GlobalState) WebhookRetry(response http.ResponseWriter, request *http.Request) {
+	if gs.shutDown.Load() { return }
+
+	n := mux.Vars(request)["id"]
+	id, _ := strconv.Atoi(n)
+
+	gs.webhooks.lock.Lock()
+	found := false
+	for i, d := range gs.webhooks.Dead {
+		if d.Id == id {
+			gs.webhooks.Dead = append(gs.webhooks.Dead[:i], gs.webhooks.Dead[i+1:]...)
+			d.Attempts = 0
+			d.NextAttempt = time.Now()
+			gs.webhooks.Queue = append(gs.webhooks.Queue, d)
+			gs.webhooks.changed()
+			found = true
+			break
+		}
+	}
+	gs.webhooks.lock.Unlock()
+	gs.webhooks.flush()
+
+	if !found {
+		sendStatus(response, http.StatusNotFound, errors.New("No such dead letter"))
+		return
+	}
+	gs.webhooks.wake()
+	sendResponse(response, []byte("Delivery " + n + " requeued\n."), nil)
+	log.Println("/webhooks/deadletters/" + n + "/retry")
+}
+
+//** methods
+// Queue a delivery of the event to every webhook that wants it. Called by
+// the event hub for each store change, under the store's lock, so this
+// only queues. The file is written by the store operation once it lets go
+// of that lock, before it answers, and by the worker before any attempt.
+func (ws *WebhookState) enqueue(e SayingEvent) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	queued := false
+	for id := 1; id < ws.HookId; id++ {
+		hook, ok := ws.Hooks[id]
+		if !ok || !hook.wants(e.Kind) { continue }
+
+		d := &Delivery{Id: ws.DeliveryId, WebhookId: hook.Id, Event: e.Kind, NextAttempt: time.Now()}
+		ws.DeliveryId++
+		d.Payload, _ = json.Marshal(WebhookPayload{DeliveryId: d.Id, Event: e.Kind, Saying: e.Saying, Time: time.Now()})
+		ws.Queue = append(ws.Queue, d)
+		queued = true
+	}
+	if queued {
+		ws.changed()
+		ws.wake()
+	}
+}
+
+func (h *Webhook) wants(kind string) bool {
+	if len(h.Events) == 0 { return true }
+	for _, k := range h.Events {
+		if k == kind { return true }
+	}
+	return false
+}
+
+// Deliver whatever is due, then sleep until the next delivery is due or
+// something new is queued.
+func (ws *WebhookState) run() {
+	for {
+		for {
+			ws.flush() // whatever is queued is on disk before it is attempted
+			d, hook := ws.nextDue()
+			if d == nil { break }
+			ws.attempt(d, hook)
+		}
+		ws.flush()
+
+		wait := time.Minute
+		ws.lock.Lock()
+		for _, d := range ws.Queue {
+			if until := time.Until(d.NextAttempt); until < wait {
+				wait = until
+			}
+		}
+		ws.lock.Unlock()
+
+		select {
+		case <-ws.wakeup:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// The first due delivery, with (a copy of) its webhook.
+func (ws *WebhookState) nextDue() (*Delivery, Webhook) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	ws.dropOrphans()
+	now := time.Now()
+	for _, d := range ws.Queue {
+		if !d.NextAttempt.After(now) {
+			return d, *ws.Hooks[d.WebhookId]
+		}
+	}
+	return nil, Webhook{}
+}
+
+// Drop the deliveries and dead letters of webhooks that no longer exist,
+// whether deleted just now or while an attempt was under way, or missing
+// from a hand-edited file. Caller holds the lock.
+func (ws *WebhookState) dropOrphans() {
+	keep := func(list []*Delivery) []*Delivery {
+		kept := []*Delivery{}
+		for _, d := range list {
+			if _, ok := ws.Hooks[d.WebhookId]; ok {
+				kept = append(kept, d)
+			}
+		}
+		if len(kept) != len(list) {
+			ws.changed()
+		}
+		return kept
+	}
+	ws.Queue = keep(ws.Queue)
+	ws.Dead = keep(ws.Dead)
+}
+
+// POST the delivery once and file the outcome: done, retry later, or dead.
+func (ws *WebhookState) attempt(d *Delivery, hook Webhook) {
+	status, err := post(ws.client, hook, d)
+
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	d.Attempts++
+	entry := &DeliveryAttempt{DeliveryId: d.Id, WebhookId: d.WebhookId, Attempt: d.Attempts,
+		Time: time.Now(), Status: status}
+	if err != nil {
+		entry.Error = err.Error()
+		d.LastError = err.Error()
+	}
+	ws.Log = append(ws.Log, entry)
+	if len(ws.Log) > maxLogEntries {
+		ws.Log = ws.Log[len(ws.Log)-maxLogEntries:]
+	}
+
+	if _, ok := ws.Hooks[d.WebhookId]; !ok {
+		ws.remove(d) // deleted during the attempt
+	} else if err == nil {
+		ws.remove(d)
+	} else if d.Attempts >= maxAttempts {
+		ws.remove(d)
+		ws.Dead = append(ws.Dead, d)
+		if len(ws.Dead) > maxDeadLetters {
+			ws.Dead = ws.Dead[len(ws.Dead)-maxDeadLetters:]
+		}
+		log.Println("Webhook delivery", d.Id, "is dead:", err)
+	} else {
+		d.NextAttempt = time.Now().Add(backoff(d.Attempts))
+	}
+	ws.changed()
+}
+
+func (ws *WebhookState) remove(d *Delivery) {
+	for i, q := range ws.Queue {
+		if q == d {
+			ws.Queue = append(ws.Queue[:i], ws.Queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ws *WebhookState) wake() {
+	select {
+	case ws.wakeup <- true:
+	default:
+	}
+}
+
+// Note a change for the next flush. Caller holds the lock.
+func (ws *WebhookState) changed() {
+	ws.dirty = true
+}
+
+// Write the file if anything has changed. Only the snapshot is taken under
+// the lock; the caller must not hold it.
+func (ws *WebhookState) flush() {
+	ws.saving.Lock()
+	defer ws.saving.Unlock()
+
+	ws.lock.Lock()
+	if !ws.dirty {
+		ws.lock.Unlock()
+		return
+	}
+	doc, err := json.MarshalIndent(ws, "", " ")
+	ws.dirty = false
+	ws.lock.Unlock()
+
+	if err == nil {
+		err = writeFile(ws.file, doc)
+	}
+	if err != nil {
+		log.Println("Cannot save " + ws.file + ":", err)
+	}
+}
+
+//** utility functions
+// Sign the payload with HMAC-SHA256 under the webhook's secret; receivers
+// recompute it over the raw body to authenticate the delivery.
+func post(client *http.Client, hook Webhook, d *Delivery) (int, error) {
+	mac := hmac.New(sha256.New, []byte(hook.Secret))
+	mac.Write(d.Payload)
+
+	request, err := http.NewRequest("POST", hook.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Sayings-Event", d.Event)
+	request.Header.Set("X-Sayings-Delivery", strconv.Itoa(d.Id))
+	request.Header.Set("X-Sayings-Signature", "sha256=" + hex.EncodeToString(mac.Sum(nil)))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, errors.New("Receiver answered " + response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// 2s, 4s, 8s, ... up to an hour.
+func backoff(attempts int) time.Duration {
+	wait := firstBackoff << uint(attempts-1)
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// The webhooks and queue persisted in file_name, if any.
+func loadWebhooks(file_name string) (*WebhookState, error) {
+	ws := &WebhookState{
+		HookId:     1,
+		DeliveryId: 1,
+		file:       file_name,
+		wakeup:     make(chan bool, 1),
+		client:     &http.Client{Timeout: deliveryTimeout}}
+	if _, err := readJSONFile(file_name, ws); err != nil {
+		return nil, err
+	}
+	if ws.Hooks == nil {
+		ws.Hooks = make(map[int]*Webhook)
+	}
+	return ws, nil
+}
+
+// Start the delivery worker. Deliveries are queued from the moment the
+// GlobalState is made, and go out once this is called.
+func (gs *GlobalState) StartWebhooks() {
+	go gs.webhooks.run()
+}
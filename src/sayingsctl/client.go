@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// As the rest service serves it.
+type Saying struct {
+	Id          int
+	PredictorId int
+	Predictor   string
+	Prediction  string
+	CompanyId   int      `json:",omitempty" xml:",omitempty"`
+	Tags        []string `json:",omitempty" xml:"Tag,omitempty"`
+}
+
+// As /sayings/stats serves it.
+type Stats struct {
+	XMLName    xml.Name `json:"-" xml:"Stats"`
+	Sayings    int
+	Predictors []struct {
+		PredictorId int
+		Predictor   string
+		Sayings     int
+	} `xml:"Predictors>Predictor"`
+	Words    []TermCount `xml:"Words>Word"`
+	Bigrams  []TermCount `xml:"Bigrams>Bigram"`
+	Trigrams []TermCount `xml:"Trigrams>Trigram"`
+	Lengths  struct {
+		Shortest int
+		Longest  int
+		Mean     float64
+		Buckets  []struct{ From, To, Count int } `xml:"Bucket"`
+	}
+	Rates []struct {
+		Window                   string
+		Created, Edited, Deleted int
+	} `xml:"Rates>Rate"`
+}
+
+type TermCount struct {
+	Term  string
+	Count int
+}
+
+type Client struct {
+	base    string
+	http    *http.Client
+	line    string // line-protocol address, for watch
+	timeout time.Duration
+}
+
+func newClient(opts *options) (*Client, *Profile, error) {
+	p, err := opts.resolve()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := &tls.Config{InsecureSkipVerify: p.Insecure}
+	if p.CACert != "" {
+		pem, err := ioutil.ReadFile(p.CACert)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, nil, errors.New("no certificates in " + p.CACert)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+
+	c := &Client{base: strings.TrimRight(p.Server, "/"),
+		http: &http.Client{Timeout: opts.timeout, Transport: transport},
+		line: p.LineAddr, timeout: opts.timeout}
+	if c.line == "" {
+		u, err := url.Parse(c.base)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.line = net.JoinHostPort(u.Hostname(), defaultLinePort)
+	}
+	return c, p, nil
+}
+
+// Send the request; anything but a 2xx status is an error carrying the
+// body the server sent back.
+func (c *Client) do(method string, path string, form url.Values, header http.Header) ([]byte, error) {
+	var request *http.Request
+	var err error
+	if form != nil {
+		request, err = http.NewRequest(method, c.base+path, strings.NewReader(form.Encode()))
+		if err == nil {
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		request, err = http.NewRequest(method, c.base+path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, response.Status, strings.TrimSpace(string(body)))
+	}
+	// The service answers with an empty body while it shuts down.
+	if len(body) == 0 && method == "GET" {
+		return nil, errors.New("empty response from " + c.base + "; is the server shutting down?")
+	}
+	return body, nil
+}
+
+func (c *Client) sayings() ([]*Saying, error) {
+	body, err := c.do("GET", "/sayingsJSON", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	list := []*Saying{}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (c *Client) saying(id int) (*Saying, error) {
+	body, err := c.do("GET", "/sayingJSON/"+strconv.Itoa(id), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var s *Saying
+	if err := json.Unmarshal(body, &s); err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, fmt.Errorf("no Saying %d", id)
+	}
+	return s, nil
+}
+
+func (c *Client) stats(top int) (*Stats, error) {
+	body, err := c.do("GET", "/sayings/stats?top="+strconv.Itoa(top), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{}
+	if err := json.Unmarshal(body, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// The service reports most failures as a 200 with a message in place of
+// the usual confirmation, so success means the confirmation matches.
+var (
+	createdRE = regexp.MustCompile(`^(?:New )?Saying ([0-9]+) (?:created|already exists)`)
+	updatedRE = regexp.MustCompile(`^Saying [0-9]+ updated`)
+	deletedRE = regexp.MustCompile(`^Saying [0-9]+ deleted`)
+)
+
+// Create s, with its company and tags if it has them. Returns the new
+// Saying's id and the server's message. A non-empty key is sent as the
+// Idempotency-Key, so a retry cannot create a second copy.
+func (c *Client) create(s *Saying, key string) (int, string, error) {
+	form := sayingForm(s.Predictor, s.PredictorId, s.Prediction)
+	if s.CompanyId != 0 {
+		form.Set("companyId", strconv.Itoa(s.CompanyId))
+	}
+	if len(s.Tags) > 0 {
+		form.Set("tags", strings.Join(s.Tags, ","))
+	}
+	header := http.Header{}
+	if key != "" {
+		header.Set("Idempotency-Key", key)
+	}
+
+	body, err := c.do("POST", "/sayingCreate", form, header)
+	if err != nil {
+		return 0, "", err
+	}
+	msg := confirmation(body)
+	m := createdRE.FindStringSubmatch(msg)
+	if m == nil {
+		return 0, "", errors.New(msg)
+	}
+	id, _ := strconv.Atoi(m[1])
+	return id, msg, nil
+}
+
+func (c *Client) edit(id int, predictor string, predictorId int, prediction string) error {
+	form := sayingForm(predictor, predictorId, prediction)
+	form.Set("id", strconv.Itoa(id))
+	body, err := c.do("PUT", "/sayingEdit", form, nil)
+	if err != nil {
+		return err
+	}
+	if msg := confirmation(body); !updatedRE.MatchString(msg) {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+func (c *Client) delete(id int) error {
+	body, err := c.do("DELETE", "/sayingDelete/"+strconv.Itoa(id), nil, nil)
+	if err != nil {
+		return err
+	}
+	if msg := confirmation(body); !deletedRE.MatchString(msg) {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// Relay the server's change events to event, over the line protocol's
+// WATCH (see rest's tcpServe.go), until stop is closed or the server hangs
+// up. An event carries what the line protocol shows of its Saying: the id,
+// predictor and prediction.
+func (c *Client) watch(stop <-chan os.Signal, event func(kind string, s *Saying) error) error {
+	conn, err := net.DialTimeout("tcp", c.line, c.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "WATCH\n"); err != nil {
+		return err
+	}
+
+	// Hanging up on a stop ends the read below.
+	finished := make(chan bool)
+	defer close(finished)
+	stopped := make(chan bool)
+	go func() {
+		select {
+		case <-stop:
+			close(stopped)
+			conn.Close()
+		case <-finished:
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			select {
+			case <-stopped:
+				return nil
+			default:
+			}
+			if err == io.EOF {
+				err = errors.New("watch: " + c.line + " hung up")
+			}
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "OK watching":
+		case strings.HasPrefix(line, "ERR "):
+			return errors.New("watch: " + strings.TrimPrefix(line, "ERR "))
+		case strings.HasPrefix(line, "EVENT "):
+			parts := strings.SplitN(strings.TrimPrefix(line, "EVENT "), " ", 2)
+			s := parseSayingLine(parts[len(parts)-1])
+			if len(parts) < 2 || s == nil {
+				return errors.New("watch: bad event " + line)
+			}
+			if err := event(parts[0], s); err != nil {
+				return err
+			}
+		default:
+			return errors.New("watch: unexpected " + line)
+		}
+	}
+}
+
+// How the line protocol writes a Saying: "%2d. %s says: %s", with line
+// breaks and backslashes escaped.
+var (
+	sayingLineRE  = regexp.MustCompile(`(?s)^ *([0-9]+)\. (.*?) says: (.*)$`)
+	lineUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r")
+)
+
+func parseSayingLine(line string) *Saying {
+	m := sayingLineRE.FindStringSubmatch(lineUnescaper.Replace(line))
+	if m == nil {
+		return nil
+	}
+	id, _ := strconv.Atoi(m[1])
+	return &Saying{Id: id, Predictor: m[2], Prediction: m[3]}
+}
+
+// The predictor goes by id when one is given, else by name.
+func sayingForm(predictor string, predictorId int, prediction string) url.Values {
+	form := url.Values{"prediction": {prediction}}
+	if predictorId != 0 {
+		form.Set("predictorId", strconv.Itoa(predictorId))
+	} else {
+		form.Set("predictor", predictor)
+	}
+	return form
+}
+
+// The server's messages end in a newline and a stray full stop.
+func confirmation(body []byte) string {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(string(body)), "."))
+}
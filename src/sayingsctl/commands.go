@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"datafiles"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// sayingsctl list [-predictor name] [-tag t]
+func cmdList(args []string) error {
+	fs, opts := newFlagSet("list")
+	predictor := fs.String("predictor", "", "only sayings by this predictor")
+	tag := fs.String("tag", "", "only sayings with this tag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := positional(fs, 0); err != nil {
+		return err
+	}
+	c, p, err := newClient(opts)
+	if err != nil {
+		return err
+	}
+
+	list, err := c.sayings()
+	if err != nil {
+		return err
+	}
+	matches := []*Saying{}
+	for _, s := range list {
+		if *predictor != "" && !strings.EqualFold(s.Predictor, *predictor) { continue }
+		if *tag != "" && !hasTag(s, strings.ToLower(*tag)) { continue }
+		matches = append(matches, s)
+	}
+	return printSayings(stdout, p.Output, matches)
+}
+
+// sayingsctl get ID
+func cmdGet(args []string) error {
+	fs, opts := newFlagSet("get")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	rest, err := positional(fs, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseId(rest[0])
+	if err != nil {
+		return err
+	}
+	c, p, err := newClient(opts)
+	if err != nil {
+		return err
+	}
+
+	s, err := c.saying(id)
+	if err != nil {
+		return err
+	}
+	return printSaying(stdout, p.Output, s)
+}
+
+// sayingsctl create -predictor name|-predictor-id n -prediction text [-company-id n] [-tags t,...] [-key k]
+func cmdCreate(args []string) error {
+	fs, opts := newFlagSet("create")
+	predictor := fs.String("predictor", "", "predictor's name (created if new)")
+	predictorId := fs.Int("predictor-id", 0, "predictor's id, instead of a name")
+	prediction := fs.String("prediction", "", "the prediction")
+	companyId := fs.Int("company-id", 0, "the company the saying belongs to")
+	tags := fs.String("tags", "", "comma-separated tags")
+	key := fs.String("key", "", "Idempotency-Key, so that a retry is harmless")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := positional(fs, 0); err != nil {
+		return err
+	}
+	c, p, err := newClient(opts)
+	if err != nil {
+		return err
+	}
+
+	s := &Saying{Predictor: *predictor, PredictorId: *predictorId, Prediction: *prediction, CompanyId: *companyId}
+	if *tags != "" {
+		s.Tags = strings.Split(*tags, ",")
+	}
+	id, msg, err := c.create(s, *key)
+	if err != nil {
+		return err
+	}
+	if p.Output == "table" {
+		fmt.Fprintln(stdout, msg)
+		return nil
+	}
+	s, err = c.saying(id)
+	if err != nil {
+		return err
+	}
+	return printSaying(stdout, p.Output, s)
+}
+
+// sayingsctl edit -id ID [-predictor name|-predictor-id n] [-prediction text]
+func cmdEdit(args []string) error {
+	fs, opts := newFlagSet("edit")
+	id := fs.Int("id", 0, "saying to change")
+	predictor := fs.String("predictor", "", "new predictor's name")
+	predictorId := fs.Int("predictor-id", 0, "new predictor's id, instead of a name")
+	prediction := fs.String("prediction", "", "new prediction")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := positional(fs, 0); err != nil {
+		return err
+	}
+	if *id < 1 {
+		return errors.New("edit: want -id")
+	}
+	c, p, err := newClient(opts)
+	if err != nil {
+		return err
+	}
+
+	if err := c.edit(*id, *predictor, *predictorId, *prediction); err != nil {
+		return err
+	}
+	s, err := c.saying(*id)
+	if err != nil {
+		return err
+	}
+	return printSaying(stdout, p.Output, s)
+}
+
+// sayingsctl delete ID...
+func cmdDelete(args []string) error {
+	fs, opts := newFlagSet("delete")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("delete: want at least one id")
+	}
+	ids := []int{}
+	for _, arg := range fs.Args() {
+		id, err := parseId(arg)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	c, _, err := newClient(opts)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := c.delete(id); err != nil {
+			return fmt.Errorf("Saying %d: %v", id, err)
+		}
+		fmt.Fprintf(stdout, "Saying %d deleted\n", id)
+	}
+	return nil
+}
+
+// sayingsctl import [-dry-run] FILE ("-" for standard input)
+// Each saying keeps its company and tags, and is sent with an
+// Idempotency-Key made from its content, so an interrupted import can
+// simply be run again.
+func cmdImport(args []string) error {
+	fs, opts := newFlagSet("import")
+	dryRun := fs.Bool("dry-run", false, "show what would be imported, without importing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	rest, err := positional(fs, 1)
+	if err != nil {
+		return err
+	}
+	list, err := readSayings(rest[0])
+	if err != nil {
+		return err
+	}
+	c, _, err := newClient(opts)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i, s := range list {
+		if *dryRun {
+			fmt.Fprintf(stdout, "%d: %s says: %s\n", i+1, s.Predictor, s.Prediction)
+			continue
+		}
+		_, msg, err := c.create(&Saying{Predictor: s.Predictor, Prediction: s.Prediction,
+			CompanyId: s.CompanyId, Tags: s.Tags}, importKey(s))
+		if err != nil {
+			failed++
+			msg = "failed: " + err.Error()
+		}
+		fmt.Fprintf(stdout, "%d: %s\n", i+1, msg)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sayings not imported", failed, len(list))
+	}
+	return nil
+}
+
+// sayingsctl export [-file f] [-format json|xml|lines]
+func cmdExport(args []string) error {
+	fs, opts := newFlagSet("export")
+	file := fs.String("file", "-", "output file, or - for standard output")
+	format := fs.String("format", "json", "json, xml, or lines (Predictor!Prediction[!CompanyId], as in sayings.db)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := positional(fs, 0); err != nil {
+		return err
+	}
+	c, _, err := newClient(opts)
+	if err != nil {
+		return err
+	}
+	list, err := c.sayings()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = stdout
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "json":
+		return printJSON(w, list)
+	case "xml":
+		return printXML(w, &sayingList{Sayings: list})
+	case "lines":
+		bw := bufio.NewWriter(w)
+		for _, s := range list {
+			fmt.Fprintln(bw, datafiles.FormatSaying(&datafiles.Saying{Predictor: s.Predictor,
+				Prediction: s.Prediction, CompanyId: s.CompanyId}))
+		}
+		return bw.Flush()
+	}
+	return errors.New("export: unknown format " + *format)
+}
+
+// sayingsctl watch [-line-addr host:port]
+// Follows the server's WATCH feed on its line-protocol port. A created or
+// edited Saying is looked up over HTTP, for the parts the feed leaves out.
+func cmdWatch(args []string) error {
+	fs, opts := newFlagSet("watch")
+	lineAddr := fs.String("line-addr", "", "line-protocol host:port, overriding the profile")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := positional(fs, 0); err != nil {
+		return err
+	}
+	c, p, err := newClient(opts)
+	if err != nil {
+		return err
+	}
+	if *lineAddr != "" {
+		c.line = *lineAddr
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+	return c.watch(stop, func(kind string, s *Saying) error {
+		if kind != "deleted" {
+			if full, err := c.saying(s.Id); err == nil {
+				s = full
+			}
+		}
+		return printEvent(p.Output, &Event{Time: time.Now(), Kind: kind, Saying: s})
+	})
+}
+
+// One change seen by watch.
+type Event struct {
+	XMLName xml.Name `json:"-" xml:"Event"`
+	Time    time.Time
+	Kind    string // created, edited or deleted
+	Saying  *Saying
+}
+
+// One line per event, so the output can be piped.
+func printEvent(format string, e *Event) error {
+	switch format {
+	case "json":
+		doc, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, string(doc))
+	case "xml":
+		doc, err := xml.Marshal(e)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, string(doc))
+	default:
+		fmt.Fprintf(stdout, "%s %-7s %d %s says: %s\n", e.Time.Format("15:04:05"), e.Kind,
+			e.Saying.Id, e.Saying.Predictor, e.Saying.Prediction)
+	}
+	return nil
+}
+
+// sayingsctl stats [-top n]
+func cmdStats(args []string) error {
+	fs, opts := newFlagSet("stats")
+	top := fs.Int("top", 10, "rows in the word and n-gram tables")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := positional(fs, 0); err != nil {
+		return err
+	}
+	c, p, err := newClient(opts)
+	if err != nil {
+		return err
+	}
+	stats, err := c.stats(*top)
+	if err != nil {
+		return err
+	}
+
+	switch p.Output {
+	case "json":
+		return printJSON(stdout, stats)
+	case "xml":
+		return printXML(stdout, stats)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Sayings:\t%d\n", stats.Sayings)
+	fmt.Fprintf(tw, "Predictors:\t%d\n", len(stats.Predictors))
+	fmt.Fprintf(tw, "Length (chars):\tmin %d, mean %.1f, max %d\n",
+		stats.Lengths.Shortest, stats.Lengths.Mean, stats.Lengths.Longest)
+	for _, r := range stats.Rates {
+		fmt.Fprintf(tw, "Last %s:\t%d created, %d edited, %d deleted\n", r.Window, r.Created, r.Edited, r.Deleted)
+	}
+	fmt.Fprintln(tw, "\nPREDICTOR\tSAYINGS")
+	for _, pc := range stats.Predictors {
+		fmt.Fprintf(tw, "%s\t%d\n", pc.Predictor, pc.Sayings)
+	}
+	fmt.Fprintln(tw, "\nWORD\tCOUNT")
+	for _, t := range stats.Words {
+		fmt.Fprintf(tw, "%s\t%d\n", t.Term, t.Count)
+	}
+	fmt.Fprintln(tw, "\nBIGRAM\tCOUNT")
+	for _, t := range stats.Bigrams {
+		fmt.Fprintf(tw, "%s\t%d\n", t.Term, t.Count)
+	}
+	return tw.Flush()
+}
+
+//** utilities
+func parseId(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 1 {
+		return 0, errors.New("bad id " + s)
+	}
+	return id, nil
+}
+
+func hasTag(s *Saying, tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// A JSON array as written by export, or lines as in sayings.db (see
+// datafiles.ParseSayings).
+func readSayings(file_name string) ([]*Saying, error) {
+	var doc []byte
+	var err error
+	if file_name == "-" {
+		doc, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		doc, err = ioutil.ReadFile(file_name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := []*Saying{}
+	if trimmed := strings.TrimSpace(string(doc)); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(doc, &list); err != nil {
+			return nil, fmt.Errorf("%s: %v", file_name, err)
+		}
+		return list, nil
+	}
+	records, _, err := datafiles.ParseSayings(file_name, string(doc))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		list = append(list, &Saying{Predictor: r.Predictor, Prediction: r.Prediction, CompanyId: r.CompanyId})
+	}
+	return list, nil
+}
+
+// The company and tags count only when present, so that keys from imports
+// made before they were carried still match.
+func importKey(s *Saying) string {
+	content := s.Predictor + "\x00" + s.Prediction
+	if s.CompanyId != 0 || len(s.Tags) > 0 {
+		content += "\x00" + strconv.Itoa(s.CompanyId) + "\x00" + strings.Join(s.Tags, ",")
+	}
+	sum := sha256.Sum256([]byte(content))
+	return "import-" + hex.EncodeToString(sum[:12])
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	srv := newFakeServer(t)
+	out := srv.ok("list")
+	expectContains(t, "table", out, "ID  PREDICTOR", "1   Ada Lovelace  Engines will compose music.  tech",
+		"2   Lord Kelvin")
+
+	out = srv.ok("list", "-predictor", "lord kelvin")
+	if strings.Contains(out, "Ada") || !strings.Contains(out, "Kelvin") {
+		t.Errorf("by predictor: %q", out)
+	}
+	out = srv.ok("list", "-tag", "TECH")
+	if !strings.Contains(out, "Ada") || strings.Contains(out, "Kelvin") {
+		t.Errorf("by tag: %q", out)
+	}
+
+	var list []*Saying
+	if err := json.Unmarshal([]byte(srv.ok("list", "-output", "json")), &list); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "json", len(list), 2)
+	expect(t, "json company", list[0].CompanyId, 2)
+
+	doc := &sayingList{}
+	if err := xml.Unmarshal([]byte(srv.ok("list", "-output", "xml")), doc); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "xml", len(doc.Sayings), 2)
+	expect(t, "xml tags", doc.Sayings[0].Tags, []string{"tech"})
+
+	if _, err := srv.run("list", "-output", "yaml"); err == nil {
+		t.Error("no error for -output yaml")
+	}
+	if _, err := srv.run("list", "extra"); err == nil {
+		t.Error("no error for an argument")
+	}
+}
+
+func TestGet(t *testing.T) {
+	srv := newFakeServer(t)
+	expectContains(t, "table", srv.ok("get", "1"), "Predictor:   Ada Lovelace (1)", "Company:     2", "Tags:        tech")
+	if out := srv.ok("get", "2"); strings.Contains(out, "Company") || strings.Contains(out, "Tags") {
+		t.Errorf("empty company and tags shown: %q", out)
+	}
+
+	var s Saying
+	if err := json.Unmarshal([]byte(srv.ok("get", "-output", "json", "2")), &s); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "json", s.Predictor, "Lord Kelvin")
+
+	for _, args := range [][]string{{"get", "9"}, {"get", "x"}, {"get"}} {
+		if _, err := srv.run(args...); err == nil {
+			t.Errorf("%v: no error", args)
+		}
+	}
+}
+
+func TestCreateEditDelete(t *testing.T) {
+	srv := newFakeServer(t)
+	out := srv.ok("create", "-predictor", "Grace Hopper", "-prediction", "Compilers will be everywhere.",
+		"-company-id", "3", "-tags", "tech,software")
+	expect(t, "create", out, "New Saying 3 created\n")
+	s := srv.saying(3)
+	expect(t, "company", s.CompanyId, 3)
+	expect(t, "tags", s.Tags, []string{"tech", "software"})
+
+	if _, err := srv.run("create", "-predictor", "Grace Hopper", "-prediction", "Soon."); err == nil ||
+		err.Error() != "Prediction/predictor must be >= 6 chars" {
+		t.Errorf("too short: %v", err)
+	}
+
+	// With a key, a retry finds the first Saying instead of making another.
+	args := []string{"create", "-output", "json", "-key", "k1", "-predictor", "Alan Kay",
+		"-prediction", "The best way to predict the future is to invent it."}
+	first, second := srv.ok(args...), srv.ok(args...)
+	expect(t, "retry", second, first)
+	expect(t, "sayings", len(srv.sayings), 4)
+
+	out = srv.ok("edit", "-id", "3", "-prediction", "Compilers are everywhere.")
+	expectContains(t, "edit", out, "Prediction:  Compilers are everywhere.")
+	if _, err := srv.run("edit", "-prediction", "No id here."); err == nil {
+		t.Error("edit: no error without -id")
+	}
+	if _, err := srv.run("edit", "-id", "9", "-prediction", "Not there."); err == nil {
+		t.Error("edit: no error for a missing Saying")
+	}
+
+	expect(t, "delete", srv.ok("delete", "3", "4"), "Saying 3 deleted\nSaying 4 deleted\n")
+	if _, err := srv.run("delete", "3"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("delete again: %v", err)
+	}
+	if _, err := srv.run("delete"); err == nil {
+		t.Error("delete: no error without ids")
+	}
+}
+
+// An import keeps each Saying's company and tags, and running it again
+// creates nothing new.
+func TestImport(t *testing.T) {
+	source := newFakeServer(t)
+	file := filepath.Join(t.TempDir(), "export.json")
+	srv := newFakeServer(t)
+	srv.sayings = map[int]*Saying{}
+	srv.nextId = 1
+
+	source.ok("export", "-file", file)
+	out := srv.ok("import", file)
+	expect(t, "import", out, "1: New Saying 1 created\n2: New Saying 2 created\n")
+	s := srv.saying(1)
+	expect(t, "predictor", s.Predictor, "Ada Lovelace")
+	expect(t, "company", s.CompanyId, 2)
+	expect(t, "tags", s.Tags, []string{"tech"})
+	expect(t, "untagged", srv.saying(2).Tags, []string(nil))
+
+	srv.ok("import", file)
+	expect(t, "sayings after a second import", len(srv.sayings), 2)
+
+	// Lines as in sayings.db carry a company id too.
+	lines := filepath.Join(t.TempDir(), "sayings.db")
+	ioutil.WriteFile(lines, []byte("Alan Kay!Predict by inventing.!4\n"), 0644)
+	expect(t, "dry run", srv.ok("import", "-dry-run", lines), "1: Alan Kay says: Predict by inventing.\n")
+	expect(t, "sayings after a dry run", len(srv.sayings), 2)
+	srv.ok("import", lines)
+	expect(t, "lines company", srv.saying(3).CompanyId, 4)
+
+	if _, err := srv.run("import", filepath.Join(t.TempDir(), "nonesuch.json")); err == nil {
+		t.Error("no error for a missing file")
+	}
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	ioutil.WriteFile(bad, []byte(`[{"Predictor": "Ann", "Prediction": "Soon."}]`), 0644)
+	if _, err := srv.run("import", bad); err == nil || err.Error() != "1 of 1 sayings not imported" {
+		t.Errorf("failed import: %v", err)
+	}
+}
+
+func TestImportKey(t *testing.T) {
+	s := &Saying{Predictor: "Ada Lovelace", Prediction: "Engines will compose music."}
+	plain := importKey(s)
+	expect(t, "id ignored", importKey(&Saying{Id: 7, Predictor: s.Predictor, Prediction: s.Prediction}), plain)
+	s.CompanyId = 2
+	if importKey(s) == plain {
+		t.Error("company ignored")
+	}
+	withCompany := importKey(s)
+	s.Tags = []string{"tech"}
+	if importKey(s) == withCompany {
+		t.Error("tags ignored")
+	}
+}
+
+func TestExport(t *testing.T) {
+	srv := newFakeServer(t)
+	out := srv.ok("export", "-format", "lines")
+	expect(t, "lines", out, "Ada Lovelace!Engines will compose music.!2\nLord Kelvin!Radio has no future.\n")
+
+	var list []*Saying
+	if err := json.Unmarshal([]byte(srv.ok("export")), &list); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "json", len(list), 2)
+	expectContains(t, "xml", srv.ok("export", "-format", "xml"), "<Sayings>", "<Tag>tech</Tag>")
+
+	file := filepath.Join(t.TempDir(), "export.xml")
+	expect(t, "to a file", srv.ok("export", "-format", "xml", "-file", file), "")
+	if doc, _ := ioutil.ReadFile(file); !strings.Contains(string(doc), "<Sayings>") {
+		t.Errorf("file: %q", doc)
+	}
+	if _, err := srv.run("export", "-format", "csv"); err == nil {
+		t.Error("no error for -format csv")
+	}
+}
+
+// Watch follows the WATCH feed, and fills in what it leaves out from the
+// HTTP side.
+func TestWatch(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.events <- `EVENT edited  1. Ada Lovelace says: Engines will compose\nmusic.`
+	srv.events <- `EVENT deleted  2. Lord Kelvin says: Radio has no future.`
+	close(srv.events)
+
+	out, err := srv.run("watch", "-line-addr", srv.line.Addr().String(), "-output", "json")
+	if err == nil || !strings.HasSuffix(err.Error(), "hung up") {
+		t.Errorf("hang-up: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	expect(t, "events", len(lines), 2)
+	events := make([]Event, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect(t, "kind", events[0].Kind, "edited")
+	expect(t, "looked up", events[0].Saying.Tags, []string{"tech"})
+	expect(t, "kind", events[1].Kind, "deleted")
+	expect(t, "deleted", *events[1].Saying, Saying{Id: 2, Predictor: "Lord Kelvin", Prediction: "Radio has no future."})
+	if time.Since(events[0].Time) > time.Minute {
+		t.Errorf("time: %v", events[0].Time)
+	}
+}
+
+func TestWatchFeed(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		lines []string
+		want  string // the error
+	}{
+		{"shutdown", []string{"ERR shutting down"}, "watch: shutting down"},
+		{"bad event", []string{"EVENT created"}, "watch: bad event EVENT created"},
+		{"unexpected", []string{"OK 3"}, "watch: unexpected OK 3"},
+	} {
+		srv := newFakeServer(t)
+		for _, line := range c.lines {
+			srv.events <- line
+		}
+		_, err := srv.run("watch", "-line-addr", srv.line.Addr().String())
+		expect(t, c.name, err, c.want)
+	}
+
+	// A stop ends the watch quietly.
+	srv := newFakeServer(t)
+	c := &Client{line: srv.line.Addr().String(), timeout: time.Second}
+	stop := make(chan os.Signal, 1)
+	srv.events <- `EVENT created  3. Alan Kay says: Invent it.`
+	err := c.watch(stop, func(kind string, s *Saying) error {
+		expect(t, "event", kind+" "+s.Predictor, "created Alan Kay")
+		stop <- os.Interrupt
+		return nil
+	})
+	expect(t, "stopped", err, nil)
+
+	closed := newFakeServer(t)
+	closed.line.Close()
+	if _, err := closed.run("watch", "-line-addr", closed.line.Addr().String()); err == nil {
+		t.Error("no error without a listener")
+	}
+}
+
+func TestStats(t *testing.T) {
+	srv := newFakeServer(t)
+	expectContains(t, "table", srv.ok("stats"), "Sayings:         2", "mean 23.5",
+		"Last 1h:         3 created, 0 edited, 0 deleted", "Ada Lovelace  1", "engines  1")
+	var stats Stats
+	if err := json.Unmarshal([]byte(srv.ok("stats", "-output", "json")), &stats); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "json", stats.Words[0].Term, "engines")
+	expectContains(t, "xml", srv.ok("stats", "-output", "xml"), "<Stats>", "<Word>")
+}
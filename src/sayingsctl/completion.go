@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Profile names are completed by asking sayingsctl itself, so the scripts
+// need not change as profiles come and go.
+const bashCompletion = `# sayingsctl completion for bash: source <(sayingsctl completion bash)
+_sayingsctl() {
+	local cur prev cmd i
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	prev="${COMP_WORDS[COMP_CWORD-1]}"
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		case "${COMP_WORDS[i]}" in
+		-*) ;;
+		*) cmd="${COMP_WORDS[i]}"; break ;;
+		esac
+	done
+
+	case "$prev" in
+	-profile) COMPREPLY=($(compgen -W "$(sayingsctl profile names 2>/dev/null)" -- "$cur")); return ;;
+	-output) COMPREPLY=($(compgen -W "table json xml" -- "$cur")); return ;;
+	-format) COMPREPLY=($(compgen -W "json xml lines" -- "$cur")); return ;;
+	-file|-ca-cert) COMPREPLY=($(compgen -f -- "$cur")); return ;;
+	esac
+
+	if [[ -z "$cmd" ]]; then
+		COMPREPLY=($(compgen -W "%s %s" -- "$cur"))
+		return
+	fi
+	case "$cmd" in
+	profile)
+		if [[ "$prev" == use || "$prev" == delete || "$prev" == set ]]; then
+			COMPREPLY=($(compgen -W "$(sayingsctl profile names 2>/dev/null)" -- "$cur"))
+		else
+			COMPREPLY=($(compgen -W "list names use set delete" -- "$cur"))
+		fi ;;
+	completion) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;
+	import) COMPREPLY=($(compgen -f -- "$cur")) ;;
+	*) COMPREPLY=($(compgen -W "%s" -- "$cur")) ;;
+	esac
+}
+complete -F _sayingsctl sayingsctl
+`
+
+const fishCompletion = `# sayingsctl completion for fish: sayingsctl completion fish | source
+complete -c sayingsctl -f
+complete -c sayingsctl -n __fish_use_subcommand -a '%s'
+complete -c sayingsctl -o profile -x -a '(sayingsctl profile names 2>/dev/null)'
+complete -c sayingsctl -o output -x -a 'table json xml'
+complete -c sayingsctl -o server -x
+complete -c sayingsctl -n '__fish_seen_subcommand_from profile' -a 'list names use set delete'
+complete -c sayingsctl -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+complete -c sayingsctl -n '__fish_seen_subcommand_from import' -F
+`
+
+// Flags every command takes.
+var commonFlags = []string{"-profile", "-server", "-output", "-insecure", "-timeout"}
+
+// sayingsctl completion bash|zsh|fish
+func cmdCompletion(args []string) error {
+	if len(args) != 1 {
+		return errors.New("completion: want bash, zsh or fish")
+	}
+	names := strings.Join(commandNames(), " ")
+	flags := strings.Join(commonFlags, " ")
+
+	switch args[0] {
+	case "bash":
+		fmt.Fprintf(stdout, bashCompletion, names, flags, flags)
+	case "zsh":
+		// zsh runs the bash script through its compatibility layer.
+		fmt.Fprintln(stdout, "autoload -U +X bashcompinit && bashcompinit")
+		fmt.Fprintf(stdout, bashCompletion, names, flags, flags)
+	case "fish":
+		fmt.Fprintf(stdout, fishCompletion, names)
+	default:
+		return errors.New("completion: unknown shell " + args[0])
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// A server to talk to. Output, if set, is the profile's default format.
+type Profile struct {
+	Server   string
+	Insecure bool   `json:",omitempty"` // skip TLS certificate checks
+	CACert   string `json:",omitempty"` // PEM file to trust, e.g. from gencert
+	Output   string `json:",omitempty"`
+	LineAddr string `json:",omitempty"` // line-protocol host:port, for watch
+}
+
+// Kept in $SAYINGSCTL_CONFIG, or sayingsctl/config.json under the user's
+// configuration directory.
+type Config struct {
+	Current  string
+	Profiles map[string]*Profile
+}
+
+const defaultServer = "http://localhost:9999"
+
+// Without a LineAddr, watch tries the server's host on the rest service's
+// default line-protocol port.
+const defaultLinePort = "9876"
+
+// Flags shared by every command; empty values fall back to the profile.
+type options struct {
+	profile  string
+	server   string
+	output   string
+	insecure bool
+	timeout  time.Duration
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	if o.timeout == 0 {
+		o.timeout = 10 * time.Second
+	}
+	fs.StringVar(&o.profile, "profile", o.profile, "server profile to use (default: the current one)")
+	fs.StringVar(&o.server, "server", o.server, "server URL, overriding the profile")
+	fs.StringVar(&o.output, "output", o.output, "output format: table, json or xml")
+	fs.BoolVar(&o.insecure, "insecure", o.insecure, "skip TLS certificate verification")
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "HTTP request timeout")
+}
+
+// The profile the options select, with the flags applied over it.
+func (o *options) resolve() (*Profile, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	name := o.profile
+	if name == "" {
+		name = cfg.Current
+	}
+	p := &Profile{Server: defaultServer}
+	if found, ok := cfg.Profiles[name]; ok {
+		*p = *found
+	} else if o.profile != "" {
+		return nil, errors.New("no profile " + o.profile)
+	}
+
+	if o.server != "" {
+		p.Server = o.server
+	}
+	if o.insecure {
+		p.Insecure = true
+	}
+	if o.output != "" {
+		p.Output = o.output
+	}
+	if p.Output == "" {
+		p.Output = "table"
+	}
+	switch p.Output {
+	case "table", "json", "xml":
+	default:
+		return nil, errors.New("unknown output format " + p.Output)
+	}
+	return p, nil
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("SAYINGSCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sayingsctl", "config.json"), nil
+}
+
+// A missing file gives a single "local" profile.
+func loadConfig() (*Config, error) {
+	cfg := &Config{Current: "local", Profiles: map[string]*Profile{"local": {Server: defaultServer}}}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(doc, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]*Profile)
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	doc, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(doc, '\n'), 0600)
+}
+
+func (cfg *Config) names() []string {
+	names := []string{}
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sayingsctl profile list|names|use NAME|set NAME -server URL ...|delete NAME
+func cmdProfile(args []string) error {
+	if len(args) == 0 {
+		return errors.New("profile: want list, names, use, set or delete")
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "\tNAME\tSERVER\tOUTPUT")
+		for _, name := range cfg.names() {
+			p := cfg.Profiles[name]
+			mark := ""
+			if name == cfg.Current {
+				mark = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, name, p.Server, p.Output)
+		}
+		return w.Flush()
+
+	case "names": // for shell completion
+		for _, name := range cfg.names() {
+			fmt.Fprintln(stdout, name)
+		}
+		return nil
+
+	case "use":
+		if len(args) != 2 {
+			return errors.New("profile use: want a profile name")
+		}
+		if _, ok := cfg.Profiles[args[1]]; !ok {
+			return errors.New("no profile " + args[1])
+		}
+		cfg.Current = args[1]
+		return cfg.save()
+
+	case "set":
+		if len(args) < 2 {
+			return errors.New("profile set: want a profile name")
+		}
+		p, ok := cfg.Profiles[args[1]]
+		if !ok {
+			p = &Profile{Server: defaultServer}
+			cfg.Profiles[args[1]] = p
+		}
+		fs := flag.NewFlagSet("profile set", flag.ContinueOnError)
+		fs.StringVar(&p.Server, "server", p.Server, "server URL")
+		fs.BoolVar(&p.Insecure, "insecure", p.Insecure, "skip TLS certificate verification")
+		fs.StringVar(&p.CACert, "ca-cert", p.CACert, "PEM file of a CA (or self-signed certificate) to trust")
+		fs.StringVar(&p.Output, "output", p.Output, "default output format")
+		fs.StringVar(&p.LineAddr, "line-addr", p.LineAddr, "line-protocol host:port, for watch")
+		if err := fs.Parse(args[2:]); err != nil {
+			return err
+		}
+		return cfg.save()
+
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("profile delete: want a profile name")
+		}
+		if _, ok := cfg.Profiles[args[1]]; !ok {
+			return errors.New("no profile " + args[1])
+		}
+		delete(cfg.Profiles, args[1])
+		if cfg.Current == args[1] {
+			cfg.Current = ""
+		}
+		return cfg.save()
+	}
+	return errors.New("profile: unknown subcommand " + args[0])
+}
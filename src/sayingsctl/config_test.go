@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	srv := newFakeServer(t)
+
+	// Without a file there is just "local", which is current.
+	expect(t, "names", mustRun(t, "profile", "names"), "local\n")
+	p, err := (&options{}).resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "default", *p, Profile{Server: defaultServer, Output: "table"})
+
+	run(t, "profile", "set", "test", "-server", srv.URL, "-output", "json", "-line-addr", "127.0.0.1:1")
+	run(t, "profile", "set", "other", "-server", "http://nonesuch.invalid")
+	expect(t, "names after set", mustRun(t, "profile", "names"), "local\nother\ntest\n")
+	if _, err := run(t, "profile", "use", "test"); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := run(t, "profile", "list")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	expect(t, "list", len(lines), 4)
+	expect(t, "current", strings.Fields(lines[3]), []string{"*", "test", srv.URL, "json"})
+	expect(t, "other", strings.Fields(lines[2]), []string{"other", "http://nonesuch.invalid"})
+
+	// Commands use the current profile, and its output format, unless
+	// told otherwise.
+	if out, err := run(t, "get", "2"); err != nil || !strings.Contains(out, `"Predictor": "Lord Kelvin"`) {
+		t.Errorf("current profile: %q, %v", out, err)
+	}
+	if out, err := run(t, "get", "-output", "table", "2"); err != nil || !strings.Contains(out, "Predictor:") {
+		t.Errorf("-output over the profile: %q, %v", out, err)
+	}
+	if _, err := run(t, "get", "-profile", "other", "-timeout", "1s", "2"); err == nil {
+		t.Error("-profile other: no error")
+	}
+	if _, err := run(t, "get", "-profile", "nonesuch", "2"); err == nil || err.Error() != "no profile nonesuch" {
+		t.Errorf("-profile nonesuch: %v", err)
+	}
+	c, _, err := newClient(&options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "line address", c.line, "127.0.0.1:1")
+	c, _, _ = newClient(&options{profile: "other"})
+	expect(t, "default line address", c.line, "nonesuch.invalid:"+defaultLinePort)
+
+	if _, err := run(t, "profile", "delete", "test"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "names after delete", mustRun(t, "profile", "names"), "local\nother\n")
+	if out, _ := run(t, "profile", "list"); strings.Contains(out, "*") {
+		t.Errorf("deleted profile still current: %q", out)
+	}
+
+	for _, args := range [][]string{
+		{"profile"},
+		{"profile", "use", "nonesuch"},
+		{"profile", "delete", "nonesuch"},
+		{"profile", "use"},
+		{"profile", "rename", "other"},
+	} {
+		if _, err := run(t, args...); err == nil {
+			t.Errorf("%v: no error", args)
+		}
+	}
+}
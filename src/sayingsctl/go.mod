@@ -0,0 +1,3 @@
+module sayingsctl
+
+go 1.25.0
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// Table cells longer than this are cut short.
+const maxCell = 64
+
+// The XML form of a list, which needs a root element.
+type sayingList struct {
+	XMLName xml.Name  `xml:"Sayings"`
+	Sayings []*Saying `xml:"Saying"`
+}
+
+func printSayings(w io.Writer, format string, list []*Saying) error {
+	switch format {
+	case "json":
+		return printJSON(w, list)
+	case "xml":
+		return printXML(w, &sayingList{Sayings: list})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPREDICTOR\tPREDICTION\tTAGS")
+	for _, s := range list {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Id, clip(s.Predictor), clip(s.Prediction), strings.Join(s.Tags, ","))
+	}
+	return tw.Flush()
+}
+
+func printSaying(w io.Writer, format string, s *Saying) error {
+	switch format {
+	case "json":
+		return printJSON(w, s)
+	case "xml":
+		return printXML(w, s)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Id:\t%d\n", s.Id)
+	fmt.Fprintf(tw, "Predictor:\t%s (%d)\n", s.Predictor, s.PredictorId)
+	fmt.Fprintf(tw, "Prediction:\t%s\n", s.Prediction)
+	if s.CompanyId != 0 {
+		fmt.Fprintf(tw, "Company:\t%d\n", s.CompanyId)
+	}
+	if len(s.Tags) > 0 {
+		fmt.Fprintf(tw, "Tags:\t%s\n", strings.Join(s.Tags, ", "))
+	}
+	return tw.Flush()
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	doc, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(doc))
+	return err
+}
+
+func printXML(w io.Writer, v interface{}) error {
+	doc, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, xml.Header+string(doc))
+	return err
+}
+
+func clip(s string) string {
+	if utf8.RuneCountInString(s) <= maxCell {
+		return s
+	}
+	return string([]rune(s)[:maxCell-1]) + "…"
+}
@@ -0,0 +1,121 @@
+/*
+ sayingsctl administers the rest sayings service over HTTP, and follows
+ its changes over the line protocol:
+
+   sayingsctl list -output json
+   sayingsctl create -predictor "Ada Lovelace" -prediction "Engines will compose music."
+   sayingsctl -profile prod watch
+
+ Servers are kept as named profiles (see "sayingsctl profile"), and
+ "sayingsctl completion bash" prints a completion script for the shell.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	run   func(args []string) error
+	usage string
+}
+
+var commands map[string]command
+
+// Set up in init, since completion refers back to the table.
+func init() {
+	commands = map[string]command{
+		"list":       {cmdList, "list [-predictor name] [-tag t]: list sayings"},
+		"get":        {cmdGet, "get ID: show one saying"},
+		"create":     {cmdCreate, "create -predictor name -prediction text [-company-id n] [-tags t,...] [-key k]: add a saying"},
+		"edit":       {cmdEdit, "edit -id ID [-predictor name] [-prediction text]: change a saying"},
+		"delete":     {cmdDelete, "delete ID...: remove sayings"},
+		"import":     {cmdImport, "import FILE: add sayings from a JSON export or a Predictor!Prediction file"},
+		"export":     {cmdExport, "export [-file f] [-format json|xml|lines]: write every saying"},
+		"watch":      {cmdWatch, "watch [-line-addr host:port]: print changes as they happen"},
+		"stats":      {cmdStats, "stats [-top n]: counts, common words and change rates"},
+		"profile":    {cmdProfile, "profile list|names|use|set|delete: manage server profiles"},
+		"completion": {cmdCompletion, "completion bash|zsh|fish: print a shell completion script"},
+	}
+}
+
+// Flags before the command name apply to every command.
+var global = &options{}
+
+// Where commands write their results; tests collect them instead.
+var stdout io.Writer = os.Stdout
+
+func main() {
+	flag.Usage = usage
+	global.register(flag.CommandLine)
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "sayingsctl: unknown command "+args[0])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "sayingsctl:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: sayingsctl [-profile p] [-server url] [-output table|json|xml] command [args]\n\ncommands:")
+	for _, name := range commandNames() {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nglobal flags:")
+	flag.PrintDefaults()
+}
+
+func commandNames() []string {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A FlagSet for a command, which accepts the global flags too, so that
+// they can follow the command name.
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sayingsctl "+commands[name].usage)
+		fs.PrintDefaults()
+	}
+	opts := *global
+	opts.register(fs)
+	return fs, &opts
+}
+
+// Exactly n positional arguments.
+func positional(fs *flag.FlagSet, n int) ([]string, error) {
+	if fs.NArg() != n {
+		return nil, errors.New(fs.Name() + ": want " + plural(n, "argument") + ", got " + strings.Join(fs.Args(), " "))
+	}
+	return fs.Args(), nil
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
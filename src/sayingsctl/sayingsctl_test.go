@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Enough of the rest service for sayingsctl: the routes it calls over
+// HTTP, answered the way the service answers them, and a line-protocol
+// listener that serves WATCH from events.
+type fakeServer struct {
+	*httptest.Server
+	t       *testing.T
+	lock    sync.Mutex
+	sayings map[int]*Saying
+	nextId  int
+	keys    map[string]int // Idempotency-Key to Saying id
+	events  chan string    // lines sent to a WATCH, EVENT included
+	line    net.Listener
+	done    chan bool
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	t.Setenv("SAYINGSCTL_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	srv := &fakeServer{t: t, nextId: 3, keys: make(map[string]int), events: make(chan string, 10),
+		done: make(chan bool),
+		sayings: map[int]*Saying{
+			1: {Id: 1, PredictorId: 1, Predictor: "Ada Lovelace", Prediction: "Engines will compose music.",
+				CompanyId: 2, Tags: []string{"tech"}},
+			2: {Id: 2, PredictorId: 2, Predictor: "Lord Kelvin", Prediction: "Radio has no future."},
+		}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sayingsJSON", srv.list)
+	mux.HandleFunc("GET /sayingJSON/{id}", srv.get)
+	mux.HandleFunc("POST /sayingCreate", srv.create)
+	mux.HandleFunc("PUT /sayingEdit", srv.edit)
+	mux.HandleFunc("DELETE /sayingDelete/{id}", srv.delete)
+	mux.HandleFunc("GET /sayings/stats", srv.stats)
+	srv.Server = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	var err error
+	if srv.line, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		srv.line.Close()
+		close(srv.done)
+	})
+	go srv.watch()
+	return srv
+}
+
+func (srv *fakeServer) list(rw http.ResponseWriter, r *http.Request) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	list := []*Saying{}
+	for _, s := range srv.sayings {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	json.NewEncoder(rw).Encode(list)
+}
+
+func (srv *fakeServer) get(rw http.ResponseWriter, r *http.Request) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	json.NewEncoder(rw).Encode(srv.sayings[id]) // null for none, as the service does
+}
+
+func (srv *fakeServer) create(rw http.ResponseWriter, r *http.Request) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	key := r.Header.Get("Idempotency-Key")
+	if id, ok := srv.keys[key]; ok {
+		rw.Header().Set("Idempotent-Replayed", "true")
+		fmt.Fprintf(rw, "New Saying %d created\n.", id)
+		return
+	}
+	if len(r.FormValue("prediction")) < 6 {
+		fmt.Fprint(rw, "Prediction/predictor must be >= 6 chars.")
+		return
+	}
+	s := &Saying{Id: srv.nextId, Predictor: r.FormValue("predictor"), Prediction: r.FormValue("prediction")}
+	s.PredictorId, _ = strconv.Atoi(r.FormValue("predictorId"))
+	s.CompanyId, _ = strconv.Atoi(r.FormValue("companyId"))
+	if tags := r.FormValue("tags"); tags != "" {
+		s.Tags = strings.Split(tags, ",")
+	}
+	srv.sayings[s.Id] = s
+	srv.nextId++
+	if key != "" {
+		srv.keys[key] = s.Id
+	}
+	fmt.Fprintf(rw, "New Saying %d created\n.", s.Id)
+}
+
+func (srv *fakeServer) edit(rw http.ResponseWriter, r *http.Request) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	s, ok := srv.sayings[id]
+	if !ok {
+		http.Error(rw, "No such Saying", http.StatusNotFound)
+		return
+	}
+	if p := r.FormValue("predictor"); p != "" {
+		s.Predictor = p
+	}
+	if p := r.FormValue("prediction"); p != "" {
+		s.Prediction = p
+	}
+	fmt.Fprintf(rw, "Saying %d updated\n.", id)
+}
+
+func (srv *fakeServer) delete(rw http.ResponseWriter, r *http.Request) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	if _, ok := srv.sayings[id]; !ok {
+		http.Error(rw, "No such Saying", http.StatusNotFound)
+		return
+	}
+	delete(srv.sayings, id)
+	fmt.Fprintf(rw, "Saying %d deleted\n.", id)
+}
+
+func (srv *fakeServer) stats(rw http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(rw, `{"Sayings": 2, "Predictors": [{"PredictorId": 1, "Predictor": "Ada Lovelace", "Sayings": 1}],
+		"Words": [{"Term": "engines", "Count": 1}], "Lengths": {"Shortest": 20, "Longest": 27, "Mean": 23.5},
+		"Rates": [{"Window": "1h", "Created": 3}]}`)
+}
+
+// Serve one WATCH: acknowledge it, relay events, and hang up when they
+// run out or the test ends.
+func (srv *fakeServer) watch() {
+	conn, err := srv.line.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if line, _ := bufio.NewReader(conn).ReadString('\n'); line != "WATCH\n" {
+		fmt.Fprintf(conn, "ERR unknown command %q\n", line)
+		return
+	}
+	fmt.Fprint(conn, "OK watching\n")
+	for {
+		select {
+		case line, ok := <-srv.events:
+			if !ok {
+				return
+			}
+			fmt.Fprint(conn, line+"\n")
+		case <-srv.done:
+			return
+		}
+	}
+}
+
+func (srv *fakeServer) saying(id int) *Saying {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.sayings[id]
+}
+
+// Run a sayingsctl command against srv, returning what it printed.
+func (srv *fakeServer) run(args ...string) (string, error) {
+	srv.t.Helper()
+	return run(srv.t, append([]string{args[0], "-server", srv.URL}, args[1:]...)...)
+}
+
+// Run a sayingsctl command, returning what it printed.
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	out := &bytes.Buffer{}
+	stdout = out
+	defer func() { stdout = os.Stdout }()
+	err := commands[args[0]].run(args[1:])
+	return out.String(), err
+}
+
+// As run, for a command that should succeed.
+func mustRun(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := run(t, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+// As mustRun, against srv.
+func (srv *fakeServer) ok(args ...string) string {
+	srv.t.Helper()
+	return mustRun(srv.t, append([]string{args[0], "-server", srv.URL}, args[1:]...)...)
+}
+
+func expect(t *testing.T, what string, got interface{}, want interface{}) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func expectContains(t *testing.T, what string, got string, wants ...string) {
+	t.Helper()
+	for _, want := range wants {
+		if !strings.Contains(got, want) {
+			t.Errorf("%s: no %q in %q", what, want, got)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		out, err := run(t, "completion", shell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectContains(t, shell, out, strings.Join(commandNames(), " "), "sayingsctl profile names")
+	}
+	out, _ := run(t, "completion", "bash")
+	expectContains(t, "bash flags", out, strings.Join(commonFlags, " "), "complete -F _sayingsctl sayingsctl")
+	out, _ = run(t, "completion", "zsh")
+	if !strings.HasPrefix(out, "autoload -U +X bashcompinit") {
+		t.Errorf("zsh: %q", out[:40])
+	}
+	for _, args := range [][]string{{"completion"}, {"completion", "tcsh"}} {
+		if _, err := run(t, args...); err == nil {
+			t.Errorf("%v: no error", args)
+		}
+	}
+}
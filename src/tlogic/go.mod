@@ -0,0 +1,3 @@
+module tlogic
+
+go 1.25.0
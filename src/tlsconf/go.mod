@@ -0,0 +1,3 @@
+module tlsconf
+
+go 1.25.0
@@ -0,0 +1,208 @@
+// Package tlsconf builds TLS (and so HTTP/2) configurations for the demo
+// servers. Certificates are re-read from disk on SIGHUP, so they can be
+// rotated without a restart.
+package tlsconf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Settings as given on the command line. An empty CertFile means plain HTTP.
+type Settings struct {
+	CertFile     string
+	KeyFile      string
+	MinVersion   string // "1.2" (default) or "1.3"
+	ClientCAFile string // if set, clients must present a cert signed by it
+}
+
+// Register the -tls-* flags on the default FlagSet.
+func (s *Settings) RegisterFlags() {
+	flag.StringVar(&s.CertFile, "tls-cert", "", "PEM certificate file (enables HTTPS and HTTP/2)")
+	flag.StringVar(&s.KeyFile, "tls-key", "", "PEM private key file")
+	flag.StringVar(&s.MinVersion, "tls-min", "1.2", "minimum TLS version: 1.2 or 1.3")
+	flag.StringVar(&s.ClientCAFile, "tls-client-ca", "", "PEM CA bundle; requires client certificates")
+}
+
+func (s *Settings) Enabled() bool { return s.CertFile != "" }
+
+// A Reloader hands out the current certificate and client CA pool to the
+// TLS stack and swaps them when Reload is called.
+type Reloader struct {
+	settings Settings
+	lock     sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+}
+
+func NewReloader(s Settings) (*Reloader, error) {
+	r := &Reloader{settings: s}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Re-read the certificate, key and client CA bundle. On error the
+// previously loaded material stays in use.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.settings.CertFile, r.settings.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var pool *x509.CertPool
+	if r.settings.ClientCAFile != "" {
+		bundle, err := ioutil.ReadFile(r.settings.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return errors.New("no certificates in " + r.settings.ClientCAFile)
+		}
+	}
+
+	r.lock.Lock()
+	r.cert = &cert
+	r.clientCA = pool
+	r.lock.Unlock()
+	return nil
+}
+
+// Reload whenever the process receives SIGHUP.
+func (r *Reloader) WatchSIGHUP() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := r.Reload(); err != nil {
+				log.Println("TLS reload failed, keeping old certificate:", err)
+			} else {
+				log.Println("TLS certificate reloaded")
+			}
+		}
+	}()
+}
+
+// The tls.Config to hand to an http.Server. Each handshake asks for the
+// current material, which is what makes reloading take effect.
+func (r *Reloader) Config() (*tls.Config, error) {
+	minVersion, err := parseVersion(r.settings.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion: minVersion,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.lock.RLock()
+		defer r.lock.RUnlock()
+
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.Certificates = []tls.Certificate{*r.cert}
+		if r.clientCA != nil {
+			c.ClientCAs = r.clientCA
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		return c, nil
+	}
+	return base, nil
+}
+
+// Run the server: over TLS with HTTP/2 if the settings name a
+// certificate, otherwise as plain HTTP/1.1.
+func ListenAndServe(srv *http.Server, s Settings) error {
+	if !s.Enabled() {
+		return srv.ListenAndServe()
+	}
+
+	r, err := NewReloader(s)
+	if err != nil {
+		return err
+	}
+	if srv.TLSConfig, err = r.Config(); err != nil {
+		return err
+	}
+	r.WatchSIGHUP()
+	return srv.ListenAndServeTLS("", "")
+}
+
+func parseVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, errors.New("unsupported TLS version " + v)
+}
+
+// Write a self-signed certificate and key, valid for a year, for the given
+// comma-separated host names and IP addresses. For local development only.
+func WriteSelfSigned(hosts string, certFile string, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"go-stuff development"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range strings.Split(hosts, ",") {
+		h = strings.TrimSpace(h)
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if h != "" {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(certFile, certPem, 0644); err != nil {
+		return err
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return ioutil.WriteFile(keyFile, keyPem, 0600)
+}
@@ -0,0 +1,217 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// A pair from WriteSelfSigned, and a listener serving the Reloader's
+// config, which completes each handshake and hangs up.
+type fixture struct {
+	settings Settings
+	reloader *Reloader
+	addr     string
+	t        *testing.T
+}
+
+func newFixture(t *testing.T, tweak func(*Settings)) *fixture {
+	t.Helper()
+	dir := t.TempDir()
+	f := &fixture{t: t, settings: Settings{CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile: filepath.Join(dir, "key.pem")}}
+	f.rotate()
+	if tweak != nil {
+		tweak(&f.settings)
+	}
+
+	var err error
+	if f.reloader, err = NewReloader(f.settings); err != nil {
+		t.Fatal(err)
+	}
+	config, err := f.reloader.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	f.addr = listener.Addr().String()
+	return f
+}
+
+// Replace the pair on disk with a new one.
+func (f *fixture) rotate() {
+	f.t.Helper()
+	if err := WriteSelfSigned("localhost,127.0.0.1", f.settings.CertFile, f.settings.KeyFile); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// The serial number of the certificate in the file.
+func (f *fixture) onDisk() *big.Int {
+	f.t.Helper()
+	pair, err := tls.LoadX509KeyPair(f.settings.CertFile, f.settings.KeyFile)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return cert.SerialNumber
+}
+
+// Connect, trusting any certificate, and return the connection's state.
+func (f *fixture) dial(config *tls.Config) (tls.ConnectionState, error) {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config.InsecureSkipVerify = true
+	conn, err := tls.Dial("tcp", f.addr, config)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState(), nil
+}
+
+// The serial number of the certificate the listener serves.
+func (f *fixture) served() *big.Int {
+	f.t.Helper()
+	state, err := f.dial(nil)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return state.PeerCertificates[0].SerialNumber
+}
+
+func TestReload(t *testing.T) {
+	f := newFixture(t, nil)
+	first := f.onDisk()
+	if f.served().Cmp(first) != 0 {
+		t.Fatal("not serving the certificate on disk")
+	}
+
+	// Until reloaded, the listener keeps the old certificate.
+	f.rotate()
+	second := f.onDisk()
+	if f.served().Cmp(first) != 0 {
+		t.Error("changed before the reload")
+	}
+	if err := f.reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if f.served().Cmp(second) != 0 {
+		t.Error("not changed by the reload")
+	}
+
+	// A broken pair is refused, and the last good one stays in use.
+	if err := ioutil.WriteFile(f.settings.KeyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.reloader.Reload(); err == nil {
+		t.Error("no error for a broken key")
+	}
+	if f.served().Cmp(second) != 0 {
+		t.Error("changed by a failed reload")
+	}
+}
+
+func TestWatchSIGHUP(t *testing.T) {
+	f := newFixture(t, nil)
+	f.reloader.WatchSIGHUP()
+	f.rotate()
+	want := f.onDisk()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); f.served().Cmp(want) != 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("not changed by SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	f := newFixture(t, nil)
+	state, err := f.dial(&tls.Config{NextProtos: []string{"h2", "http/1.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.NegotiatedProtocol != "h2" {
+		t.Errorf("protocol %q, want h2", state.NegotiatedProtocol)
+	}
+	if _, err := f.dial(&tls.Config{MaxVersion: tls.VersionTLS11}); err == nil {
+		t.Error("TLS 1.1 accepted")
+	}
+
+	f = newFixture(t, func(s *Settings) { s.MinVersion = "1.3" })
+	if _, err := f.dial(&tls.Config{MaxVersion: tls.VersionTLS12}); err == nil {
+		t.Error("TLS 1.2 accepted with -tls-min 1.3")
+	}
+	if _, err := f.dial(nil); err != nil {
+		t.Errorf("TLS 1.3: %v", err)
+	}
+
+	r := &Reloader{settings: Settings{MinVersion: "1.1"}}
+	if _, err := r.Config(); err == nil {
+		t.Error("no error for TLS 1.1")
+	}
+	if _, err := NewReloader(Settings{CertFile: "nonesuch.pem", KeyFile: "nonesuch.pem"}); err == nil {
+		t.Error("no error for missing files")
+	}
+}
+
+// With a client CA, only clients with a certificate it signed get in.
+// (Under TLS 1.3 a client learns of a refusal on its first read, and one
+// let in reads the listener's hang-up.)
+func TestClientCA(t *testing.T) {
+	f := newFixture(t, func(s *Settings) { s.ClientCAFile = s.CertFile })
+	client, err := tls.LoadX509KeyPair(f.settings.CertFile, f.settings.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(config *tls.Config) error {
+		config.InsecureSkipVerify = true
+		conn, err := tls.Dial("tcp", f.addr, config)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = conn.Read(make([]byte, 1))
+		return err
+	}
+	if err := read(&tls.Config{Certificates: []tls.Certificate{client}}); err != io.EOF {
+		t.Errorf("with a client certificate: %v", err)
+	}
+	if err := read(&tls.Config{}); err == io.EOF {
+		t.Error("without a client certificate: let in")
+	}
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	ioutil.WriteFile(bundle, []byte("no certificates here"), 0644)
+	if _, err := NewReloader(Settings{CertFile: f.settings.CertFile, KeyFile: f.settings.KeyFile, ClientCAFile: bundle}); err == nil {
+		t.Error("no error for an empty client CA bundle")
+	}
+}